@@ -1,93 +1,555 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"time"
 
-	. "github.com/logrusorgru/aurora"
 	. "github.com/mesosphere-incubator/preflighter/util"
 )
 
+// The title of the checklists given as `runbook:<step>` arguments
+const RUNBOOK_CHECKLIST_TITLE = "Runbook Checklist"
+
 func main() {
-	var runbook *RunbookClient = nil
+	var runbook Runbook = nil
 	var err error = nil
 
+	fCacheDir := flag.String("cache-dir", "", "keep the passing results of the items with a cache_ttl in the given directory")
+	fMaxOutput := flag.String("max-output", "", "the size of the script outputs to capture (e.g. 1M), truncating the rest")
+	fTimeout := flag.String("timeout", "", "the default timeout of the item scripts (e.g. 30s)")
+	fRetries := flag.Int("retries", 0, "the default number of times to retry a failed check")
+	fRetryDelay := flag.String("retry-delay", "", "the default time to wait before retrying a failed check")
+	fSudo := flag.String("sudo", "sudo -E", "the command that runs the scripts of the privileged items")
 	fTempDir := flag.String("temp", "", "keep temporary files in the given directory")
 	fSkipPtr := flag.Int("s", 0, "the number of items to skip")
 	fListPtr := flag.Bool("l", false, "list the items and exit")
+	fListGraph := flag.Bool("list-graph", false, "list the items as a tree of their dependencies and conditions, highlighting the cycles, and exit")
+	fGraphFormat := flag.String("graph-format", "text", "the format of -list-graph: text, or dot for Graphviz")
+	fRepeat := flag.Int("repeat", 1, "run the checklists the given number of times and report the stability of every item")
+	fInterval := flag.Duration("interval", 0, "the time to wait between the -repeat runs")
+	fHeartbeat := flag.Duration("heartbeat", 0, "print a line to stderr at the given interval while an item runs, for CI systems that kill idle jobs")
+	fJobs := flag.Int("j", 1, "run the checks of up to this number of passive items at once in unattended runs, still showing the results in order")
+	fItemDelay := flag.Duration("item-delay", 0, "the time to wait between the items that run, e.g. for rate-limited systems")
+	fRequireAllPass := flag.Bool("require-all-pass", true, "fail the -repeat runs if any of them failed, instead of only if all of them failed")
+	fShuffle := flag.Bool("shuffle", false, "run the items in a random order")
+	fReverse := flag.Bool("reverse", false, "run the items in the reverse order")
+	fSeed := flag.Int64("seed", 0, "the seed of the -shuffle order, random by default")
+	fSaveOrder := flag.String("save-order", "", "save the order of the items to the given file")
+	fUseOrder := flag.String("use-order", "", "run the items in the order saved in the given file")
+	fSample := flag.Float64("sample", 0, "run only a random fraction of the items (e.g. 0.2)")
+	fSampleSeed := flag.Int64("sample-seed", 0, "the seed of the -sample choice, random by default")
+	fSampleWeighted := flag.Bool("sample-weighted", false, "favor the items with a higher weight in the -sample choice")
+	fShard := flag.String("shard", "", "run only the given i/n subset of the items, to split the run across machines")
+	fShardBy := flag.String("shard-by", "index", "partition the -shard items by their index or by a hash of their title")
+	fBudget := flag.Int("budget", 0, "stop running the items once their total cost would exceed the given budget")
+	fSelect := flag.Bool("select", false, "interactively pick the items to run")
+	fExplainItem := flag.Int("explain-item", 0, "print the resolved configuration of the item with the given number and exit")
 	fAutoPtr := flag.Bool("a", false, "run the tests unattended")
+	fAuthorMode := flag.Bool("author-mode", false, "stop at the first item that does not pass, with its full details, and offer to re-run it")
+	fInteractiveOnFailure := flag.Bool("interactive-on-failure", false, "when running unattended, prompt what to do with a failed item")
+	fAutoFix := flag.Bool("auto-fix", false, "run the fix script of a failed item and check it again (prompting first in interactive runs)")
+	fConfirmAll := flag.Bool("confirm-all", false, "answer yes to the OK prompts of the items in interactive runs")
+	fConfirmNone := flag.Bool("confirm-none", false, "answer no to the OK prompts of the items in interactive runs")
+	fAllowShell := flag.Bool("allow-shell", false, "offer to open a shell in the environment of a failed item")
+	fPreview := flag.Bool("preview", false, "print a summary of what will run and ask for a single confirmation before starting")
+	fYes := flag.Bool("yes", false, "confirm the -preview in advance, for runs without a terminal")
+	fAck := flag.Bool("ack", false, "require the operator to type CONTINUE after all the checks passed")
+	fStrictEnv := flag.Bool("strict-env", false, "fail the run if a script references a variable that is not defined")
+	fIsolateEnv := flag.Bool("isolate-env", false, "give the items only the variables of their own checklist file")
+	fSharedEnvFromFirst := flag.Bool("shared-env-from-first", false, "give the items the variables of the first checklist file as defaults of the ones of their own file (implies -isolate-env)")
+	fJSON := flag.Bool("json", false, "deprecated alias of -format json")
+	fFormat := flag.String("format", "text", "the format of the output of the run: text, or json to print only the results of the items as JSON on stdout (implies -a)")
+	flag.StringVar(fFormat, "o", "text", "shorthand for -format")
+	fCheckTools := flag.Bool("check-tools", false, "check that the required tools are available and exit")
+	fEnvName := flag.String("env-name", "", "apply the overrides of the given environment to the checklists")
+	fValues := flag.String("values", "", "render the item titles and scripts as templates against the given YAML or JSON file")
+	fEnvFrom := flag.String("env-from", "", "seed the environment from the KEY=value output of the given command")
+	fPromptSecrets := flag.Bool("prompt-secrets", false, "prompt for missing required variables when running in a terminal")
+	fRunID := flag.String("run-id", "", "the unique ID of the run, generated by default")
+	fManifest := flag.String("manifest", "", "run the checklists listed in the given manifest file, before the ones of the arguments")
+	fMeta := make(KeyValueFlag)
+	flag.Var(fMeta, "meta", "attach key=value metadata to the reports (can be repeated)")
+	var fEnvSets StringListFlag
+	flag.Var(&fEnvSets, "env-set", "run the checklists once for every name=file set of variables (can be repeated)")
+	var fTokens StringListFlag
+	flag.Var(&fTokens, "token", "the confirmation token of a checklist that requires one (can be repeated)")
+	fFmt := flag.Bool("fmt", false, "rewrite the checklists in their canonical form and exit")
+	fFmtCheck := flag.Bool("check", false, "with -fmt, only list the checklists that are not in their canonical form")
+	fValidate := flag.Bool("validate", false, "check the checklists for problems and exit")
+	fStaleDays := flag.Int("stale-days", 180, "warn during -validate if a checklist was last reviewed more days ago")
+	fVerbose := flag.Bool("v", false, "show more details")
+	fSaveBaseline := flag.String("save-baseline", "", "save the output of every item as a baseline to the given file")
+	fUpdateGolden := flag.Bool("update-golden", false, "replace the golden files of the items with their current output")
+	fCompareBaseline := flag.String("compare-baseline", "", "fail the items whose output differs from the given baseline file")
+	fFailOnWarning := flag.Bool("fail-on-warning", false, "fail the run if an item with allowed failures failed")
+	fUnknownAs := flag.String("unknown-as", STATUS_FAIL, "treat the items whose check exits with 2, for an unknown outcome, as pass, fail or skip")
+	fStrictXPass := flag.Bool("strict-xpass", false, "fail the run if an item that is expected to fail passed")
+	fFailOnEmpty := flag.Bool("fail-on-empty", false, "exit with an error if there are no items to run")
+	fSummaryOnly := flag.Bool("summary-only", false, "run unattended and print only the summary at the end")
+	fCompact := flag.Bool("compact", false, "print a single line per item when running unattended")
+	fStreamEndpoint := flag.String("stream-endpoint", "", "post the events of the run as NDJSON to the given URL while running")
+	fGithubOutput := flag.Bool("github-output", false, "print the results as GitHub Actions workflow commands")
+	fOutputDir := flag.String("output-dir", "", "write all the reports to a timestamped directory in the given one")
+	fHtmlReport := flag.String("html", "", "write a standalone HTML report to the given file")
+	fExportScript := flag.String("export-script", "", "write a standalone bash script that performs the checks to the given file and exit")
+	fExportSecrets := flag.Bool("export-secrets-as-env", true, "reference the required variables from the environment of the exported script, instead of inlining their values")
+	fRecursive := flag.Bool("recursive", false, "load the checklist files of the subdirectories of the directory arguments too")
+	fTitle := flag.String("title", "", "the title of the run in the header and the reports, instead of the one of the first checklist")
+	fStatusLine := flag.Bool("status-line", false, "print a one-line summary of the run for the scripts as the last line of stderr")
+	fKeepGoing := flag.Bool("keep-going", false, "run the remaining items after a failure instead of aborting, and list all the failed items after the summary")
+	flag.BoolVar(fKeepGoing, "k", false, "shorthand for -keep-going")
+	fMaxFailures := flag.Int("max-failures", 0, "with -keep-going, abort the remaining items once the given number of items failed")
+	fSortSummary := flag.String("sort-summary", "", "list the items in the summary, in the given order: order (of the run), status (failures first) or duration (slowest first)")
+	fExplainFailures := flag.Bool("explain-failures", false, "print the failed items grouped by category or by common error, with their remediation, after the summary")
+	fRemediationScript := flag.String("remediation-script", "", "write the remediation commands of the failed items to the given script")
+	fRedactPatterns := flag.String("redact-patterns", "", "mask the output matching the regular expressions of the given file, one per line, in the reports and runbook updates")
+	fIncludeEnv := flag.Bool("include-env-on-failure", false, "include the variables of the failed items, with the secrets masked, in the reports")
+	fLogDir := flag.String("log-dir", "", "write the full output of every item to a log file in the given directory")
+	fNoColor := flag.Bool("no-color", false, "disable colors in the output")
+	fWidth := flag.Int("width", 0, "fit the output to this number of columns, instead of the width of the terminal")
+	fNoClock := flag.Bool("no-clock", false, "don't show the elapsed time in the terminal title during interactive runs")
+	fRerunCompleted := flag.Bool("rerun-completed", false, "run the items that are already completed in the runbook")
+	fOnlyChangedRunbook := flag.Bool("only-changed-runbook", false, "run only the runbook items that are new or whose status changed since the previous run")
+	fRunbookStateDir := flag.String("runbook-state-dir", "", "record the statuses of the runbook items of every run in the given directory")
+	fRunbookStateKeep := flag.Int("runbook-state-keep", 20, "the number of the most recent runs whose runbook statuses are kept, or 0 to keep them all")
+	fScaffold := flag.String("scaffold", "", "write a checklist with a stub for every item of the given runbook:<step> and exit")
+	fForce := flag.Bool("force", false, "overwrite the existing file of -scaffold")
+	fRunbookFixture := flag.String("runbook-fixture", "", "serve runbook steps from the given YAML fixture")
+	fLegacyExitCodes := flag.Bool("legacy-exit-codes", false, "exit with 1 on any kind of failure")
+	fProfileCPU := flag.String("profile-cpu", "", "write a CPU profile of preflighter to the given file")
+	fProfileMem := flag.String("profile-mem", "", "write a memory profile of preflighter to the given file")
+	HideFlags("profile-cpu", "profile-mem")
 	flag.Parse()
-	if len(flag.Args()) == 0 {
+	if err := ApplyEnvFlags(flag.CommandLine); err != nil {
+		UxPrintError(err)
+		Exit(EXIT_CONFIG_ERROR)
+	}
+	SetLegacyExitCodes(*fLegacyExitCodes)
+	if err := StartProfiling(*fProfileCPU, *fProfileMem); err != nil {
+		UxPrintError(err)
+		Exit(EXIT_CONFIG_ERROR)
+	}
+	if *fSharedEnvFromFirst {
+		*fIsolateEnv = true
+	}
+
+	// The JSON results are the only output on stdout, the human-readable
+	// output of the run goes to stderr instead
+	resultsOut := os.Stdout
+	if *fJSON {
+		*fFormat = "json"
+	}
+	switch *fFormat {
+	case "text":
+	case "json":
+		if len(fEnvSets) > 0 || *fRepeat > 1 {
+			UxPrintError(fmt.Errorf("The -format json output does not support -env-set and -repeat"))
+			Exit(EXIT_CONFIG_ERROR)
+		}
+		*fAutoPtr = true
+		*fCompact = false
+		os.Stdout = os.Stderr
+	default:
+		UxPrintError(fmt.Errorf("Invalid -format %s, expecting text or json", *fFormat))
+		Exit(EXIT_CONFIG_ERROR)
+	}
+	switch *fSortSummary {
+	case "", SUMMARY_SORT_ORDER, SUMMARY_SORT_STATUS, SUMMARY_SORT_DURATION:
+	default:
+		UxPrintError(fmt.Errorf("Invalid -sort-summary %s, expecting order, status or duration", *fSortSummary))
+		Exit(EXIT_CONFIG_ERROR)
+	}
+	if *fMaxFailures < 0 {
+		UxPrintError(fmt.Errorf("Invalid -max-failures %d, expecting at least 1", *fMaxFailures))
+		Exit(EXIT_CONFIG_ERROR)
+	}
+	if *fMaxFailures > 0 && !*fKeepGoing {
+		UxPrintError(fmt.Errorf("The -max-failures flag requires -keep-going, the run aborts at the first failure otherwise"))
+		Exit(EXIT_CONFIG_ERROR)
+	}
+	if *fRunbookStateKeep < 0 {
+		UxPrintError(fmt.Errorf("Invalid -runbook-state-keep %d, expecting 0 or more", *fRunbookStateKeep))
+		Exit(EXIT_CONFIG_ERROR)
+	}
+	if *fJobs < 1 {
+		UxPrintError(fmt.Errorf("Invalid -j %d, expecting at least 1", *fJobs))
+		Exit(EXIT_CONFIG_ERROR)
+	}
+	if *fJobs > 1 && !*fAutoPtr {
+		UxPrintError(fmt.Errorf("The -j flag requires an unattended run with -a"))
+		Exit(EXIT_CONFIG_ERROR)
+	}
+	if *fJobs > 1 && *fItemDelay > 0 {
+		UxPrintError(fmt.Errorf("The -j flag cannot be combined with -item-delay"))
+		Exit(EXIT_CONFIG_ERROR)
+	}
+	if *fSummaryOnly {
+		*fAutoPtr = true
+		*fCompact = false
+	}
+	if *fAuthorMode {
+		// Fast feedback while writing a checklist, for a human reader
+		*fAutoPtr = true
+		*fVerbose = true
+		*fCompact = false
+		*fGithubOutput = false
+		*fStreamEndpoint = ""
+	}
+	if *fNoColor || os.Getenv("NO_COLOR") != "" || !IsTerminal(os.Stdout.Fd()) {
+		UxSetColors(false)
+	}
+	if *fWidth < 0 {
+		UxPrintError(fmt.Errorf("Invalid -width %d", *fWidth))
+		Exit(EXIT_CONFIG_ERROR)
+	}
+	UxSetWidth(*fWidth)
+	if *fScaffold != "" {
+		Exit(scaffoldChecklist(*fScaffold, flag.Args(), *fRunbookFixture, *fForce))
+	}
+	if len(flag.Args()) == 0 && *fManifest == "" {
 		UxPrintError(fmt.Errorf("Please specify one or more checklists to process"))
-		return
+		Exit(EXIT_CONFIG_ERROR)
+	}
+	if *fAck && (*fAutoPtr || !IsTerminal(os.Stdin.Fd())) {
+		UxPrintError(fmt.Errorf("The -ack flag requires an interactive run in a terminal"))
+		Exit(EXIT_CONFIG_ERROR)
+	}
+	if *fUnknownAs != STATUS_PASS && *fUnknownAs != STATUS_FAIL && *fUnknownAs != STATUS_SKIP {
+		UxPrintError(fmt.Errorf("Invalid -unknown-as %s, expecting pass, fail or skip", *fUnknownAs))
+		Exit(EXIT_CONFIG_ERROR)
+	}
+	if *fConfirmAll && *fConfirmNone {
+		UxPrintError(fmt.Errorf("The -confirm-all and -confirm-none flags cannot be used together"))
+		Exit(EXIT_CONFIG_ERROR)
+	}
+	if *fPreview && !*fYes && !IsTerminal(os.Stdin.Fd()) {
+		UxPrintError(fmt.Errorf("The -preview flag requires a terminal to confirm the run, or -yes to confirm it in advance"))
+		Exit(EXIT_CONFIG_ERROR)
+	}
+	if *fSample < 0 || *fSample > 1 {
+		UxPrintError(fmt.Errorf("Invalid -sample %v, expecting a fraction between 0 and 1", *fSample))
+		Exit(EXIT_CONFIG_ERROR)
+	}
+	var shard *Shard
+	if *fShard != "" {
+		shard, err = ParseShard(*fShard)
+		if err != nil {
+			UxPrintError(err)
+			Exit(EXIT_CONFIG_ERROR)
+		}
+		fMeta["shard"] = shard.String()
+	}
+	if *fShardBy != "index" && *fShardBy != "title" {
+		UxPrintError(fmt.Errorf("Invalid -shard-by %s, expecting index or title", *fShardBy))
+		Exit(EXIT_CONFIG_ERROR)
+	}
+	if *fSelect && !IsTerminal(os.Stdin.Fd()) {
+		UxPrintError(fmt.Errorf("The -select flag requires a terminal, use -s to skip items in unattended runs"))
+		Exit(EXIT_CONFIG_ERROR)
+	}
+	if len(fEnvSets) > 0 {
+		Exit(runEnvSets(fEnvSets))
+	}
+	if *fRepeat > 1 {
+		Exit(runSoak(*fRepeat, *fInterval, *fRequireAllPass))
+	}
+	runID := *fRunID
+	if runID == "" {
+		runID = CreateRunID()
+	}
+	fMeta["run_id"] = runID
+	envSet := os.Getenv("PREFLIGHTER_ENV_SET")
+	if envSet != "" {
+		fMeta["env_set"] = envSet
+		*fHtmlReport = envSetPath(*fHtmlReport, envSet)
+		*fLogDir = envSetPath(*fLogDir, envSet)
+		*fSaveBaseline = envSetPath(*fSaveBaseline, envSet)
+		*fRemediationScript = envSetPath(*fRemediationScript, envSet)
+		*fOutputDir = envSetPath(*fOutputDir, envSet)
+	}
+
+	// Everything after a `--` is passed to the scripts as positional arguments
+	fileArgs, scriptArgs := flag.Args(), []string(nil)
+	for i, arg := range fileArgs {
+		if arg == "--" {
+			fileArgs, scriptArgs = fileArgs[:i], fileArgs[i+1:]
+			break
+		}
+	}
+
+	gitCacheDir := filepath.Join(os.TempDir(), "preflighter-git")
+	if *fTempDir != "" {
+		gitCacheDir = filepath.Join(*fTempDir, "git")
+	}
+	args, err := expandArguments(fileArgs, gitCacheDir, *fRecursive)
+	if err != nil {
+		UxPrintError(err)
+		Exit(EXIT_CONFIG_ERROR)
+	}
+
+	// The checklists of the manifest run first, with their own variables
+	var manifestVars []map[string]string
+	if *fManifest != "" {
+		entries, err := LoadManifest(*fManifest)
+		if err != nil {
+			UxPrintError(err)
+			Exit(EXIT_CONFIG_ERROR)
+		}
+		var files []string
+		for _, entry := range entries {
+			files = append(files, entry.File)
+			manifestVars = append(manifestVars, entry.Env)
+		}
+		args = append(files, args...)
+	}
+
+	if *fFmt {
+		Exit(formatChecklists(args, *fFmtCheck))
+	}
+
+	if *fValidate {
+		if !validateChecklists(args, time.Duration(*fStaleDays)*24*time.Hour) {
+			Exit(EXIT_CONFIG_ERROR)
+		}
+		Exit(EXIT_SUCCESS)
 	}
 
 	// Read the checklists from the given arguments
 	useRunbook := false
 	var checklistFiles []*ChecklistFile
-	for _, fname := range flag.Args() {
+	for i, fname := range args {
 		if strings.HasPrefix(fname, "runbook:") {
 			stepId := fname[8:]
 			useRunbook = true
 			checklistFiles = append(checklistFiles, &ChecklistFile{
-				Title:        "Runbook Checklist",
+				Title:        RUNBOOK_CHECKLIST_TITLE,
 				RunbookSteps: []string{stepId},
 			})
 			continue
 		}
 
-		checklist, err := LoadChecklist(fname)
+		checklists, err := LoadChecklist(fname)
 		if err != nil {
 			UxPrintError(err)
-			return
+			Exit(EXIT_CONFIG_ERROR)
 		}
+		for _, checklist := range checklists {
+			if i < len(manifestVars) && len(manifestVars[i]) > 0 {
+				if checklist.Env == nil {
+					checklist.Env = make(map[string]string)
+				}
+				for key, value := range manifestVars[i] {
+					checklist.Env[key] = value
+				}
+			}
 
-		// Check if runbook is needed
-		if len(checklist.RunbookSteps) > 0 {
-			useRunbook = true
-		}
-		for _, step := range checklist.Checklist {
-			if step.RunbookID != "" {
+			// Check if runbook is needed
+			if len(checklist.RunbookSteps) > 0 {
 				useRunbook = true
 			}
+			for _, step := range checklist.Checklist {
+				if step.RunbookID != "" {
+					useRunbook = true
+				}
+			}
+
+			checklistFiles = append(checklistFiles, checklist)
+		}
+	}
+	var sharedEnvFile *ChecklistFile
+	if *fSharedEnvFromFirst && len(checklistFiles) > 0 {
+		sharedEnvFile = checklistFiles[0]
+	}
+	SortChecklistFiles(checklistFiles)
+	if err := CheckRequiredTokens(checklistFiles, fTokens); err != nil {
+		UxPrintError(err)
+		Exit(EXIT_CONFIG_ERROR)
+	}
+
+	// Render the checklists against the values, if given
+	if *fValues != "" {
+		values, err := LoadValues(*fValues)
+		if err != nil {
+			UxPrintError(err)
+			Exit(EXIT_CONFIG_ERROR)
+		}
+		for _, checklist := range checklistFiles {
+			err = RenderChecklistValues(checklist, values)
+			if err != nil {
+				UxPrintError(err)
+				Exit(EXIT_CONFIG_ERROR)
+			}
+		}
+	}
+
+	// Apply the overrides of the selected environment
+	if *fEnvName != "" {
+		found := false
+		for _, checklist := range checklistFiles {
+			found = found || len(checklist.Overrides) > 0
+			err = ApplyChecklistOverrides(checklist, *fEnvName)
+			if err != nil {
+				UxPrintError(err)
+				Exit(EXIT_CONFIG_ERROR)
+			}
 		}
+		if !found {
+			UxPrintError(fmt.Errorf("None of the checklists has overrides for environment '%s'", *fEnvName))
+			Exit(EXIT_CONFIG_ERROR)
+		}
+		fMeta["env_name"] = *fEnvName
+	}
 
-		checklistFiles = append(checklistFiles, checklist)
+	var redactor *Redactor = nil
+	if *fRedactPatterns != "" {
+		redactor, err = LoadRedactPatterns(*fRedactPatterns)
+		if err != nil {
+			UxPrintError(err)
+			Exit(EXIT_CONFIG_ERROR)
+		}
 	}
 
 	// Create runbook instance if needed
-	if useRunbook {
+	if *fRunbookFixture != "" {
+		runbook, err = LoadRunbookFixture(*fRunbookFixture)
+		if err != nil {
+			UxPrintError(fmt.Errorf("Could not use runbook fixture: %s", err.Error()))
+			Exit(EXIT_CONFIG_ERROR)
+		}
+	} else if useRunbook {
 		runbook, err = CreateRunbookClientWithEnvConfig()
 		if err != nil {
 			UxPrintError(fmt.Errorf("Could not use runbook: %s", err.Error()))
-			os.Exit(1)
+			Exit(EXIT_ENVIRONMENT_ERROR)
+		}
+	}
+	runbookCodes := DefaultRunbookStatusCodes
+	if runbook != nil {
+		runbookCodes = runbook.StatusCodes()
+	}
+
+	// Record the statuses of the runbook items, to run only the changed ones
+	// the next time
+	runbookState := NewRunbookState(runID)
+	var lastRunbookState *RunbookState = nil
+	runbookStateDir := *fRunbookStateDir
+	if runbookStateDir == "" {
+		runbookStateDir = DefaultRunbookStateDir()
+		if *fTempDir != "" {
+			runbookStateDir = filepath.Join(*fTempDir, "runbook-state")
+		}
+	}
+	if *fOnlyChangedRunbook && runbook != nil {
+		lastRunbookState, err = LoadLastRunbookState(runbookStateDir, runID)
+		if err != nil {
+			UxPrintError(err)
+			Exit(EXIT_ENVIRONMENT_ERROR)
+		}
+		if lastRunbookState == nil {
+			UxPrintWarning(fmt.Errorf("No runbook statuses were recorded in %s, running all the runbook items", runbookStateDir))
+		}
+	}
+
+	// Check if we should verify the required tools without running
+	toolsMissing := false
+	if *fCheckTools {
+		var tools []string
+		for _, file := range checklistFiles {
+			tools = append(tools, file.RequireTools...)
+		}
+		missing := MissingTools(tools)
+		toolsMissing = len(missing) > 0
+		if *fFormat == "json" {
+			err = PrintMissingToolsJSON(resultsOut, missing, checklistFiles)
+			if err != nil {
+				UxPrintError(err)
+				Exit(EXIT_ENVIRONMENT_ERROR)
+			}
+		} else if toolsMissing {
+			UxPrintMissingTools(missing)
+		} else {
+			fmt.Println("All the required tools are available")
+		}
+		if !*fListPtr {
+			if toolsMissing {
+				Exit(EXIT_MISSING_TOOLS)
+			}
+			Exit(EXIT_SUCCESS)
+		}
+	}
+
+	// Seed the environment from the output of an external command
+	if *fEnvFrom != "" {
+		out, err := exec.Command("bash", "-c", *fEnvFrom).Output()
+		if err != nil {
+			UxPrintError(fmt.Errorf("Unable to execute '%s': %s", *fEnvFrom, err.Error()))
+			Exit(EXIT_ENVIRONMENT_ERROR)
+		}
+		env, err := ParseEnvOutput(string(out))
+		if err != nil {
+			UxPrintError(fmt.Errorf("Could not parse the output of '%s': %s", *fEnvFrom, err.Error()))
+			Exit(EXIT_ENVIRONMENT_ERROR)
+		}
+		for key, value := range env {
+			os.Setenv(key, value)
 		}
 	}
 
 	// Check for required environment variables
 	failed := false
+	// The variables not to inline in exported scripts
+	secrets := map[string]bool{"DCOS_ACS_TOKEN": true}
 	for _, file := range checklistFiles {
 		for key, value := range file.Env {
-			if strings.HasPrefix(value, "${") {
-				if len(value) < 3 {
-					file.Env[key] = ""
-					continue
+			envValue, err := ParseEnvValue(value)
+			if err != nil {
+				failed = true
+				UxPrintError(fmt.Errorf("Invalid value for %s: %s", key, err.Error()))
+				continue
+			}
+
+			switch envValue.Kind {
+			case ENV_LITERAL:
+				file.Env[key] = envValue.Text
+
+			case ENV_DEFAULT:
+				file.Env[key] = os.Getenv(key)
+				if file.Env[key] == "" {
+					file.Env[key] = envValue.Text
 				}
 
-				cmd := value[2 : len(value)-1]
+			case ENV_COMMAND:
+				envCmd := envValue.Command
+				cmd := envCmd.Command
 				out, err := exec.Command("bash", "-c", cmd).Output()
 				if err != nil {
 					failed = true
 					UxPrintError(fmt.Errorf("Unable to execute '%s': %s", cmd, err.Error()))
 				}
 
-				file.Env[key] = strings.TrimRight(string(out), "\n\r\t ")
+				file.Env[key], err = envCmd.Filter(strings.TrimRight(string(out), "\n\r\t "))
+				if err != nil {
+					failed = true
+					UxPrintError(fmt.Errorf("Unable to filter the value of %s: %s", key, err.Error()))
+				}
 
-			} else if value == "<" {
-				if os.Getenv(key) == "" {
+			case ENV_REQUIRED:
+				secrets[key] = true
+				file.Env[key] = os.Getenv(key)
+				if file.Env[key] == "" && *fPromptSecrets && IsTerminal(os.Stdin.Fd()) {
+					file.Env[key], err = UxReadSecret(fmt.Sprintf("Enter value for %s: ", key))
+					if err != nil {
+						UxPrintError(fmt.Errorf("Could not read %s: %s", key, err.Error()))
+					}
+				}
+				if file.Env[key] == "" {
 					failed = true
 					UxPrintError(fmt.Errorf("Missing required %s environment variable", key))
 				}
@@ -95,22 +557,85 @@ func main() {
 		}
 	}
 	if failed {
-		os.Exit(1)
+		Exit(EXIT_ENVIRONMENT_ERROR)
+	}
+
+	// Give the resolved variables of the first checklist file to the other
+	// files, as defaults of their own variables
+	if sharedEnvFile != nil {
+		for _, file := range checklistFiles {
+			if file == sharedEnvFile {
+				continue
+			}
+			if file.Env == nil {
+				file.Env = make(map[string]string)
+			}
+			for key, value := range sharedEnvFile.Env {
+				if _, ok := file.Env[key]; !ok {
+					file.Env[key] = value
+				}
+			}
+		}
 	}
 
 	// If we have runbook items in the checklist append it now
+	var stepInfos [][2]string
 	for _, list := range checklistFiles {
+		augmented := make(map[string]bool)
 		if len(list.RunbookSteps) > 0 {
-			for _, step := range list.RunbookSteps {
-				checklist, err := runbook.ChecklistFromRunbook(step)
+			for _, ref := range list.RunbookSteps {
+				step, params, err := ParseRunbookStepRef(ref)
 				if err != nil {
-					UxPrintError(fmt.Errorf("Could not fetch checklist for step %s: %s", step, err.Error()))
-					os.Exit(1)
+					UxPrintError(err)
+					Exit(EXIT_CONFIG_ERROR)
+				}
+				checklist, err := runbook.ChecklistFromRunbook(step, params)
+				if err != nil {
+					UxPrintError(fmt.Errorf("Could not fetch checklist for step %s: %s", ref, err.Error()))
+					Exit(EXIT_ENVIRONMENT_ERROR)
 				}
 
+				AugmentRunbookItems(list, checklist, augmented)
 				list.Checklist = append(list.Checklist, checklist...)
+
+				// The step metadata is only informative
+				info, err := runbook.StepInfo(step)
+				if err != nil {
+					UxPrintWarning(fmt.Errorf("Could not fetch the metadata of step %s: %s", step, err.Error()))
+				} else if info != nil {
+					stepInfos = append(stepInfos, [2]string{step, info.String()})
+					fMeta["runbook_step."+step] = info.String()
+					if list.Title == RUNBOOK_CHECKLIST_TITLE && len(list.RunbookSteps) == 1 {
+						list.Title = info.Name
+					}
+				}
 			}
 		}
+		for _, warning := range UnusedRunbookAugmentations(list, augmented) {
+			UxPrintWarning(warning)
+		}
+	}
+
+	// Check if we should just list the graph of the items and exit
+	if *fListGraph {
+		var items []ChecklistItem
+		for _, list := range checklistFiles {
+			items = append(items, list.Checklist...)
+		}
+		graph := CreateItemGraph(items)
+		switch *fGraphFormat {
+		case "text":
+			UxPrintItemGraph(graph)
+		case "dot":
+			fmt.Print(graph.Dot())
+		default:
+			UxPrintError(fmt.Errorf("Invalid -graph-format %s, expecting text or dot", *fGraphFormat))
+			Exit(EXIT_CONFIG_ERROR)
+		}
+		if len(graph.Cycles()) > 0 || len(graph.UnknownRefs()) > 0 {
+			Exit(EXIT_CONFIG_ERROR)
+		}
+		Exit(EXIT_SUCCESS)
 	}
 
 	// Check if we should just list and exit
@@ -121,28 +646,89 @@ func main() {
 			for _, item := range list.Checklist {
 				i += 1
 				fmt.Printf(" %2d. %s\n", i, item.Title)
+				if *fVerbose {
+					UxListItemDetails(&item, list, secrets)
+				}
 			}
 			fmt.Println()
 		}
 		fmt.Printf("%d items in total\n", i)
-		os.Exit(0)
+		if toolsMissing {
+			Exit(EXIT_MISSING_TOOLS)
+		}
+		Exit(EXIT_SUCCESS)
+	}
+
+	// Check if we should just explain an item and exit
+	if *fExplainItem != 0 {
+		i := 0
+		for _, list := range checklistFiles {
+			for _, item := range list.Checklist {
+				i += 1
+				if i == *fExplainItem {
+					UxExplainItem(i, &item, list)
+					Exit(EXIT_SUCCESS)
+				}
+			}
+		}
+		UxPrintError(fmt.Errorf("There is no item %d, expecting a number between 1 and %d", *fExplainItem, i))
+		Exit(EXIT_CONFIG_ERROR)
 	}
 
 	// Prepare configuration
 	config, err := CreateConfig()
 	if err != nil {
 		UxPrintError(err)
-		return
+		Exit(EXIT_ENVIRONMENT_ERROR)
 	}
 	if *fTempDir != "" {
 		config.UserTempDir = *fTempDir
 	}
+	config.ScriptArgs = scriptArgs
+	config.IsolateEnv = *fIsolateEnv
+	config.ResultCacheDir = *fCacheDir
+	config.SudoCommand = *fSudo
+	config.RunID = runID
+	config.UpdateGolden = *fUpdateGolden
+	if *fMaxOutput != "" {
+		config.MaxOutput, err = ParseSize(*fMaxOutput)
+		if err != nil {
+			UxPrintError(fmt.Errorf("Invalid -max-output: %s", err.Error()))
+			Exit(EXIT_CONFIG_ERROR)
+		}
+	}
+	for name, value := range map[string]string{"-timeout": *fTimeout, "-retry-delay": *fRetryDelay} {
+		if err = ValidateDuration(value); err != nil {
+			UxPrintError(fmt.Errorf("Invalid %s: %s", name, err.Error()))
+			Exit(EXIT_CONFIG_ERROR)
+		}
+	}
+	config.DefaultTimeout = *fTimeout
+	config.DefaultRetries = *fRetries
+	config.DefaultRetryDelay = *fRetryDelay
 	for _, checklist := range checklistFiles {
 		err = config.AddChecklistFile(checklist)
 		if err != nil {
 			UxPrintError(err)
-			return
+			Exit(EXIT_CONFIG_ERROR)
+		}
+	}
+
+	if *fExportScript != "" {
+		var items []ChecklistItem
+		for _, list := range checklistFiles {
+			items = append(items, list.Checklist...)
+		}
+		if !*fExportSecrets {
+			secrets = nil
+		}
+		err = WriteExportScript(*fExportScript, items, config, secrets)
+		if err != nil {
+			UxPrintError(err)
+			Exit(EXIT_ENVIRONMENT_ERROR)
 		}
+		fmt.Printf("The checks were exported to %s\n", *fExportScript)
+		Exit(EXIT_SUCCESS)
 	}
 
 	// Create the runner component that executes scripts in a well-prepared
@@ -150,23 +736,28 @@ func main() {
 	runner, err := CreateRunner(config)
 	if err != nil {
 		UxPrintError(err)
-		return
+		Exit(EXIT_ENVIRONMENT_ERROR)
 	}
 
 	// Check if all the required utilities exst
 	missing := runner.GetMissingTools()
 	if len(missing) > 0 {
-		UxPrintError(fmt.Errorf("There are missing executables from your path:"))
-		for _, name := range missing {
-			fmt.Printf(" ‣ Did not find '%s'\n", name)
-		}
-		return
+		UxPrintMissingTools(missing)
+		Exit(EXIT_MISSING_TOOLS)
 	}
 
-	fmt.Println("==========================================")
-	fmt.Printf(" %s Pre-Flight Checklist\n", checklistFiles[0].Title)
-	fmt.Println("==========================================")
-	fmt.Println()
+	if *fStrictEnv {
+		var undefined []error
+		for _, list := range checklistFiles {
+			undefined = append(undefined, runner.CheckStrictEnv(list)...)
+		}
+		for _, err := range undefined {
+			UxPrintError(err)
+		}
+		if len(undefined) > 0 {
+			Exit(EXIT_ENVIRONMENT_ERROR)
+		}
+	}
 
 	var allItems []ChecklistItem
 	for _, list := range checklistFiles {
@@ -175,65 +766,1165 @@ func main() {
 		}
 	}
 
-	failure := false
-	for _, item := range allItems[:*fSkipPtr] {
-		UxBlankItem(&item)
+	if *fUseOrder != "" {
+		var warnings []error
+		allItems, warnings, err = ApplyOrder(*fUseOrder, allItems)
+		if err != nil {
+			UxPrintError(err)
+			Exit(EXIT_CONFIG_ERROR)
+		}
+		for _, warning := range warnings {
+			UxPrintWarning(warning)
+		}
+	} else if *fShuffle {
+		seed := *fSeed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		ShuffleItems(allItems, seed)
+		fmt.Printf("Shuffled the items with -seed %d\n", seed)
+	}
+	if *fReverse {
+		ReverseItems(allItems)
+	}
+	if *fSaveOrder != "" {
+		err = SaveOrder(*fSaveOrder, allItems)
+		if err != nil {
+			UxPrintError(err)
+			Exit(EXIT_ENVIRONMENT_ERROR)
+		}
+	}
+
+	if len(allItems) == 0 {
+		fmt.Println("There are no items to run")
+		if *fFailOnEmpty {
+			Exit(EXIT_CHECKS_FAILED)
+		}
+		Exit(EXIT_SUCCESS)
 	}
+
+	if *fSkipPtr < 0 || *fSkipPtr > len(allItems) {
+		UxPrintError(fmt.Errorf("Cannot skip %d items, expecting a number between 0 and %d", *fSkipPtr, len(allItems)))
+		Exit(EXIT_CONFIG_ERROR)
+	}
+
+	err = ValidateItemConditions(allItems)
+	if err != nil {
+		if *fReverse {
+			err = fmt.Errorf("Cannot run the items in reverse order: %s", err.Error())
+		}
+		UxPrintError(err)
+		Exit(EXIT_CONFIG_ERROR)
+	}
+
 	for _, item := range allItems[*fSkipPtr:] {
-		if failure {
-			UxSkipItem(&item, "ABORTED")
-		} else {
+		if item.Privileged {
+			err = runner.CheckPrivileges(!*fAutoPtr && IsTerminal(os.Stdin.Fd()))
+			if err != nil {
+				UxPrintError(err)
+				Exit(EXIT_ENVIRONMENT_ERROR)
+			}
+			break
+		}
+	}
 
-			if *fAutoPtr {
-				// Perform passive checks if we are running in auto mode
-				if !CanCheckItem(&item) {
-					UxSkipItem(&item, "NO CHECKS")
-				} else {
-					value, serr, ok, err := RunItemCheck(&item, runner)
-					if err != nil {
-						UxFailItem(&item, err.Error(), serr)
-						failure = true
-					} else if !ok {
-						UxFailItem(&item, value, serr)
-						failure = true
-					} else {
-						UxPassItem(&item, value)
-					}
-				}
+	var selected, inShard []bool
+	if shard != nil {
+		inShard, err = shard.Pick(allItems, *fShardBy == "title")
+		if err != nil {
+			UxPrintError(err)
+			Exit(EXIT_CONFIG_ERROR)
+		}
+		selected = append([]bool{}, inShard...)
+	}
+	if *fSelect {
+		chosen := UxSelectItems(allItems)
+		for i := range chosen {
+			chosen[i] = chosen[i] && (selected == nil || selected[i])
+		}
+		selected = chosen
+	}
+	if *fSample > 0 {
+		seed := *fSampleSeed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		sampled := SampleItems(allItems[*fSkipPtr:], *fSample, seed, *fSampleWeighted)
+		if selected == nil {
+			selected = make([]bool, len(allItems))
+			for i := range selected {
+				selected[i] = true
+			}
+		}
+		count := 0
+		fmt.Printf("Sampled the items with -sample-seed %d:\n", seed)
+		for i, ok := range sampled {
+			selected[*fSkipPtr+i] = selected[*fSkipPtr+i] && ok
+			if ok {
+				count += 1
+				fmt.Printf(" %2d. %s\n", *fSkipPtr+i+1, allItems[*fSkipPtr+i].Title)
+			}
+		}
+		fmt.Printf("%d of %d items sampled\n\n", count, len(sampled))
+	}
 
-			} else {
-				// Otherwise go through the UI
-				ok, result := UxCheckItem(&item, runner)
-				if !ok {
-					failure = true
-					if item.RunbookID != "" {
-						reason := "Script failed with:\n```\n" + result.Stdout + "\n---\n" + result.Stderr + "\n```\n"
-						runbook.ChecklistItemUpdate(
-							item.RunbookStep,
-							item.RunbookID,
-							2, // Failed
-							reason,
-						)
-					}
-				} else {
-					runbook.ChecklistItemUpdate(
-						item.RunbookStep,
-						item.RunbookID,
-						1, // Completed
-						"",
-					)
-				}
+	if *fPreview {
+		var items []ChecklistItem
+		for i, item := range allItems[*fSkipPtr:] {
+			if selected == nil || selected[*fSkipPtr+i] {
+				items = append(items, item)
 			}
 		}
+		target := [][2]string{{"Cluster", config.Env["DCOS_URL"]}}
+		if envSet != "" {
+			target = append(target, [2]string{"Env set", envSet})
+		}
+		if *fEnvName != "" {
+			target = append(target, [2]string{"Environment", *fEnvName})
+		}
+		// The prompt tells how the checks are going to run
+		mode := "interactively"
+		switch {
+		case *fAutoPtr && (*fInteractiveOnFailure || *fAuthorMode) && IsTerminal(os.Stdin.Fd()):
+			mode = "unattended, prompting at the failures"
+		case *fAutoPtr:
+			mode = "unattended"
+		case *fConfirmAll:
+			mode = "interactively, confirming all the prompts"
+		case *fConfirmNone:
+			mode = "interactively, declining all the prompts"
+		}
+		if *fJobs > 1 {
+			mode += fmt.Sprintf(", up to %d at once", *fJobs)
+		}
+		if !UxPreviewRun(items, target, mode, *fYes) {
+			Exit(EXIT_CHECKS_FAILED)
+		}
 	}
 
-	if failure {
-		fmt.Println()
-		fmt.Println("🚨 ", Bold(Red("There was a failed item. You are not clear to continue")))
-		os.Exit(1)
-	} else {
-		fmt.Println()
-		fmt.Println("🍺 ", Bold("All checks are passing. You are clear to continue"))
-		os.Exit(0)
+	// Discard all the output of the run until the summary
+	stdout := os.Stdout
+	if *fSummaryOnly {
+		os.Stdout, err = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		if err != nil {
+			UxPrintError(fmt.Errorf("Could not open %s: %s", os.DevNull, err.Error()))
+			Exit(EXIT_ENVIRONMENT_ERROR)
+		}
+	}
+
+	fmt.Println("==========================================")
+	runTitle := checklistFiles[0].Title
+	if *fTitle != "" {
+		runTitle = *fTitle
+	}
+	fmt.Printf(" %s Pre-Flight Checklist\n", runTitle)
+	fmt.Println("==========================================")
+	// The header always has the run ID, so it is always closed
+	UxPrintHeaderValue("Run ID", runID)
+	if envSet != "" {
+		UxPrintHeaderValue("Env set", envSet)
+	}
+	if *fEnvName != "" {
+		UxPrintHeaderValue("Environment", *fEnvName)
+	}
+	if shard != nil {
+		UxPrintHeaderValue("Shard", shard.String())
+	}
+	for _, info := range stepInfos {
+		UxPrintHeaderValue("Runbook step "+info[0], info[1])
+	}
+	for _, file := range checklistFiles {
+		if len(file.Variants) > 0 {
+			variant := file.SelectedVariant
+			if variant == "" {
+				variant = "none"
+			}
+			UxPrintHeaderValue("Variant", fmt.Sprintf("%s (%s)", variant, file.VariantVar))
+		}
+		if *fVerbose {
+			for _, pair := range file.MetaPairs() {
+				UxPrintHeaderValue(pair[0], pair[1])
+			}
+		}
+		for _, cmd := range file.HeaderCommands {
+			sout, _, err := runner.Run(cmd)
+			if err != nil {
+				UxPrintWarning(fmt.Errorf("Header command '%s' failed: %s", cmd, err.Error()))
+				continue
+			}
+			UxPrintHeaderValue(cmd, strings.TrimSpace(sout))
+		}
 	}
+	fmt.Println("==========================================")
+	fmt.Println()
+
+	var baseline Baseline = nil
+	if *fCompareBaseline != "" {
+		baseline, err = LoadBaseline(*fCompareBaseline)
+		if err != nil {
+			UxPrintError(err)
+			Exit(EXIT_CONFIG_ERROR)
+		}
+	}
+
+	failure := false
+	summary := CreateRunSummary()
+	summary.Meta = fMeta
+	summary.Budget = *fBudget
+	summary.MaxFailures = *fMaxFailures
+	summary.UnknownAs = *fUnknownAs
+	budgetExceeded := false
+	compact := *fCompact && *fAutoPtr
+	interactiveOnFailure := (*fInteractiveOnFailure || *fAuthorMode) && *fAutoPtr && IsTerminal(os.Stdin.Fd())
+	if compact {
+		UxSetCompact(true)
+	}
+	if *fAllowShell && IsTerminal(os.Stdin.Fd()) {
+		UxSetShellAllowed(true)
+	}
+	UxSetAutoFix(*fAutoFix)
+	if *fConfirmAll {
+		UxSetConfirmAnswer("y")
+	} else if *fConfirmNone {
+		UxSetConfirmAnswer("n")
+	}
+	// Capture the state of the environment before running anything
+	for _, file := range checklistFiles {
+		snapshot, err := TakeSnapshot(file, runner)
+		if err != nil {
+			UxPrintError(err)
+			Exit(EXIT_ENVIRONMENT_ERROR)
+		}
+		if snapshot != nil {
+			summary.Snapshots = append(summary.Snapshots, snapshot)
+		}
+	}
+
+	var stream *EventStream
+	if *fStreamEndpoint != "" {
+		stream = CreateEventStream(*fStreamEndpoint)
+		stream.Send("run_start", map[string]interface{}{"title": runTitle, "meta": summary.Meta})
+	}
+	// With dependencies, a failure only skips the items that depend on it
+	useDependencies := HasItemDependencies(allItems)
+	failedChains := make(map[string][]string)
+	// Updates the runbook item linked to the item, if any
+	updateRunbookItem := func(item *ChecklistItem, status int, reason string) {
+		if err := UpdateRunbookItem(runbook, item, status, reason); err != nil {
+			UxPrintWarning(err)
+		}
+	}
+	// Shows the item as in progress in the runbook while it runs, unless
+	// the runbook has no such status
+	markRunbookItemInProgress := func(item *ChecklistItem) {
+		if runbookCodes.InProgress != RUNBOOK_STATUS_UNREPORTED {
+			updateRunbookItem(item, runbookCodes.InProgress, summary.MetaText())
+		}
+	}
+	// Reports the final status of the item to the runbook, with the reason
+	// of the failure when it failed
+	reportRunbookItem := func(item *ChecklistItem, status int, stdout string, stderr string) {
+		if item.RunbookID == "" {
+			return
+		}
+		reason := summary.MetaText()
+		if status == runbookCodes.Failed {
+			var err error
+			if reason, err = RunbookFailureReason(item, stdout, stderr, summary); err != nil {
+				UxPrintWarning(err)
+			}
+			reason = redactor.Redact(reason)
+		}
+		updateRunbookItem(item, status, reason)
+		runbookState.Set(item.RunbookStep, item.RunbookID, status)
+	}
+
+	record := func(result *ItemResult) {
+		redactor.RedactResult(result)
+		summary.Record(result)
+		runner.SetItemStatus(&result.Item, result.Status)
+		if result.Status == STATUS_FAIL {
+			for _, ref := range result.Item.Refs() {
+				failedChains[ref] = []string{result.Item.Title}
+			}
+		}
+		if stream != nil {
+			stream.SendItemResult(len(summary.Results), result)
+		}
+		if compact {
+			UxCompactResult(len(summary.Results), result)
+		}
+		if *fGithubOutput {
+			PrintGithubResult(len(summary.Results), result)
+		}
+		UxClockItemsDone(len(summary.Results))
+	}
+
+	if !*fAutoPtr && !*fNoClock && IsTerminal(os.Stdout.Fd()) {
+		UxStartClock(len(allItems))
+	}
+	totalWeight, doneWeight, itemsRun := 0, 0, 0
+	for _, item := range allItems {
+		totalWeight += item.GetWeight()
+	}
+	for _, item := range allItems[:*fSkipPtr] {
+		doneWeight += item.GetWeight()
+		UxBlankItem(&item)
+		record(&ItemResult{Item: item, Status: STATUS_SKIP, Blank: true})
+	}
+
+	// Run the passive checks in the background, ahead of their turn
+	stopPrefetch := func() {}
+	if *fJobs > 1 {
+		var prefetched []*ChecklistItem
+		for i := *fSkipPtr; i < len(allItems); i++ {
+			item := &allItems[i]
+			if (selected == nil || selected[i]) && CanPrefetchItemCheck(item, runner) && IsItemApplicable(item, runner) {
+				prefetched = append(prefetched, item)
+			}
+		}
+		stopPrefetch = PrefetchItemChecks(prefetched, runner, *fJobs)
+	}
+	for i, item := range allItems[*fSkipPtr:] {
+		if selected != nil && !selected[*fSkipPtr+i] {
+			reason := "NOT SELECTED"
+			if *fSample > 0 {
+				reason = "NOT SAMPLED"
+			}
+			if shard != nil && !inShard[*fSkipPtr+i] {
+				reason = "OTHER SHARD"
+			}
+			UxSkipItem(&item, reason)
+			record(&ItemResult{Item: item, Status: STATUS_SKIP, Value: reason})
+			continue
+		}
+		if failure && !useDependencies && !*fKeepGoing {
+			stopPrefetch()
+			UxSkipItem(&item, "ABORTED")
+			record(&ItemResult{Item: item, Status: STATUS_SKIP, Value: "ABORTED"})
+			continue
+		}
+		if summary.ReachedMaxFailures() {
+			stopPrefetch()
+			summary.StoppedEarly = true
+			UxSkipItem(&item, "ABORTED")
+			record(&ItemResult{Item: item, Status: STATUS_SKIP, Value: "ABORTED"})
+			continue
+		}
+		if chain := item.FailedDependency(failedChains); chain != nil {
+			reason := fmt.Sprintf("DEPENDENCY FAILED (%s)", strings.Join(chain, " → "))
+			UxSkipItem(&item, reason)
+			record(&ItemResult{Item: item, Status: STATUS_SKIP, Value: reason})
+			for _, ref := range item.Refs() {
+				failedChains[ref] = append(append([]string{}, chain...), item.Title)
+			}
+			continue
+		}
+		if reason := item.ConditionSkipReason(summary.Statuses); reason != "" {
+			UxSkipItem(&item, reason)
+			record(&ItemResult{Item: item, Status: STATUS_SKIP, Value: reason})
+			continue
+		}
+		if !IsItemApplicable(&item, runner) {
+			UxSkipItem(&item, "NOT APPLICABLE")
+			record(&ItemResult{Item: item, Status: STATUS_SKIP, Value: "NOT APPLICABLE"})
+			continue
+		}
+		if runbook != nil && item.RunbookID != "" && (!*fRerunCompleted || lastRunbookState != nil) {
+			status, err := runbook.ChecklistItemStatus(item.RunbookStep, item.RunbookID)
+			if err != nil {
+				UxPrintWarning(fmt.Errorf("Could not get the runbook status of %s: %s", item.Title, err.Error()))
+			} else {
+				runbookState.Set(item.RunbookStep, item.RunbookID, status)
+				if status == runbookCodes.Completed && !*fRerunCompleted {
+					UxSkipItem(&item, "ALREADY DONE")
+					record(&ItemResult{Item: item, Status: STATUS_SKIP, Value: "ALREADY DONE"})
+					continue
+				}
+				if lastRunbookState != nil && !lastRunbookState.Changed(item.RunbookStep, item.RunbookID, status) {
+					UxSkipItem(&item, "UNCHANGED")
+					record(&ItemResult{Item: item, Status: STATUS_SKIP, Value: "UNCHANGED"})
+					continue
+				}
+			}
+		}
+
+		if budgetExceeded = budgetExceeded || summary.ExceedsBudget(item.Cost); budgetExceeded {
+			UxSkipItem(&item, "BUDGET EXCEEDED")
+			record(&ItemResult{Item: item, Status: STATUS_SKIP, Value: "BUDGET EXCEEDED"})
+			continue
+		}
+		summary.Cost += item.Cost
+
+		UxSetProgress(doneWeight * 100 / totalWeight)
+		doneWeight += item.GetWeight()
+
+		// Wait between the items that run, before the start of the next one
+		if *fItemDelay > 0 && itemsRun > 0 {
+			time.Sleep(*fItemDelay)
+		}
+		itemsRun += 1
+
+		if stream != nil {
+			stream.SendItemStart(len(summary.Results)+1, &item)
+		}
+		UxStartHeartbeat(&item, *fHeartbeat)
+		result := &ItemResult{Item: item}
+		started := time.Now()
+		var checkDuration time.Duration
+		if *fAutoPtr {
+			// Perform passive checks if we are running in auto mode
+			if IsTerminal(os.Stdout.Fd()) && !compact {
+				UxItemProgress(&item)
+			}
+			if !CanCheckItem(&item) {
+				UxSkipItem(&item, "NO CHECKS")
+				result.Status = STATUS_SKIP
+				result.Value = "NO CHECKS"
+			} else if value, expires, ok := LoadCachedResult(&item, runner); ok {
+				value += fmt.Sprintf(" (cached, expires in %s)", time.Until(expires).Round(time.Minute))
+				UxPassItem(&item, value)
+				result.Status = STATUS_PASS
+				result.Value = value
+				reportRunbookItem(&item, runbookCodes.Completed, value, "")
+			} else {
+				markRunbookItemInProgress(&item)
+				for {
+					cached := IsItemCheckCached(&item, runner)
+					value, serr, ok, err := RunItemCheck(&item, runner)
+					if !cached && *fJobs > 1 {
+						checkDuration = ItemCheckDuration(&item, runner)
+					}
+					if (err != nil || !ok) && !IsUnknownOutcome(err) && item.Fix != "" && *fAutoFix && !result.FixApplied {
+						result.FixApplied = true
+						if out, ferr := RunItemFix(&item, runner); ferr != nil {
+							UxPrintWarning(fmt.Errorf("The fix of %s failed: %s", item.Title, ferr.Error()))
+							serr += "\n--- fix ---\n" + out
+						} else {
+							ForgetItemCheck(&item, runner)
+							cached = false
+							value, serr, ok, err = RunItemCheck(&item, runner)
+						}
+					}
+					if out, herr := RunItemAfterEach(&item, runner); herr != nil {
+						if err == nil && ok {
+							err = herr
+						}
+						ok = false
+						serr += out
+					}
+					if baseline != nil && err == nil && ok {
+						if same, diff := baseline.Compare(&item, value); !same {
+							err = fmt.Errorf("Output differs from baseline")
+							ok = false
+							serr += "\n--- baseline difference ---\n" + diff
+						}
+					}
+					result.Stdout = value
+					result.Stderr = serr
+					if err != nil {
+						value = err.Error()
+					}
+					if cached {
+						value += " (cached)"
+					}
+					if result.FixApplied && err == nil && ok {
+						value += " (fixed)"
+					}
+					result.Value = value
+					if IsUnknownOutcome(err) {
+						// Not knowing is not a failure of what is checked,
+						// unless the policy says so
+						result.Unknown = true
+						result.Status = *fUnknownAs
+						UxUnknownItem(&item, value, serr, *fUnknownAs)
+						if result.Status == STATUS_FAIL && !item.ToleratesFailure() {
+							failure = true
+						}
+					} else if err != nil || !ok {
+						result.Status = STATUS_FAIL
+						if item.ToleratesFailure() {
+							UxAllowedFailItem(&item, value, serr)
+						} else {
+							UxFailItem(&item, value, serr)
+						}
+						// The author mode also stops at the allowed failures
+						if !item.ToleratesFailure() || *fAuthorMode {
+							// Only this item is retried or skipped, the
+							// earlier failures of the run still count
+							answer := ""
+							if interactiveOnFailure {
+								answer = UxFailurePrompt(&item, runner)
+							}
+							switch answer {
+							case "retry":
+								ForgetItemCheck(&item, runner)
+								started = time.Now()
+								continue
+							case "skip":
+								result.Status = STATUS_SKIP
+								result.Value = "SKIPPED AFTER FAILURE"
+							default:
+								failure = true
+							}
+						}
+					} else {
+						UxPassItem(&item, value)
+						result.Status = STATUS_PASS
+						if err := StoreCachedResult(&item, runner, result.Stdout); err != nil {
+							UxPrintWarning(err)
+						}
+					}
+					break
+				}
+				status := runbookCodes.SkippedCode()
+				switch result.Status {
+				case STATUS_FAIL:
+					status = runbookCodes.Failed
+				case STATUS_PASS:
+					status = runbookCodes.Completed
+				}
+				// The unknown outcomes are reported too, so that the item
+				// does not stay in progress
+				if result.Unknown {
+					status = runbookCodes.UnknownCode(status)
+				}
+				reportRunbookItem(&item, status, result.Stdout, result.Stderr)
+			}
+
+		} else {
+			// Otherwise go through the UI
+			markRunbookItemInProgress(&item)
+			ok, res := UxCheckItem(&item, runner)
+			if ok && !res.Skipped {
+				if out, herr := RunItemAfterEach(&item, runner); herr != nil {
+					UxFailAfterEach(&item, herr.Error(), out)
+					ok = false
+					res.Stderr += out
+				} else if baseline != nil {
+					if same, diff := baseline.Compare(&item, res.Stdout); !same {
+						UxFailBaseline(&item, diff)
+						ok = false
+						res.Stderr += "\n--- baseline difference ---\n" + diff
+					}
+				}
+			}
+			result.Stdout = res.Stdout
+			result.Stderr = res.Stderr
+			result.Value = res.Stdout
+			result.FixApplied = res.FixApplied
+			if !ok {
+				if !item.ToleratesFailure() {
+					failure = true
+				}
+				result.Status = STATUS_FAIL
+				reportRunbookItem(&item, runbookCodes.Failed, res.Stdout, res.Stderr)
+			} else {
+				status := runbookCodes.Completed
+				if res.Skipped {
+					result.Status = STATUS_SKIP
+					status = runbookCodes.SkippedCode()
+				} else {
+					result.Status = STATUS_PASS
+				}
+				reportRunbookItem(&item, status, res.Stdout, res.Stderr)
+			}
+		}
+		UxStopHeartbeat()
+		if result.SubResults = ItemSubResults(&item, runner); len(result.SubResults) > 0 {
+			UxPrintSubResults(result.SubResults)
+		}
+		result.Duration = time.Since(started)
+		if checkDuration > result.Duration {
+			// The check ran in the background, before the run reached it
+			result.Duration = checkDuration
+		}
+		result.FixResolved = result.FixApplied && result.Status == STATUS_PASS
+		if *fIncludeEnv && result.Status == STATUS_FAIL {
+			result.Env = runner.ItemEnvironment(&item, secrets)
+		}
+		if err := RunItemHook(&item, runner, result); err != nil {
+			UxPrintWarning(err)
+		}
+		record(result)
+	}
+	stopPrefetch()
+
+	UxStopClock()
+	if useDependencies && summary.Failed+summary.HiddenFailed > 0 {
+		failure = true
+	}
+	// A failed verification fails the run, even if all the items passed
+	for _, snapshot := range summary.Snapshots {
+		if err := snapshot.Verify(runner); err != nil {
+			UxPrintError(err)
+			if snapshot.VerifyOutput != "" {
+				fmt.Println(snapshot.VerifyOutput)
+			}
+			failure = true
+		}
+	}
+	if *fStrictXPass && summary.XPassed > 0 {
+		summary.XPassStrict = true
+		failure = true
+	}
+	if *fFailOnWarning && summary.Warnings > 0 {
+		summary.WarningsEscalated = true
+		failure = true
+	}
+
+	if *fSummaryOnly {
+		os.Stdout.Close()
+		os.Stdout = stdout
+	} else {
+		fmt.Println()
+	}
+	UxPrintSummary(summary, *fSortSummary)
+	if *fKeepGoing {
+		UxPrintFailedItems(summary)
+	}
+	if *fExplainFailures {
+		UxPrintFailureAnalysis(summary.FailureGroups())
+	}
+
+	if stream != nil {
+		stream.SendRunComplete(runTitle, summary, failure)
+		if err := stream.Close(30 * time.Second); err != nil {
+			UxPrintWarning(err)
+		}
+	}
+	if runbook != nil && len(runbookState.Statuses) > 0 {
+		if err := runbookState.Save(runbookStateDir); err != nil {
+			UxPrintWarning(err)
+		} else if err := PruneRunbookStates(runbookStateDir, *fRunbookStateKeep); err != nil {
+			UxPrintWarning(err)
+		}
+	}
+	if *fSaveBaseline != "" {
+		err = CreateBaseline(summary).Save(*fSaveBaseline)
+		if err != nil {
+			UxPrintError(err)
+		}
+	}
+	if *fHtmlReport != "" {
+		err = WriteHTMLReport(*fHtmlReport, runTitle, checklistFiles, summary)
+		if err != nil {
+			UxPrintError(err)
+		}
+	}
+
+	if *fRemediationScript != "" {
+		written, err := WriteRemediationScript(*fRemediationScript, summary)
+		if err != nil {
+			UxPrintError(err)
+		} else if written {
+			fmt.Printf("The remediation commands were written to %s\n", *fRemediationScript)
+		}
+	}
+	if *fLogDir != "" {
+		err = WriteItemLogs(*fLogDir, summary)
+		if err != nil {
+			UxPrintError(err)
+		}
+	}
+
+	if *fOutputDir != "" {
+		err = writeOutputDir(*fOutputDir, runTitle, checklistFiles, summary, failure, *fLogDir != "")
+		if err != nil {
+			UxPrintError(err)
+		}
+	}
+
+	if resultsFile := os.Getenv("PREFLIGHTER_RESULTS_FILE"); resultsFile != "" {
+		err = WriteJSONReport(resultsFile, runTitle, summary, failure)
+		if err != nil {
+			UxPrintError(err)
+		}
+	}
+
+	runner.Cleanup()
+	printStatusLine := func(failure bool) {
+		if *fStatusLine {
+			fmt.Fprintln(os.Stderr, summary.StatusLine(failure))
+		}
+	}
+	if *fFormat == "json" {
+		if err := PrintJSONResults(resultsOut, summary); err != nil {
+			UxPrintError(err)
+		}
+	}
+	if !failure && *fAck && !UxConfirmContinue() {
+		printStatusLine(true)
+		Exit(EXIT_CHECKS_FAILED)
+	}
+	UxPrintOutcome(failure)
+	printStatusLine(failure)
+	if failure {
+		Exit(EXIT_CHECKS_FAILED)
+	} else {
+		Exit(EXIT_SUCCESS)
+	}
+}
+
+/**
+ * Expands the glob patterns and the directories in the checklist file
+ * arguments, and fetches the checklists in git repositories
+ */
+func expandArguments(args []string, gitCacheDir string, recursive bool) ([]string, error) {
+	var expanded []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "runbook:") {
+			expanded = append(expanded, arg)
+			continue
+		}
+		original := arg
+		arg, err := expandArgumentVars(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.HasPrefix(arg, GIT_CHECKLIST_PREFIX) {
+			ref, err := ParseGitChecklistRef(arg)
+			if err != nil {
+				return nil, err
+			}
+			filename, err := FetchGitChecklist(ref, gitCacheDir)
+			if err != nil {
+				return nil, err
+			}
+			expanded = append(expanded, filename)
+			continue
+		}
+		if info, err := os.Stat(arg); err == nil && info.IsDir() {
+			files, err := directoryChecklists(arg, recursive)
+			if err != nil {
+				return nil, err
+			}
+			expanded = append(expanded, files...)
+			continue
+		}
+		if !strings.ContainsAny(arg, "*?[") {
+			if _, err := os.Stat(arg); err != nil && arg != original {
+				return nil, fmt.Errorf("Could not find checklist %s (expanded from %s): %s", arg, original, err.Error())
+			}
+			expanded = append(expanded, arg)
+			continue
+		}
+
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid pattern %s: %s", arg, err.Error())
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("No checklists match %s", arg)
+		}
+		expanded = append(expanded, matches...)
+	}
+
+	return expanded, nil
+}
+
+/**
+ * Returns the `*.yaml` and `*.yml` checklist files of the directory, sorted by
+ * name, with the ones of its subdirectories if recursive
+ */
+func directoryChecklists(dir string, recursive bool) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != dir && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not list the checklists of %s: %s", dir, err.Error())
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("No checklist files (*.yaml or *.yml) in directory %s", dir)
+	}
+	return files, nil
+}
+
+/**
+ * Expands the references to environment variables in a checklist argument,
+ * independently of the shell preflighter is run from. Referencing an
+ * undefined variable is an error.
+ */
+func expandArgumentVars(arg string) (string, error) {
+	var missing []string
+	expanded := os.Expand(arg, func(name string) string {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("The checklist argument %s references the undefined variable %s", arg, strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+/**
+ * Returns the arguments of this process without the given flags (and their
+ * values), to pass them through to a nested run
+ */
+func passThroughArgs(flags ...string) []string {
+	var args []string
+	for i := 1; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		if arg == "--" {
+			args = append(args, os.Args[i:]...)
+			break
+		}
+
+		name := strings.TrimLeft(arg, "-")
+		if idx := strings.Index(name, "="); strings.HasPrefix(arg, "-") && idx >= 0 {
+			if containsFlag(flags, name[:idx]) {
+				continue
+			}
+		} else if strings.HasPrefix(arg, "-") && containsFlag(flags, name) {
+			i += 1
+			continue
+		}
+		args = append(args, arg)
+	}
+	return args
+}
+
+func containsFlag(flags []string, name string) bool {
+	for _, flag := range flags {
+		if flag == name {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * Runs this program the given number of times, waiting for the interval
+ * between the runs, and reports the stability of every item. Returns the
+ * exit code of the last failed run if any run failed, or if all of them
+ * failed when not all of the runs are required to pass.
+ */
+func runSoak(repeat int, interval time.Duration, requireAllPass bool) int {
+	args := passThroughArgs("repeat", "interval")
+	self, err := os.Executable()
+	if err != nil {
+		self = os.Args[0]
+	}
+
+	dir, err := ioutil.TempDir("", "pcheck-soak")
+	if err != nil {
+		UxPrintError(fmt.Errorf("Could not create temp dir: %s", err.Error()))
+		return EXIT_ENVIRONMENT_ERROR
+	}
+	defer os.RemoveAll(dir)
+
+	stats := CreateSoakStats()
+	code := EXIT_SUCCESS
+	for i := 1; i <= repeat; i++ {
+		if i > 1 && interval > 0 {
+			time.Sleep(interval)
+		}
+		fmt.Printf("\n>>> Run %d of %d\n\n", i, repeat)
+
+		results := filepath.Join(dir, fmt.Sprintf("run-%d.json", i))
+		cmd := exec.Command(self, args...)
+		cmd.Env = append(os.Environ(), "PREFLIGHTER_RESULTS_FILE="+results)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		err := cmd.Run()
+		if err != nil {
+			code = EXIT_CHECKS_FAILED
+			if xerr, ok := err.(*exec.ExitError); ok {
+				code = xerr.ExitCode()
+			}
+			if code != EXIT_CHECKS_FAILED {
+				// The run could not even start, so the others won't either
+				return code
+			}
+		}
+		if err := stats.AddRun(results, err != nil); err != nil {
+			UxPrintWarning(err)
+		}
+	}
+
+	fmt.Println()
+	UxPrintSoakSummary(stats)
+	if !requireAllPass && stats.FailedRuns < stats.Runs {
+		return EXIT_SUCCESS
+	}
+	return code
+}
+
+/**
+ * Runs this program once for every `name=file` env set, with the variables of
+ * the file added to the environment. Returns the exit code of the first set
+ * that failed, if any.
+ */
+func runEnvSets(sets []string) int {
+	// Pass all the other arguments through to every run
+	args := passThroughArgs("env-set")
+
+	var names []string
+	var envs [][]string
+	for _, set := range sets {
+		parts := strings.SplitN(set, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			UxPrintError(fmt.Errorf("Expecting name=file for -env-set, got '%s'", set))
+			return EXIT_CONFIG_ERROR
+		}
+		content, err := ioutil.ReadFile(parts[1])
+		if err != nil {
+			UxPrintError(fmt.Errorf("Could not read env set %s: %s", parts[0], err.Error()))
+			return EXIT_CONFIG_ERROR
+		}
+		vars, err := ParseEnvOutput(string(content))
+		if err != nil {
+			UxPrintError(fmt.Errorf("Could not parse env set %s: %s", parts[0], err.Error()))
+			return EXIT_CONFIG_ERROR
+		}
+
+		env := append(os.Environ(), "PREFLIGHTER_ENV_SET="+parts[0])
+		for key, value := range vars {
+			env = append(env, key+"="+value)
+		}
+		names = append(names, parts[0])
+		envs = append(envs, env)
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		self = os.Args[0]
+	}
+
+	code := EXIT_SUCCESS
+	failed := make([]bool, len(names))
+	for i, name := range names {
+		fmt.Printf("\n>>> Env set: %s\n\n", name)
+		cmd := exec.Command(self, args...)
+		cmd.Env = envs[i]
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			failed[i] = true
+			if code == EXIT_SUCCESS {
+				code = EXIT_CHECKS_FAILED
+				if xerr, ok := err.(*exec.ExitError); ok {
+					code = xerr.ExitCode()
+				}
+			}
+		}
+	}
+
+	fmt.Println()
+	for i, name := range names {
+		if failed[i] {
+			UxPrintHeaderValue(name, "FAILED")
+		} else {
+			UxPrintHeaderValue(name, "PASSED")
+		}
+	}
+	return code
+}
+
+/**
+ * Writes all the report formats, and the item logs if requested, to a new
+ * timestamped directory in the given one
+ */
+func writeOutputDir(dir string, title string, files []*ChecklistFile, summary *RunSummary, failure bool, withLogs bool) error {
+	dir = filepath.Join(dir, time.Now().Format("20060102-150405"))
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("Could not create output directory %s: %s", dir, err.Error())
+	}
+
+	if err = WriteJSONReport(filepath.Join(dir, "report.json"), title, summary, failure); err != nil {
+		return err
+	}
+	if err = WriteJUnitReport(filepath.Join(dir, "report.xml"), title, summary); err != nil {
+		return err
+	}
+	if err = WriteMarkdownReport(filepath.Join(dir, "report.md"), title, summary); err != nil {
+		return err
+	}
+	if err = WriteHTMLReport(filepath.Join(dir, "report.html"), title, files, summary); err != nil {
+		return err
+	}
+	if withLogs {
+		if err = WriteItemLogs(filepath.Join(dir, "logs"), summary); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("The reports were written to %s\n", dir)
+	return nil
+}
+
+/**
+ * Adds the env set name to an output path, so that the runs of every set
+ * don't overwrite each other. E.g. report.html becomes report-dev.html.
+ */
+func envSetPath(path string, envSet string) string {
+	if path == "" {
+		return ""
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + envSet + ext
+}
+
+/**
+ * Rewrites the given checklist files in their canonical form, or only lists
+ * the ones that are not if check is true. Returns the exit code.
+ */
+func formatChecklists(fnames []string, check bool) int {
+	code := EXIT_SUCCESS
+	for _, fname := range fnames {
+		if strings.HasPrefix(fname, "runbook:") {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(fname)
+		if err != nil {
+			UxPrintError(fmt.Errorf("Could not read %s: %s", fname, err.Error()))
+			return EXIT_CONFIG_ERROR
+		}
+		formatted, err := FormatChecklist(content)
+		if err != nil {
+			UxPrintError(fmt.Errorf("Could not parse %s: %s", fname, err.Error()))
+			return EXIT_CONFIG_ERROR
+		}
+		if bytes.Equal(content, formatted) {
+			continue
+		}
+
+		fmt.Println(fname)
+		if check {
+			code = EXIT_CHECKS_FAILED
+			continue
+		}
+		err = ioutil.WriteFile(fname, formatted, 0644)
+		if err != nil {
+			UxPrintError(fmt.Errorf("Could not write %s: %s", fname, err.Error()))
+			return EXIT_ENVIRONMENT_ERROR
+		}
+	}
+	return code
+}
+
+/**
+ * Writes a checklist scaffolded from the given `runbook:<step>` to the file
+ * given as argument, or to `<step>.yaml`. Returns the exit code.
+ */
+func scaffoldChecklist(ref string, args []string, fixture string, force bool) int {
+	if !strings.HasPrefix(ref, "runbook:") {
+		UxPrintError(fmt.Errorf("Invalid -scaffold %s, expecting runbook:<step>", ref))
+		return EXIT_CONFIG_ERROR
+	}
+	ref = ref[8:]
+	if len(args) > 1 {
+		UxPrintError(fmt.Errorf("The -scaffold flag expects at most one file to write"))
+		return EXIT_CONFIG_ERROR
+	}
+	filename := strings.SplitN(ref, "?", 2)[0] + ".yaml"
+	if len(args) == 1 {
+		filename = args[0]
+	}
+	if _, err := os.Stat(filename); err == nil && !force {
+		UxPrintError(fmt.Errorf("%s already exists, give -force to overwrite it", filename))
+		return EXIT_CONFIG_ERROR
+	}
+
+	var runbook Runbook
+	var err error
+	if fixture != "" {
+		runbook, err = LoadRunbookFixture(fixture)
+		if err != nil {
+			UxPrintError(fmt.Errorf("Could not use runbook fixture: %s", err.Error()))
+			return EXIT_CONFIG_ERROR
+		}
+	} else {
+		runbook, err = CreateRunbookClientWithEnvConfig()
+		if err != nil {
+			UxPrintError(fmt.Errorf("Could not use runbook: %s", err.Error()))
+			return EXIT_ENVIRONMENT_ERROR
+		}
+	}
+
+	content, count, err := ScaffoldChecklist(runbook, ref)
+	if err != nil {
+		UxPrintError(err)
+		return EXIT_ENVIRONMENT_ERROR
+	}
+	err = ioutil.WriteFile(filename, content, 0644)
+	if err != nil {
+		UxPrintError(fmt.Errorf("Could not write %s: %s", filename, err.Error()))
+		return EXIT_ENVIRONMENT_ERROR
+	}
+	fmt.Printf("Wrote %d items of step %s to %s\n", count, ref, filename)
+	return EXIT_SUCCESS
+}
+
+/**
+ * Statically validates the given checklist files and reports all the
+ * problems found. Returns true if there were no problems.
+ */
+func validateChecklists(fnames []string, maxAge time.Duration) bool {
+	var problems []error
+	var allItems []ChecklistItem
+	count := 0
+	for _, fname := range fnames {
+		if strings.HasPrefix(fname, "runbook:") {
+			if len(fname) == 8 {
+				problems = append(problems, fmt.Errorf("%s: Missing runbook step", fname))
+			}
+			count += 1
+			continue
+		}
+
+		checklists, err := LoadChecklist(fname)
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+
+		count += len(checklists)
+		for _, checklist := range checklists {
+			problems = append(problems, ValidateChecklist(checklist)...)
+			if err := CheckStaleChecklist(checklist, maxAge); err != nil {
+				UxPrintWarning(err)
+			}
+			for _, err := range CheckUnusedVars(checklist) {
+				UxPrintWarning(err)
+			}
+			allItems = append(allItems, checklist.Checklist...)
+		}
+	}
+
+	if err := ValidateItemConditions(allItems); err != nil {
+		problems = append(problems, err)
+	}
+
+	for _, err := range problems {
+		UxPrintError(err)
+	}
+	if len(problems) > 0 {
+		fmt.Printf("%d problems found\n", len(problems))
+		return false
+	}
+
+	fmt.Printf("%d checklists are valid\n", count)
+	return true
 }
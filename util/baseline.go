@@ -0,0 +1,133 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+/**
+ * The captured output of every item, by title
+ */
+type Baseline map[string]string
+
+func LoadBaseline(filename string) (Baseline, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read baseline %s: %s", filename, err.Error())
+	}
+
+	baseline := make(Baseline)
+	err = yaml.Unmarshal(content, &baseline)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse baseline %s: %s", filename, err.Error())
+	}
+
+	return baseline, nil
+}
+
+/**
+ * Creates a baseline from the output of the items that were executed
+ */
+func CreateBaseline(summary *RunSummary) Baseline {
+	baseline := make(Baseline)
+	for _, result := range summary.Results {
+		if result.Status == STATUS_PASS || result.Status == STATUS_FAIL {
+			baseline[result.Item.Ref()] = result.Stdout
+		}
+	}
+	return baseline
+}
+
+func (b Baseline) Save(filename string) error {
+	content, err := yaml.Marshal(b)
+	if err != nil {
+		return fmt.Errorf("Could not marshal baseline: %s", err.Error())
+	}
+
+	err = ioutil.WriteFile(filename, content, 0644)
+	if err != nil {
+		return fmt.Errorf("Could not write baseline %s: %s", filename, err.Error())
+	}
+	return nil
+}
+
+/**
+ * Normalizes the whitespace of the output lines and removes the parts
+ * matching the ignore patterns of the item
+ */
+func normalizeBaselineOutput(item *ChecklistItem, output string) []string {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		for _, pattern := range item.BaselineIgnore {
+			line = regexp.MustCompile(pattern).ReplaceAllString(line, "")
+		}
+		line = strings.Join(strings.Fields(line), " ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+/**
+ * Compares the output of the item against the baseline. Returns false and a
+ * line diff if they differ. Items missing from the baseline are not compared.
+ */
+func (b Baseline) Compare(item *ChecklistItem, output string) (bool, string) {
+	expected, ok := b[item.Ref()]
+	if !ok {
+		if expected, ok = b[item.Title]; !ok {
+			return true, ""
+		}
+	}
+
+	diff, same := diffLines(
+		normalizeBaselineOutput(item, expected),
+		normalizeBaselineOutput(item, output),
+	)
+	return same, diff
+}
+
+/**
+ * Computes a minimal line diff between a and b
+ */
+func diffLines(a []string, b []string) (string, bool) {
+	// Longest common subsequence table
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff []string
+	same := true
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		if i < len(a) && j < len(b) && a[i] == b[j] {
+			diff = append(diff, "  "+a[i])
+			i, j = i+1, j+1
+		} else if i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]) {
+			diff = append(diff, "- "+a[i])
+			i, same = i+1, false
+		} else {
+			diff = append(diff, "+ "+b[j])
+			j, same = j+1, false
+		}
+	}
+
+	return strings.Join(diff, "\n"), same
+}
@@ -0,0 +1,147 @@
+package util
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+)
+
+// The defaults of the certificate checks that don't define their own
+const certDefaultMinDays = 30
+const certDefaultTimeout = 10 * time.Second
+
+/**
+ * A built-in check that a TLS certificate does not expire soon, read from
+ * the handshake with an endpoint or from a PEM file
+ */
+type CertCheck struct {
+	// The endpoint to connect to (e.g. registry.example.com:443)
+	Host string
+
+	// The PEM file to read the certificate from, instead of an endpoint
+	File string
+
+	// The name to send in the handshake, instead of the host of the endpoint
+	ServerName string `yaml:"server_name"`
+
+	// The certificate must be valid for at least this number of days
+	MinDays *int `yaml:"min_days"`
+
+	// The time to wait for the handshake (e.g. 5s)
+	Timeout string
+}
+
+/**
+ * Validates the definition of the check
+ */
+func (c *CertCheck) Validate() error {
+	if (c.Host == "") == (c.File == "") {
+		return fmt.Errorf("Expecting either a host or a file to check")
+	}
+	if c.Host != "" {
+		if _, _, err := net.SplitHostPort(c.Host); err != nil {
+			return fmt.Errorf("Invalid host %s (expecting host:port)", c.Host)
+		}
+	}
+	if c.MinDays != nil && *c.MinDays < 0 {
+		return fmt.Errorf("Invalid min_days %d (expecting a positive number)", *c.MinDays)
+	}
+	return ValidateDuration(c.Timeout)
+}
+
+func (c *CertCheck) minDays() int {
+	if c.MinDays == nil {
+		return certDefaultMinDays
+	}
+	return *c.MinDays
+}
+
+/**
+ * Returns the certificate presented first by the endpoint. The chain is not
+ * verified, since only the expiry of the certificate is checked.
+ */
+func (c *CertCheck) remoteCertificate() (*x509.Certificate, error) {
+	timeout := certDefaultTimeout
+	if c.Timeout != "" {
+		timeout, _ = time.ParseDuration(c.Timeout)
+	}
+	config := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: true,
+	}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", c.Host, config)
+	if err != nil {
+		return nil, fmt.Errorf("Could not connect to %s: %s", c.Host, err.Error())
+	}
+	defer conn.Close()
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%s did not present any certificate", c.Host)
+	}
+	return certs[0], nil
+}
+
+/**
+ * Returns the first certificate of the file, in PEM or DER
+ */
+func (c *CertCheck) fileCertificate() (*x509.Certificate, error) {
+	content, err := ioutil.ReadFile(c.File)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read certificate %s: %s", c.File, err.Error())
+	}
+	der := content
+	for rest := content; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			der = block.Bytes
+			break
+		}
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse certificate %s: %s", c.File, err.Error())
+	}
+	return cert, nil
+}
+
+/**
+ * Runs the check, returning the days remaining with the subject and issuer
+ * of the certificate, or an error if it expires within the window
+ */
+func (c *CertCheck) Run() (string, error) {
+	var cert *x509.Certificate
+	var err error
+	source := c.File
+	if c.Host != "" {
+		source = c.Host
+		cert, err = c.remoteCertificate()
+	} else {
+		cert, err = c.fileCertificate()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	days := int(cert.NotAfter.Sub(now).Hours() / 24)
+	details := fmt.Sprintf("subject %s, issuer %s", cert.Subject, cert.Issuer)
+	expiry := cert.NotAfter.UTC().Format("2006-01-02")
+	switch {
+	case now.Before(cert.NotBefore):
+		return "", fmt.Errorf("The certificate of %s is not valid before %s (%s)", source, cert.NotBefore.UTC().Format("2006-01-02"), details)
+	case now.After(cert.NotAfter):
+		return "", fmt.Errorf("The certificate of %s expired on %s (%s)", source, expiry, details)
+	case days < c.minDays():
+		return "", fmt.Errorf("The certificate of %s expires in %d days on %s, expecting at least %d (%s)", source, days, expiry, c.minDays(), details)
+	}
+	return fmt.Sprintf("Expires in %d days on %s (%s)", days, expiry, details), nil
+}
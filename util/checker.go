@@ -1,71 +1,419 @@
 package util
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"os"
 	"os/exec"
 	"regexp"
+	"runtime"
+	"sort"
 	"strings"
+	"time"
 )
 
+/**
+ * The error of a script that exited with a non-zero code
+ */
+type ScriptExitError struct {
+	Code int
+}
+
+func (e *ScriptExitError) Error() string {
+	return fmt.Sprintf("Exited with %d", e.Code)
+}
+
+/**
+ * The error of a check whose outcome could not be determined, as opposed to a
+ * check that failed, reported with the `unknown_exit_code` of the item
+ */
+type UnknownOutcomeError struct {
+	Code int
+}
+
+func (e *UnknownOutcomeError) Error() string {
+	return fmt.Sprintf("Could not determine the outcome (exited with %d)", e.Code)
+}
+
+/**
+ * Checks if the error is the one of a check with an unknown outcome
+ */
+func IsUnknownOutcome(err error) bool {
+	_, ok := err.(*UnknownOutcomeError)
+	return ok
+}
+
+func itemRunOptions(item *ChecklistItem) RunOptions {
+	maxOutput, _ := ParseSize(item.MaxOutput)
+	return RunOptions{
+		Env:         item.Env,
+		CleanEnv:    item.CleanEnv,
+		Locale:      item.Locale,
+		Privileged:  item.Privileged,
+		MaxOutput:   maxOutput,
+		Timeout:     item.GetTimeout(),
+		SoftTimeout: item.GetSoftTimeout(),
+		Umask:       item.Umask,
+		Limits:      item.Rlimits,
+	}
+}
+
 /**
  * Runs the given item script and returns the stdount/stderr
  */
 func RunItemScript(item *ChecklistItem, runner *Runner) (string, string, error) {
-	sout, serr, err := runner.Run(item.Script)
+	if item.Files != nil {
+		value, err := item.Files.Run()
+		return value, "", err
+	}
+	if item.DNS != nil {
+		value, err := item.DNS.Run()
+		return value, "", err
+	}
+	if item.Wait != nil {
+		return item.Wait.Run(runner, itemRunOptions(item))
+	}
+	if item.Service != nil {
+		value, err := item.Service.Run()
+		return value, "", err
+	}
+	if item.Cert != nil {
+		value, err := item.Cert.Run()
+		return value, "", err
+	}
+
+	// Never import the JUnit output of a previous run
+	if item.JUnitOutput != "" {
+		os.Remove(runner.itemJUnitOutput(item))
+	}
+
+	opts := itemRunOptions(item)
+	opts.Interpreter = inlineCheckInterpreter(item.Lang)
+	sout, serr, err := runner.RunWithOptions(item.Script, "", opts)
 	if err != nil {
 		if xerr, ok := err.(*exec.ExitError); ok {
-			err = fmt.Errorf("Exited with %d", xerr.ExitCode())
+			err = &ScriptExitError{xerr.ExitCode()}
 		}
 	}
 
 	sout = strings.Trim(sout, "\r\n\t ")
+	if item.JUnitOutput != "" {
+		return runner.importItemJUnit(item, sout, serr, err)
+	}
 	return sout, serr, err
 }
 
+/**
+ * Checks if the item's environment and OS requirements are satisfied
+ */
+func IsItemApplicable(item *ChecklistItem, runner *Runner) bool {
+	if len(item.RequireOS) > 0 && !containsString(item.RequireOS, runtime.GOOS) {
+		return false
+	}
+
+	for key, pattern := range item.RequireEnv {
+		value, ok := item.Env[key]
+		if !ok {
+			value, ok = runner.Config.Env[key]
+		}
+		if !ok {
+			value = os.Getenv(key)
+		}
+		if !regexp.MustCompile(pattern).MatchString(value) {
+			return false
+		}
+	}
+
+	return true
+}
+
 func CanCheckItem(item *ChecklistItem) bool {
-	return item.ExpectScript != "" || item.ExpectMatch != ""
+	return hasValueAssertions(item) || item.HasBuiltinCheck() || item.JUnitOutput != ""
 }
 
 /**
- * Runs the item's automatic checks
+ * Checks if the item defines assertions on the value of its script
  */
-func checkItemValue(item *ChecklistItem, runner *Runner, value string) (bool, string, error) {
+func hasValueAssertions(item *ChecklistItem) bool {
+	return item.ExpectScript != "" || item.ExpectMatch != "" || item.ExpectExitCode != nil ||
+		item.ExpectMin != nil || item.ExpectMax != nil || item.GoldenFile != "" || len(item.ExpectJSON) > 0
+}
+
+/**
+ * Evaluates every assertion of the item against the value and the exit code
+ * of its script. Returns true if all of them hold, otherwise a description
+ * of every assertion that failed.
+ */
+func checkItemValue(item *ChecklistItem, runner *Runner, value string, exitCode int) (bool, string, error) {
+	var failures []string
+	total := 0
+
+	if item.ExpectExitCode != nil {
+		total += 1
+		if exitCode != *item.ExpectExitCode {
+			failures = append(failures, fmt.Sprintf("  Exit code: %d\n   Expected: %d\n", exitCode, *item.ExpectExitCode))
+		}
+	}
+
+	// If there is a regular expression, check now
+	if item.ExpectMatch != "" {
+		total += 1
+		re := regexp.MustCompile(item.ExpectMatch)
+		if !re.MatchString(value) {
+			failures = append(failures, fmt.Sprintf("      Regex: %s\nDon't match: \"%s\"\n", item.ExpectMatch, value))
+		}
+	}
+
+	if item.ExpectMin != nil || item.ExpectMax != nil {
+		total += 1
+		number, err := parseNumber(value)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("Not a number: \"%s\"\n", value))
+		} else if item.ExpectMin != nil && number < *item.ExpectMin {
+			failures = append(failures, fmt.Sprintf("      Value: %v\nBelow minimum: %v\n", number, *item.ExpectMin))
+		} else if item.ExpectMax != nil && number > *item.ExpectMax {
+			failures = append(failures, fmt.Sprintf("      Value: %v\nAbove maximum: %v\n", number, *item.ExpectMax))
+		}
+	}
+
+	if len(item.ExpectJSON) > 0 {
+		total += len(item.ExpectJSON)
+		jsonFailures, err := checkJSONAssertions(item.ExpectJSON, value)
+		if err != nil {
+			return false, err.Error(), nil
+		}
+		for _, failure := range jsonFailures {
+			failures = append(failures, fmt.Sprintf("JSON: %s\n", failure))
+		}
+	}
+
+	if item.GoldenFile != "" {
+		total += 1
+		if runner.Config.UpdateGolden {
+			if err := updateGoldenFile(item, value); err != nil {
+				return false, "", err
+			}
+		} else {
+			same, diff, err := compareGoldenFile(item, value)
+			if err != nil {
+				return false, "", err
+			}
+			if !same {
+				failures = append(failures, diff)
+			}
+		}
+	}
+
 	// If there is a script, call-out to the given script to compute
 	// if the result obtained is valid
 	if item.ExpectScript != "" {
-		_, serr, err := runner.RunWithValue(item.ExpectScript, value)
+		total += 1
+		_, serr, err := runner.RunWithOptions(item.ExpectScript, value, itemRunOptions(item))
 		if err != nil {
-			if xerr, ok := err.(*exec.ExitError); ok {
-				if xerr.ExitCode() != 0 {
-					return false, serr, nil
-				}
+			xerr, ok := err.(*exec.ExitError)
+			if !ok || xerr.ExitCode() == 0 {
+				return false, serr, err
 			}
-			return false, serr, err
+			failures = append(failures, serr)
 		}
-		return true, serr, nil
 	}
 
-	// If there is a regular expression, check now
-	if item.ExpectMatch != "" {
-		re := regexp.MustCompile(item.ExpectMatch)
-		return re.MatchString(value),
-			fmt.Sprintf("      Regex: %s\nDon't match: \"%s\"\n", item.ExpectMatch, value),
-			nil
+	if total == 0 {
+		return false, "No expect condition", nil
+	}
+	if len(failures) == 0 {
+		return true, "", nil
+	}
+	if total == 1 {
+		return false, failures[0], nil
+	}
+	return false, fmt.Sprintf("%d of %d assertions failed:\n%s", len(failures), total, strings.Join(failures, "---\n")), nil
+}
+
+type checkOutcome struct {
+	value string
+	serr  string
+	ok    bool
+	err   error
+
+	// Closed once the check completed, for the checks that run in the
+	// background
+	done chan struct{}
+
+	// The check ran in the background and its outcome was not used yet
+	prefetched bool
+
+	// The time the check took, with its retries
+	duration time.Duration
+}
+
+/**
+ * Runs the check of the item, with the retries it allows, and records its
+ * outcome
+ */
+func (o *checkOutcome) run(item *ChecklistItem, runner *Runner) {
+	defer close(o.done)
+	for _, slot := range runner.checkSlots(item) {
+		slot <- struct{}{}
+		defer func(slot chan struct{}) { <-slot }(slot)
+	}
+	started := time.Now()
+	defer func() { o.duration = time.Since(started) }()
+	o.value, o.serr, o.ok, o.err = runItemCheck(item, runner)
+	for attempt := 0; attempt < item.GetRetries() && (!o.ok || o.err != nil); attempt++ {
+		time.Sleep(item.GetRetryDelay())
+		o.value, o.serr, o.ok, o.err = runItemCheck(item, runner)
+	}
+}
+
+/**
+ * Returns the outcome of the check with the given key, and true if it was
+ * already performed or is running. Otherwise a new outcome is returned, for
+ * the caller to run the check.
+ */
+func (r *Runner) claimCheck(key string, prefetched bool) (*checkOutcome, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if outcome, ok := r.checks[key]; ok {
+		return outcome, true
+	}
+	outcome := &checkOutcome{done: make(chan struct{}), prefetched: prefetched}
+	r.checks[key] = outcome
+	return outcome, false
+}
+
+/**
+ * Computes a key that identifies the item check with its resolved environment
+ */
+func checkKey(item *ChecklistItem, runner *Runner) string {
+	env := runner.Config.GetEnvList()
+	for k, v := range item.Env {
+		env = append(env, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(env)
+
+	assertions := ""
+	if item.ExpectExitCode != nil {
+		assertions += fmt.Sprintf("exit=%d;", *item.ExpectExitCode)
+	}
+	if item.UnknownExitCode != nil {
+		assertions += fmt.Sprintf("unknown_exit=%d;", *item.UnknownExitCode)
+	}
+	if item.ExpectMin != nil {
+		assertions += fmt.Sprintf("min=%v;", *item.ExpectMin)
+	}
+	if item.ExpectMax != nil {
+		assertions += fmt.Sprintf("max=%v;", *item.ExpectMax)
+	}
+
+	for _, assertion := range item.ExpectJSON {
+		assertions += fmt.Sprintf("json=%s,%s,%v,%v;", assertion.Path, jsonText(assertion.Equals), assertion.Min, assertion.Max)
+	}
+	if item.GoldenFile != "" {
+		assertions += fmt.Sprintf("golden=%s,%v,%s;", item.GoldenFile, item.GoldenSort, strings.Join(item.GoldenIgnore, ","))
+	}
+
+	// The settings that change how the scripts run, and so their outcome
+	execution := fmt.Sprintf("timeout=%s;retries=%d,%s;privileged=%v;locale=%s;", item.Timeout, item.GetRetries(), item.RetryDelay, item.Privileged, item.Locale)
+	execution += fmt.Sprintf("umask=%s;rlimits=%v;max_output=%s;", item.Umask, item.Rlimits, item.MaxOutput)
+
+	// The statuses of the earlier items, for the checks that read them
+	if usesItemStatuses(item, runner) {
+		runner.lock.Lock()
+		for _, k := range sortedKeys(runner.itemStatuses) {
+			execution += fmt.Sprintf("%s=%s;", k, runner.itemStatuses[k])
+		}
+		runner.lock.Unlock()
 	}
 
-	return false, "No expect condition", nil
+	hash := sha256.New()
+	parts := []string{item.Lang, item.Script, item.ExpectMatch, item.ExpectScript, fmt.Sprint(item.CleanEnv), fmt.Sprint(item.Files), fmt.Sprint(item.DNS), fmt.Sprint(item.Wait), fmt.Sprint(item.Service), fmt.Sprint(item.Cert), item.JUnitOutput, assertions, execution}
+	for _, part := range append(parts, env...) {
+		fmt.Fprintf(hash, "%d:%s", len(part), part)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
 }
 
 /**
- * Runs the item's automatic checks
+ * Checks if an identical check has already been performed in this run
+ */
+func IsItemCheckCached(item *ChecklistItem, runner *Runner) bool {
+	key := checkKey(item, runner)
+	runner.lock.Lock()
+	defer runner.lock.Unlock()
+	outcome, ok := runner.checks[key]
+	return ok && !outcome.prefetched
+}
+
+/**
+ * Runs the item's automatic checks, re-using the outcome of an identical
+ * check that was already performed in this run
  */
 func RunItemCheck(item *ChecklistItem, runner *Runner) (string, string, bool, error) {
+	outcome, found := runner.claimCheck(checkKey(item, runner), false)
+	if !found {
+		outcome.run(item, runner)
+	}
+
+	// Wait for the check if it is still running in the background
+	<-outcome.done
+	runner.lock.Lock()
+	outcome.prefetched = false
+	runner.lock.Unlock()
+	return outcome.value, outcome.serr, outcome.ok, outcome.err
+}
+
+/**
+ * Returns the time the check of the item took when it was performed, which
+ * may have been in the background before the run reached the item
+ */
+func ItemCheckDuration(item *ChecklistItem, runner *Runner) time.Duration {
+	key := checkKey(item, runner)
+	runner.lock.Lock()
+	defer runner.lock.Unlock()
+	if outcome, ok := runner.checks[key]; ok {
+		return outcome.duration
+	}
+	return 0
+}
+
+/**
+ * Starts an interactive shell in the environment the item scripts run in
+ */
+func ItemShell(item *ChecklistItem, runner *Runner) error {
+	return runner.Shell(itemRunOptions(item))
+}
+
+/**
+ * Forgets the outcome of the item check, so that it runs again
+ */
+func ForgetItemCheck(item *ChecklistItem, runner *Runner) {
+	key := checkKey(item, runner)
+	runner.lock.Lock()
+	defer runner.lock.Unlock()
+	delete(runner.checks, key)
+}
+
+func runItemCheck(item *ChecklistItem, runner *Runner) (string, string, bool, error) {
 	value, serr, err := RunItemScript(item, runner)
+	exitCode := 0
 	if err != nil {
-		return "", "", false, err
+		// The exit code is only an error if it's not asserted
+		xerr, ok := err.(*ScriptExitError)
+		if ok && item.UnknownExitCode != nil && xerr.Code == *item.UnknownExitCode && item.ExpectExitCode == nil {
+			return value, serr, false, &UnknownOutcomeError{xerr.Code}
+		}
+		if !ok || item.ExpectExitCode == nil {
+			return "", serr, false, err
+		}
+		exitCode = xerr.Code
+	}
+	if (item.HasBuiltinCheck() || item.JUnitOutput != "") && !hasValueAssertions(item) {
+		return value, serr, true, nil
 	}
 
-	ok, cserr, err := checkItemValue(item, runner, value)
+	ok, cserr, err := checkItemValue(item, runner, value, exitCode)
 	if err != nil {
 		return "", "", false, err
 	}
@@ -75,3 +423,75 @@ func RunItemCheck(item *ChecklistItem, runner *Runner) (string, string, bool, er
 
 	return value, serr, ok, nil
 }
+
+/**
+ * Runs the after-each script that applies to the item, if any, and returns
+ * its output
+ */
+func RunItemAfterEach(item *ChecklistItem, runner *Runner) (string, error) {
+	if item.AfterEach == "" {
+		return "", nil
+	}
+
+	sout, serr, err := runner.RunWithOptions(item.AfterEach, "", itemRunOptions(item))
+	if err != nil {
+		if xerr, ok := err.(*exec.ExitError); ok {
+			err = fmt.Errorf("After-each script exited with %d", xerr.ExitCode())
+		}
+		return fmt.Sprintf("\n--- after each ---\n%s\n%s", sout, serr), err
+	}
+
+	return "", nil
+}
+
+/**
+ * Runs the fix script of the item after a failure, and returns its output
+ */
+func RunItemFix(item *ChecklistItem, runner *Runner) (string, error) {
+	sout, serr, err := runner.RunWithOptions(item.Fix, "", itemRunOptions(item))
+	if err != nil {
+		if xerr, ok := err.(*exec.ExitError); ok {
+			err = fmt.Errorf("Fix script exited with %d", xerr.ExitCode())
+		}
+		return fmt.Sprintf("%s\n%s", sout, serr), err
+	}
+	return "", nil
+}
+
+/**
+ * Runs the `on_pass` or `on_fail` hook of the item for the given result, if
+ * any. The hook cannot change the result of the item.
+ */
+func RunItemHook(item *ChecklistItem, runner *Runner, result *ItemResult) error {
+	name, hook := "On-pass", item.OnPass
+	if result.Status == STATUS_FAIL {
+		name, hook = "On-fail", item.OnFail
+	} else if result.Status != STATUS_PASS {
+		return nil
+	}
+	if hook == "" {
+		return nil
+	}
+
+	opts := itemRunOptions(item)
+	opts.Env = make(map[string]string)
+	for k, v := range item.Env {
+		opts.Env[k] = v
+	}
+	opts.Env["PREFLIGHTER_ITEM_TITLE"] = item.Title
+	opts.Env["PREFLIGHTER_ITEM_STATUS"] = result.Status
+	opts.Env["PREFLIGHTER_ITEM_OUTPUT"] = result.Stdout
+
+	_, serr, err := runner.RunWithOptions(hook, result.Value, opts)
+	if err != nil {
+		if xerr, ok := err.(*exec.ExitError); ok {
+			err = fmt.Errorf("exited with %d", xerr.ExitCode())
+		}
+		if serr = strings.TrimSpace(serr); serr != "" {
+			return fmt.Errorf("%s hook of %s %s: %s", name, item.Title, err.Error(), serr)
+		}
+		return fmt.Errorf("%s hook of %s %s", name, item.Title, err.Error())
+	}
+
+	return nil
+}
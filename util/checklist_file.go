@@ -1,47 +1,889 @@
 package util
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/imdario/mergo"
 	"gopkg.in/yaml.v2"
 )
 
+type ItemCondition struct {
+	Item   string
+	Status string
+}
+
 type ChecklistItem struct {
+	// The name of the status variable of the item, instead of its title
+	ID     string
 	Title  string
 	Script string
 
+	// The script written in another language, instead of a bash script
+	Check *InlineCheck
+
+	// The language of the script, if not bash
+	Lang string `yaml:"-"`
+
 	ExpectMatch  string `yaml:"expect"`
 	ExpectScript string `yaml:"expect_script"`
 
+	// Additional assertions on the exit code and on the numeric value of the
+	// script, all of the configured ones must hold
+	ExpectExitCode *int     `yaml:"expect_exit_code"`
+	ExpectMin      *float64 `yaml:"expect_min"`
+	ExpectMax      *float64 `yaml:"expect_max"`
+
+	// The exit code with which the script reports that it could not
+	// determine the outcome of its check, e.g. because a dependency was
+	// unavailable, instead of a failure
+	UnknownExitCode *int `yaml:"unknown_exit_code"`
+
+	// Assertions on the fields of the script output, parsed as JSON
+	ExpectJSON []JSONAssertion `yaml:"expect_json"`
+
+	// A built-in check on the freshness of files, instead of a script
+	Files *FilesCheck
+
+	// A built-in check on the resolution of a hostname, instead of a script
+	DNS *DNSCheck `yaml:"dns"`
+
+	// A built-in check that waits for a condition command to succeed
+	Wait *WaitCheck
+
+	// A built-in check that a systemd unit or a process is running
+	Service *ServiceCheck
+
+	// A built-in check that a TLS certificate does not expire soon
+	Cert *CertCheck
+
+	// The JUnit XML file the script produces, whose test cases are the
+	// outcome of the item instead of the script
+	JUnitOutput string `yaml:"junit_output"`
+
 	RunbookID   string `yaml:"runbook_id"`
 	RunbookStep string `yaml:"runbook_step"`
+
+	// The Go template of the reason of the failure pushed to the runbook,
+	// instead of the one of the checklist file or the default one
+	RunbookFailureTemplate string `yaml:"runbook_failure_template"`
+
+	// The kind of problem a failure of this item indicates (e.g. network)
+	Category string
+
+	// A page that explains the check, shown with its failures
+	DocURL string `yaml:"doc_url"`
+
+	// Shell commands that fix the problem when the item fails
+	Remediation string
+
+	// A safe automated fix of the problem, that is run with -auto-fix when
+	// the item fails before checking it again
+	Fix string
+
+	// Skip the item if the environment or the OS don't match
+	RequireEnv map[string]string `yaml:"require_env"`
+	RequireOS  []string          `yaml:"require_os"`
+
+	// Patterns to remove from the output before comparing to a baseline
+	BaselineIgnore []string `yaml:"baseline_ignore"`
+
+	// A file with the expected output, optionally compared with the lines
+	// sorted and the parts matching the ignore patterns removed
+	GoldenFile   string   `yaml:"golden_file"`
+	GoldenSort   bool     `yaml:"golden_sort"`
+	GoldenIgnore []string `yaml:"golden_ignore"`
+
+	// The relative amount of work in this item, for the run progress
+	Weight int
+
+	// Never leave the item out when running a -sample of the items
+	AlwaysRun bool `yaml:"always_run"`
+
+	// The checks of the items with the same mutex never run at once in a
+	// parallel run, e.g. when they take the same external lock
+	Mutex string
+
+	// The abstract cost of running the item (e.g. cloud API calls), counted
+	// against the -budget of the run
+	Cost int
+
+	// Run the item as usual, but leave it out of the summary and the reports
+	// (e.g. setup and teardown items)
+	Hidden bool
+
+	// A failure of this item is reported, but does not abort the run
+	AllowFailure bool `yaml:"allow_failure"`
+
+	// The item is known to fail until a fix lands: a failure is expected and
+	// does not abort the run, while a pass is reported as unexpected
+	ExpectFail bool `yaml:"expect_fail"`
+
+	// Skip the item depending on the status of an earlier item
+	SkipIf *ItemCondition `yaml:"skip_if"`
+	RunIf  *ItemCondition `yaml:"run_if"`
+
+	// Skip the item if any of these earlier items failed, by title
+	DependsOn []string `yaml:"depends_on"`
+
+	// The environment whose overrides disabled the item, if any
+	DisabledIn string `yaml:"-"`
+
+	// The number of checks of the checklist file of the item that may run at
+	// once in a parallel run, if limited
+	FileMaxConcurrency int `yaml:"-"`
+
+	// Run with only the checklist variables, PATH and HOME
+	CleanEnv bool `yaml:"clean_env"`
+
+	// The locale to run the scripts with (e.g. en_US.UTF-8), instead of C
+	Locale string
+
+	// The size of the script outputs to capture (e.g. 64K), truncating the rest
+	MaxOutput string `yaml:"max_output"`
+
+	// Run the scripts of the item with sudo, unless already running as root
+	Privileged bool
+
+	// The umask (e.g. 022) and the resource limits of the scripts, instead
+	// of the ones of the checklist
+	Umask   string
+	Rlimits *ResourceLimits
+
+	// Re-use a passing result of an earlier run for this long (e.g. 12h)
+	CacheTTL string `yaml:"cache_ttl"`
+
+	// Kill the scripts of the item if they run for longer (e.g. 30s)
+	Timeout string
+
+	// Warn that the scripts of the item are slow if they run for longer,
+	// without killing them
+	SoftTimeout string `yaml:"soft_timeout"`
+
+	// Run the check again this many times if it fails, waiting in-between.
+	// Unset, the default of the checklist applies, so 0 disables the retries.
+	Retries    *int
+	RetryDelay string `yaml:"retry_delay"`
+
+	// Scripts to run after the item passed or failed (e.g. to alert someone),
+	// with the result of the item in the environment
+	OnPass string `yaml:"on_pass"`
+	OnFail string `yaml:"on_fail"`
+
+	// A script to verify after the item, inherited from the checklist file
+	AfterEach string `yaml:"-"`
+
+	// The checklist file the item was loaded from
+	Filename string `yaml:"-"`
+
+	// Instantiate the item from a checklist template with the given parameters
+	Use  string
+	With map[string]string
+
+	// Additional environment variables for this item only
+	Env map[string]string `yaml:"-"`
 }
 
 type Checklist = []ChecklistItem
 
 type ChecklistFile struct {
-	Title        string
-	Checklist    Checklist
-	Libs         []string
-	Env          map[string]string `yaml:"vars"`
-	RequireTools []string          `yaml:"require_tools"`
-	RunbookSteps []string          `yaml:"runbook_steps"`
-	Filename     string            `yaml:"-"`
+	Title          string
+	Description    string
+	Checklist      Checklist
+	Libs           []string
+	Env            map[string]string `yaml:"vars"`
+	RequireTools   []string          `yaml:"require_tools"`
+	RunbookSteps   []string          `yaml:"runbook_steps"`
+	Matrix         map[string][]string
+	CleanEnv       bool   `yaml:"clean_env"`
+	AfterEach      string `yaml:"after_each"`
+	Categories     []string
+	HeaderCommands []string `yaml:"header_commands"`
+
+	// The files with a higher priority run before the others, regardless of
+	// the order of the arguments
+	Priority int
+
+	// The token that must be given with -token to run the checklist, for the
+	// checklists that must not be run by accident (e.g. PROD)
+	RequireToken string `yaml:"require_token"`
+
+	// The variables that the scripts may intentionally leave undefined,
+	// allowed with -strict-env
+	OptionalVars []string `yaml:"optional_vars"`
+
+	// Commands that capture the state of the environment before the run,
+	// and verify that it was not left in a bad state after the run
+	Snapshot string
+	Verify   string
+
+	// The template of the runbook failure reasons of the items that don't
+	// define their own
+	RunbookFailureTemplate string `yaml:"runbook_failure_template"`
+
+	// The umask and the resource limits of the scripts of the items that
+	// don't define their own
+	Umask   string
+	Rlimits *ResourceLimits
+
+	// The exit code of the unknown outcomes of the items that don't define
+	// their own
+	UnknownExitCode *int `yaml:"unknown_exit_code"`
+
+	// The number of checks of the file that may run at once with -j, for the
+	// files whose items use the same backend
+	MaxConcurrency int `yaml:"max_concurrency"`
+
+	// The defaults of the items that don't define their own
+	DefaultTimeout    string `yaml:"default_timeout"`
+	DefaultRetries    int    `yaml:"default_retries"`
+	DefaultRetryDelay string `yaml:"default_retry_delay"`
+
+	// The changes to the checklist, by environment name
+	Overrides map[string]ChecklistOverride
+
+	// The local changes to the items fetched from the runbook steps, by
+	// runbook item ID
+	RunbookItems map[string]RunbookItemAugmentation `yaml:"runbook_items"`
+
+	// The sets of items that are only enabled when the variable has their
+	// value, by value. The items in none of the sets are always enabled.
+	VariantVar string `yaml:"variant_var"`
+	Variants   map[string][]string
+
+	// The value of the variant variable the items were selected with
+	SelectedVariant string `yaml:"-"`
+
+	Meta      map[string]interface{}
+	Templates map[string]ChecklistItem
+	Filename  string `yaml:"-"`
 }
 
-func LoadChecklist(filename string) (*ChecklistFile, error) {
+/**
+ * @brief      Loads the checklists of the file, one per YAML document when
+ *             the documents are separated by `---`. The empty documents are
+ *             ignored.
+ *
+ * @param      filename  The checklist file
+ *
+ * @return     The checklists, named after the file followed by the number of
+ *             their document if there are several, or the error occurred
+ */
+func LoadChecklist(filename string) ([]*ChecklistFile, error) {
 	content, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("Could not read %s: %s", filename, err.Error())
 	}
 
-	var cf ChecklistFile
-	err = yaml.Unmarshal(content, &cf)
+	var docs []*ChecklistFile
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var cf ChecklistFile
+		err = decoder.Decode(&cf)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Could not parse %s: %s", filename, err.Error())
+		}
+		if !reflect.DeepEqual(cf, ChecklistFile{}) {
+			docs = append(docs, &cf)
+		}
+	}
+	if len(docs) == 0 {
+		docs = append(docs, &ChecklistFile{})
+	}
+
+	for i, cf := range docs {
+		name := filename
+		if len(docs) > 1 {
+			name = fmt.Sprintf("%s#%d", filename, i+1)
+		}
+		if err := loadChecklistDocument(name, cf); err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
+
+/**
+ * Prepares and validates a checklist decoded from the given file
+ */
+func loadChecklistDocument(filename string, cf *ChecklistFile) error {
+	err := resolveInlineChecks(cf)
+	if err != nil {
+		return fmt.Errorf("Invalid check in %s: %s", filename, err.Error())
+	}
+
+	err = expandTemplates(cf)
 	if err != nil {
-		return nil, fmt.Errorf("Could not parse %s: %s", filename, err.Error())
+		return fmt.Errorf("Could not expand templates in %s: %s", filename, err.Error())
+	}
+
+	// Validate the env commands early, so filter errors surface at load time
+	for key, value := range cf.Env {
+		if _, err = ParseEnvValue(value); err != nil {
+			return fmt.Errorf("Invalid value for %s in %s: %s", key, filename, err.Error())
+		}
+	}
+
+	for id, augmentation := range cf.RunbookItems {
+		if err := augmentation.validate(); err != nil {
+			return fmt.Errorf("Runbook item %s in %s has an invalid augmentation: %s", id, filename, err.Error())
+		}
+	}
+
+	for _, item := range cf.Checklist {
+		for _, pattern := range item.BaselineIgnore {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("Item '%s' in %s has an invalid baseline_ignore pattern: %s", item.Title, filename, err.Error())
+			}
+		}
+		for _, pattern := range item.GoldenIgnore {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("Item '%s' in %s has an invalid golden_ignore pattern: %s", item.Title, filename, err.Error())
+			}
+		}
+		for key, pattern := range item.RequireEnv {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("Item '%s' in %s has an invalid require_env pattern for %s: %s", item.Title, filename, key, err.Error())
+			}
+		}
+		if item.Files != nil {
+			if err := item.Files.Validate(); err != nil {
+				return fmt.Errorf("Item '%s' in %s has an invalid files check: %s", item.Title, filename, err.Error())
+			}
+		}
+		if item.DNS != nil {
+			if err := item.DNS.Validate(); err != nil {
+				return fmt.Errorf("Item '%s' in %s has an invalid dns check: %s", item.Title, filename, err.Error())
+			}
+		}
+		if item.Wait != nil {
+			if err := item.Wait.Validate(); err != nil {
+				return fmt.Errorf("Item '%s' in %s has an invalid wait check: %s", item.Title, filename, err.Error())
+			}
+		}
+		if item.Service != nil {
+			if err := item.Service.Validate(); err != nil {
+				return fmt.Errorf("Item '%s' in %s has an invalid service check: %s", item.Title, filename, err.Error())
+			}
+		}
+		if item.Cert != nil {
+			if err := item.Cert.Validate(); err != nil {
+				return fmt.Errorf("Item '%s' in %s has an invalid cert check: %s", item.Title, filename, err.Error())
+			}
+		}
+		for _, assertion := range item.ExpectJSON {
+			if err := assertion.Validate(); err != nil {
+				return fmt.Errorf("Item '%s' in %s has an invalid expect_json: %s", item.Title, filename, err.Error())
+			}
+		}
+		if item.DocURL != "" {
+			if !isDocURL(item.DocURL) {
+				return fmt.Errorf("Item '%s' in %s has an invalid doc_url %s (expecting an http or https URL)", item.Title, filename, item.DocURL)
+			}
+		}
+		if item.MaxOutput != "" {
+			if _, err := ParseSize(item.MaxOutput); err != nil {
+				return fmt.Errorf("Item '%s' in %s has an invalid max_output: %s", item.Title, filename, err.Error())
+			}
+		}
+		for name, value := range map[string]string{"timeout": item.Timeout, "soft_timeout": item.SoftTimeout, "retry_delay": item.RetryDelay} {
+			if err := ValidateDuration(value); err != nil {
+				return fmt.Errorf("Item '%s' in %s has an invalid %s: %s", item.Title, filename, name, err.Error())
+			}
+		}
+		// The -timeout of the run is checked once it is resolved
+		if err := item.validateSoftTimeout(firstNonEmpty(item.Timeout, cf.DefaultTimeout)); err != nil {
+			return fmt.Errorf("Item '%s' in %s %s", item.Title, filename, err.Error())
+		}
+		if err := validateLimits(item.Umask, item.Rlimits); err != nil {
+			return fmt.Errorf("Item '%s' in %s has invalid limits: %s", item.Title, filename, err.Error())
+		}
+		if item.ID != "" && !rxItemID.MatchString(item.ID) {
+			return fmt.Errorf("Item '%s' in %s has an invalid id '%s' (expecting letters, digits and underscores)", item.Title, filename, item.ID)
+		}
+		if err := validateRunbookFailureTemplate(item.RunbookFailureTemplate); err != nil {
+			return fmt.Errorf("Item '%s' in %s has an invalid runbook_failure_template: %s", item.Title, filename, err.Error())
+		}
+		if item.CacheTTL != "" {
+			if ttl, err := time.ParseDuration(item.CacheTTL); err != nil || ttl <= 0 {
+				return fmt.Errorf("Item '%s' in %s has an invalid cache_ttl '%s' (expecting e.g. 30m or 12h)", item.Title, filename, item.CacheTTL)
+			}
+		}
+	}
+
+	if len(cf.Variants) > 0 && cf.VariantVar == "" {
+		return fmt.Errorf("Missing the variant_var that selects the variants of %s", filename)
+	}
+	if err := validateRunbookFailureTemplate(cf.RunbookFailureTemplate); err != nil {
+		return fmt.Errorf("Invalid runbook_failure_template in %s: %s", filename, err.Error())
+	}
+	if cf.MaxConcurrency < 0 {
+		return fmt.Errorf("Invalid max_concurrency %d in %s, expecting at least 1", cf.MaxConcurrency, filename)
+	}
+	if err := validateLimits(cf.Umask, cf.Rlimits); err != nil {
+		return fmt.Errorf("Invalid limits in %s: %s", filename, err.Error())
+	}
+	for name, value := range map[string]string{"default_timeout": cf.DefaultTimeout, "default_retry_delay": cf.DefaultRetryDelay} {
+		if err := ValidateDuration(value); err != nil {
+			return fmt.Errorf("Invalid %s in %s: %s", name, filename, err.Error())
+		}
+	}
+
+	// Validate the item categories against the allowed ones, if defined
+	if len(cf.Categories) > 0 {
+		for _, item := range cf.Checklist {
+			if item.Category != "" && !containsString(cf.Categories, item.Category) {
+				return fmt.Errorf("Item '%s' in %s has unknown category '%s'", item.Title, filename, item.Category)
+			}
+		}
 	}
 
 	cf.Filename = filename
-	return &cf, nil
+	for i := range cf.Checklist {
+		if cf.CleanEnv {
+			cf.Checklist[i].CleanEnv = true
+		}
+		cf.Checklist[i].AfterEach = cf.AfterEach
+	}
+	// A key without values would drop all the items of the checklist
+	for _, key := range sortedMatrixKeys(cf.Matrix) {
+		if len(cf.Matrix[key]) == 0 {
+			return fmt.Errorf("Matrix variable %s in %s has no values", key, filename)
+		}
+	}
+	cf.Checklist = expandMatrix(cf.Checklist, cf.Matrix)
+	for i := range cf.Checklist {
+		cf.Checklist[i].Filename = filename
+	}
+	return nil
+}
+
+var rxItemID = regexp.MustCompile(`^\w+$`)
+
+var rxTemplateParam = regexp.MustCompile(`{{\s*(\w+)\s*}}`)
+
+/**
+ * Replaces the items that `use` a template with the template instantiated
+ * with their parameters
+ */
+func expandTemplates(cf *ChecklistFile) error {
+	for i, item := range cf.Checklist {
+		if item.Use == "" {
+			continue
+		}
+
+		tmpl, ok := cf.Templates[item.Use]
+		if !ok {
+			return fmt.Errorf("Item #%d uses unknown template '%s'", i+1, item.Use)
+		}
+
+		used := make(map[string]bool)
+		var missing []string
+		render := func(text string) string {
+			return rxTemplateParam.ReplaceAllStringFunc(text, func(match string) string {
+				name := rxTemplateParam.FindStringSubmatch(match)[1]
+				value, ok := item.With[name]
+				if !ok {
+					if !containsString(missing, name) {
+						missing = append(missing, name)
+					}
+					return match
+				}
+				used[name] = true
+				return value
+			})
+		}
+
+		rendered := tmpl
+		rendered.Title = render(tmpl.Title)
+		rendered.Script = render(tmpl.Script)
+		rendered.ExpectMatch = render(tmpl.ExpectMatch)
+		rendered.ExpectScript = render(tmpl.ExpectScript)
+
+		// The fields of the item win over the ones of the template
+		expanded := item
+		expanded.Use = ""
+		expanded.With = nil
+		if err := mergo.Merge(&expanded, rendered); err != nil {
+			return fmt.Errorf("Item #%d could not use template '%s': %s", i+1, item.Use, err.Error())
+		}
+
+		if len(missing) > 0 {
+			return fmt.Errorf("Item #%d is missing the parameters %s of template '%s'", i+1, strings.Join(missing, ", "), item.Use)
+		}
+		for name := range item.With {
+			if !used[name] {
+				return fmt.Errorf("Item #%d passes unknown parameter '%s' to template '%s'", i+1, name, item.Use)
+			}
+		}
+
+		cf.Checklist[i] = expanded
+	}
+
+	return nil
+}
+
+/**
+ * Returns the keys of the matrix, in alphabetical order
+ */
+func sortedMatrixKeys(matrix map[string][]string) []string {
+	var keys []string
+	for key := range matrix {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// The characters that cannot be part of an item id
+var rxNonIDChars = regexp.MustCompile(`\W`)
+
+/**
+ * Repeats the checklist once for every combination of the matrix values. The
+ * titles get the combination as a suffix (e.g. `Title [K=v]`), and the ids its
+ * values (e.g. `id_v`). The conditions and the dependencies on the items of the
+ * checklist refer to the items of the same combination.
+ */
+func expandMatrix(checklist Checklist, matrix map[string][]string) Checklist {
+	if len(matrix) == 0 {
+		return checklist
+	}
+
+	keys := sortedMatrixKeys(matrix)
+
+	// Compute all the combinations, varying the values of the last key in
+	// alphabetical order first, and the values of each key in their order
+	combinations := []map[string]string{{}}
+	for _, key := range keys {
+		var next []map[string]string
+		for _, combination := range combinations {
+			for _, value := range matrix[key] {
+				env := map[string]string{key: value}
+				for k, v := range combination {
+					env[k] = v
+				}
+				next = append(next, env)
+			}
+		}
+		combinations = next
+	}
+
+	var expanded Checklist
+	for _, combination := range combinations {
+		var labels []string
+		for _, key := range keys {
+			labels = append(labels, fmt.Sprintf("%s=%s", key, combination[key]))
+		}
+		suffix := fmt.Sprintf(" [%s]", strings.Join(labels, ", "))
+		var values []string
+		for _, key := range keys {
+			values = append(values, rxNonIDChars.ReplaceAllString(combination[key], "_"))
+		}
+		idSuffix := "_" + strings.Join(values, "_")
+
+		// The references to the items of the checklist, by title and by id
+		refs := make(map[string]string)
+		for _, item := range checklist {
+			refs[item.Title] = item.Title + suffix
+			if item.ID != "" {
+				refs[item.ID] = item.ID + idSuffix
+			}
+		}
+		rewrite := func(ref string) string {
+			if combined, ok := refs[ref]; ok {
+				return combined
+			}
+			return ref
+		}
+
+		for _, item := range checklist {
+			item.Title += suffix
+			if item.ID != "" {
+				item.ID += idSuffix
+			}
+			item.Env = make(map[string]string)
+			for k, v := range combination {
+				item.Env[k] = v
+			}
+			var dependsOn []string
+			for _, ref := range item.DependsOn {
+				dependsOn = append(dependsOn, rewrite(ref))
+			}
+			item.DependsOn = dependsOn
+			if item.SkipIf != nil {
+				item.SkipIf = &ItemCondition{Item: rewrite(item.SkipIf.Item), Status: item.SkipIf.Status}
+			}
+			if item.RunIf != nil {
+				item.RunIf = &ItemCondition{Item: rewrite(item.RunIf.Item), Status: item.RunIf.Status}
+			}
+			expanded = append(expanded, item)
+		}
+	}
+
+	return expanded
+}
+
+/**
+ * Returns the stable reference of the item: its id, or its title if it has
+ * none
+ */
+func (item *ChecklistItem) Ref() string {
+	return firstNonEmpty(item.ID, item.Title)
+}
+
+/**
+ * Returns the names the other items and the saved files can refer to the
+ * item with: its title, and its id if it has one
+ */
+func (item *ChecklistItem) Refs() []string {
+	if item.ID == "" || item.ID == item.Title {
+		return []string{item.Title}
+	}
+	return []string{item.Title, item.ID}
+}
+
+/**
+ * Checks that the ids of the items are unique in the run, and that none of
+ * them is the title of another item
+ */
+func ValidateItemIDs(items []ChecklistItem) error {
+	ids := make(map[string]string)
+	titles := make(map[string]bool)
+	for _, item := range items {
+		titles[item.Title] = true
+	}
+	for _, item := range items {
+		if item.ID == "" {
+			continue
+		}
+		if other, ok := ids[item.ID]; ok {
+			return fmt.Errorf("Items '%s' and '%s' have the same id '%s'", other, item.Title, item.ID)
+		}
+		if item.ID != item.Title && titles[item.ID] {
+			return fmt.Errorf("The id of item '%s' is the title of another item '%s'", item.Title, item.ID)
+		}
+		ids[item.ID] = item.Title
+	}
+	return nil
+}
+
+/**
+ * Checks that the conditions of every item refer to an earlier item, by its
+ * title or its id, and to a known status
+ */
+func ValidateItemConditions(items []ChecklistItem) error {
+	if err := ValidateItemIDs(items); err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, item := range items {
+		for _, cond := range []*ItemCondition{item.SkipIf, item.RunIf} {
+			if cond == nil {
+				continue
+			}
+			if !seen[cond.Item] {
+				return fmt.Errorf("Item '%s' refers to '%s', which is not an earlier item", item.Title, cond.Item)
+			}
+			switch cond.Status {
+			case STATUS_PASS, STATUS_FAIL, STATUS_SKIP:
+			default:
+				return fmt.Errorf("Item '%s' refers to unknown status '%s'", item.Title, cond.Status)
+			}
+		}
+		for _, dep := range item.DependsOn {
+			if !seen[dep] {
+				return fmt.Errorf("Item '%s' depends on '%s', which is not an earlier item", item.Title, dep)
+			}
+		}
+		for _, ref := range item.Refs() {
+			seen[ref] = true
+		}
+	}
+	return nil
+}
+
+/**
+ * Returns the reason for skipping this item, given the statuses of the items
+ * that were already processed, or an empty string if it should run
+ */
+func (item *ChecklistItem) ConditionSkipReason(statuses map[string]string) string {
+	if item.DisabledIn != "" {
+		return fmt.Sprintf("SKIP (disabled in %s)", item.DisabledIn)
+	}
+	if item.SkipIf != nil && statuses[item.SkipIf.Item] == item.SkipIf.Status {
+		return fmt.Sprintf("SKIP ('%s' is %s)", item.SkipIf.Item, item.SkipIf.Status)
+	}
+	if item.RunIf != nil && statuses[item.RunIf.Item] != item.RunIf.Status {
+		return fmt.Sprintf("SKIP ('%s' is not %s)", item.RunIf.Item, item.RunIf.Status)
+	}
+	return ""
+}
+
+/**
+ * Returns the chain of items that led to the failure of a dependency of this
+ * item, from the item that failed to the dependency, or nil if none of them
+ * failed. The chains are given by the title and the id of every failed item,
+ * and of every item skipped because of a failed dependency.
+ */
+func (item *ChecklistItem) FailedDependency(chains map[string][]string) []string {
+	for _, dep := range item.DependsOn {
+		if chain, ok := chains[dep]; ok {
+			return chain
+		}
+	}
+	return nil
+}
+
+/**
+ * Checks if any of the items depends on another one
+ */
+func HasItemDependencies(items []ChecklistItem) bool {
+	for _, item := range items {
+		if len(item.DependsOn) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * Checks if the value is an http or https URL, for the documentation links
+ */
+func isDocURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+/**
+ * Checks if a failure of the item does not abort the run, because it is
+ * allowed or expected
+ */
+func (item *ChecklistItem) ToleratesFailure() bool {
+	return item.AllowFailure || item.ExpectFail
+}
+
+/**
+ * Checks if the item uses a built-in check instead of a script
+ */
+func (item *ChecklistItem) HasBuiltinCheck() bool {
+	return item.Files != nil || item.DNS != nil || item.Wait != nil || item.Service != nil || item.Cert != nil
+}
+
+/**
+ * Returns the weight of the item, defaulting to 1
+ */
+func (item *ChecklistItem) GetWeight() int {
+	if item.Weight <= 0 {
+		return 1
+	}
+	return item.Weight
+}
+
+/**
+ * Returns how long a passing result of the item can be re-used, or zero
+ */
+func (item *ChecklistItem) GetCacheTTL() time.Duration {
+	ttl, err := time.ParseDuration(item.CacheTTL)
+	if err != nil {
+		return 0
+	}
+	return ttl
+}
+
+/**
+ * Checks that the value is empty or a positive duration
+ */
+func ValidateDuration(value string) error {
+	if value == "" {
+		return nil
+	}
+	if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+		return fmt.Errorf("Invalid duration '%s' (expecting e.g. 500ms, 30s or 5m)", value)
+	}
+	return nil
+}
+
+/**
+ * Returns the timeout of the item scripts, or zero if they are unbounded
+ */
+func (item *ChecklistItem) GetTimeout() time.Duration {
+	timeout, _ := time.ParseDuration(item.Timeout)
+	return timeout
+}
+
+/**
+ * Checks that the soft timeout of the item is shorter than the given timeout
+ * it runs with, if any
+ */
+func (item *ChecklistItem) validateSoftTimeout(timeout string) error {
+	if item.SoftTimeout == "" || timeout == "" {
+		return nil
+	}
+	if limit, _ := time.ParseDuration(timeout); item.GetSoftTimeout() >= limit {
+		return fmt.Errorf("has a soft_timeout of %s, expecting less than its timeout of %s", item.SoftTimeout, timeout)
+	}
+	return nil
+}
+
+/**
+ * Returns the time after which the item scripts are reported as slow, or
+ * zero if they are never
+ */
+func (item *ChecklistItem) GetSoftTimeout() time.Duration {
+	timeout, _ := time.ParseDuration(item.SoftTimeout)
+	return timeout
+}
+
+/**
+ * Returns the number of times to retry a failed check
+ */
+func (item *ChecklistItem) GetRetries() int {
+	if item.Retries == nil {
+		return 0
+	}
+	return *item.Retries
+}
+
+/**
+ * Returns the time to wait before retrying a failed check
+ */
+func (item *ChecklistItem) GetRetryDelay() time.Duration {
+	delay, _ := time.ParseDuration(item.RetryDelay)
+	return delay
+}
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * Returns the checklist metadata as `key: value` pairs, sorted by key
+ */
+func (cf *ChecklistFile) MetaPairs() [][2]string {
+	var keys []string
+	for key := range cf.Meta {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs [][2]string
+	for _, key := range keys {
+		pairs = append(pairs, [2]string{key, fmt.Sprintf("%v", cf.Meta[key])})
+	}
+	return pairs
 }
@@ -0,0 +1,140 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+/**
+ * Loads the checklist files of the given YAML content, written to a
+ * temporary file
+ */
+func loadTestChecklist(t *testing.T, content string) []*ChecklistFile {
+	dir, err := ioutil.TempDir("", "preflighter-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "checklist.yaml")
+	if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	files, err := LoadChecklist(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestExpandTemplatesKeepsItemFields(t *testing.T) {
+	files := loadTestChecklist(t, `
+templates:
+  http_up:
+    title: "Is {{name}} reachable?"
+    script: curl -s "{{url}}"
+    expect: "^200$"
+    timeout: 10s
+    allow_failure: true
+
+checklist:
+  - id: first
+    title: First
+    script: echo ok
+    expect: ok
+  - use: http_up
+    with: {name: "the API", url: "https://api.example.com"}
+    id: api
+    depends_on: [first]
+    timeout: 30s
+`)
+	items := files[0].Checklist
+	if len(items) != 2 {
+		t.Fatalf("got %d items, want 2", len(items))
+	}
+	item := items[1]
+	if item.ID != "api" || len(item.DependsOn) != 1 || item.DependsOn[0] != "first" || item.Timeout != "30s" {
+		t.Errorf("the fields of the item were not kept: id %q, depends_on %v, timeout %q", item.ID, item.DependsOn, item.Timeout)
+	}
+	if item.Title != "Is the API reachable?" || item.Script != `curl -s "https://api.example.com"` || item.ExpectMatch != "^200$" || !item.AllowFailure {
+		t.Errorf("the fields of the template were not used: %+v", item)
+	}
+	if item.Use != "" || item.With != nil {
+		t.Errorf("the template is still referenced after the expansion")
+	}
+}
+
+func TestExpandMatrixIDsAndReferences(t *testing.T) {
+	files := loadTestChecklist(t, `
+matrix:
+  K: [a, b-c]
+
+checklist:
+  - id: first
+    title: First
+    script: echo ok
+    expect: ok
+  - title: Second
+    depends_on: [first]
+    skip_if: {item: First, status: fail}
+    script: echo ok
+    expect: ok
+`)
+	items := files[0].Checklist
+	if err := ValidateItemConditions(items); err != nil {
+		t.Fatalf("the expanded items are invalid: %s", err.Error())
+	}
+
+	cases := []struct {
+		id        string
+		title     string
+		dependsOn string
+		skipIf    string
+	}{
+		{"first_a", "First [K=a]", "", ""},
+		{"", "Second [K=a]", "first_a", "First [K=a]"},
+		{"first_b_c", "First [K=b-c]", "", ""},
+		{"", "Second [K=b-c]", "first_b_c", "First [K=b-c]"},
+	}
+	if len(items) != len(cases) {
+		t.Fatalf("got %d items, want %d", len(items), len(cases))
+	}
+	for i, c := range cases {
+		item := items[i]
+		if item.ID != c.id || item.Title != c.title {
+			t.Errorf("item %d: got (%q, %q), want (%q, %q)", i+1, item.ID, item.Title, c.id, c.title)
+		}
+		if c.dependsOn != "" && (len(item.DependsOn) != 1 || item.DependsOn[0] != c.dependsOn) {
+			t.Errorf("item %d: depends on %v, want [%s]", i+1, item.DependsOn, c.dependsOn)
+		}
+		if c.skipIf != "" && (item.SkipIf == nil || item.SkipIf.Item != c.skipIf) {
+			t.Errorf("item %d: skip_if %+v, want %s", i+1, item.SkipIf, c.skipIf)
+		}
+	}
+}
+
+func TestSoftTimeoutAgainstDefaultTimeout(t *testing.T) {
+	cases := []struct {
+		fileTimeout string
+		runTimeout  string
+		valid       bool
+	}{
+		{"", "", true},
+		{"", "30s", true},
+		{"", "5s", false},
+		{"5s", "30s", false},
+		{"30s", "5s", true},
+	}
+	for _, c := range cases {
+		config := &Config{Env: make(map[string]string), DefaultTimeout: c.runTimeout}
+		file := &ChecklistFile{
+			Filename:       "checklist.yaml",
+			DefaultTimeout: c.fileTimeout,
+			Checklist:      []ChecklistItem{{Title: "slow", SoftTimeout: "10s"}},
+		}
+		if err := config.AddChecklistFile(file); (err == nil) != c.valid {
+			t.Errorf("default_timeout %q, -timeout %q: got the error %v, expecting valid %v", c.fileTimeout, c.runTimeout, err, c.valid)
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package util
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"os/exec"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -12,13 +16,53 @@ type Config struct {
 	UserLib     string
 	UserTools   []string
 	UserTempDir string
+
+	// The unique ID of the run, given to the scripts to correlate their logs
+	RunID string
+
+	// Positional arguments passed to every script
+	ScriptArgs []string
+
+	// Give the items of every checklist file only the variables of their own
+	// file, instead of the variables of all the files merged together
+	IsolateEnv bool
+
+	// Where the passing results of the items with a cache TTL are kept
+	// across runs, or empty to disable the result cache
+	ResultCacheDir string
+
+	// The command that prefixes the scripts of the privileged items
+	SudoCommand string
+
+	// The number of bytes of every script output to capture, or 0 for all
+	MaxOutput int64
+
+	// Replace the golden files of the items with their output, instead of
+	// comparing against them
+	UpdateGolden bool
+
+	// The defaults of the items that don't define their own, nor have one
+	// in their checklist file
+	DefaultTimeout    string
+	DefaultRetries    int
+	DefaultRetryDelay string
+}
+
+/**
+ * Generates a unique ID for the run, sorted by time of the run
+ */
+func CreateRunID() string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
 }
 
 func CreateConfig() (*Config, error) {
 	config := &Config{
-		Env:       make(map[string]string),
-		UserLib:   "",
-		UserTools: nil,
+		Env:         make(map[string]string),
+		UserLib:     "",
+		UserTools:   nil,
+		SudoCommand: "sudo -E",
 	}
 
 	// Get the cluster URL
@@ -39,13 +83,64 @@ func CreateConfig() (*Config, error) {
 }
 
 func (c *Config) AddChecklistFile(f *ChecklistFile) error {
-	// Collect environment variables
-	if f.Env != nil {
+	// Collect environment variables. By default they are merged in a global
+	// map, where the files given later override the earlier ones.
+	if c.IsolateEnv {
+		for i := range f.Checklist {
+			env := make(map[string]string)
+			for name, value := range f.Env {
+				env[name] = value
+			}
+			for name, value := range f.Checklist[i].Env {
+				env[name] = value
+			}
+			f.Checklist[i].Env = env
+		}
+	} else {
 		for name, value := range f.Env {
 			c.Env[name] = value
 		}
 	}
 
+	err := f.selectVariant()
+	if err != nil {
+		return err
+	}
+
+	// Resolve the item defaults, from the checklist file or the global ones
+	for i := range f.Checklist {
+		item := &f.Checklist[i]
+		if item.Timeout == "" {
+			item.Timeout = firstNonEmpty(f.DefaultTimeout, c.DefaultTimeout)
+			if err := item.validateSoftTimeout(item.Timeout); err != nil {
+				return fmt.Errorf("Item '%s' in %s %s, from the default_timeout or -timeout", item.Title, f.Filename, err.Error())
+			}
+		}
+		if item.RetryDelay == "" {
+			item.RetryDelay = firstNonEmpty(f.DefaultRetryDelay, c.DefaultRetryDelay)
+		}
+		if item.RunbookFailureTemplate == "" {
+			item.RunbookFailureTemplate = f.RunbookFailureTemplate
+		}
+		if item.Umask == "" {
+			item.Umask = f.Umask
+		}
+		if item.Rlimits == nil {
+			item.Rlimits = f.Rlimits
+		}
+		if item.UnknownExitCode == nil {
+			item.UnknownExitCode = f.UnknownExitCode
+		}
+		item.FileMaxConcurrency = f.MaxConcurrency
+		if item.Retries == nil {
+			retries := f.DefaultRetries
+			if retries == 0 {
+				retries = c.DefaultRetries
+			}
+			item.Retries = &retries
+		}
+	}
+
 	// Pre-load library scripts
 	for _, lib := range f.Libs {
 		content, err := ioutil.ReadFile(lib)
@@ -60,9 +155,26 @@ func (c *Config) AddChecklistFile(f *ChecklistFile) error {
 	for _, tool := range f.RequireTools {
 		c.UserTools = append(c.UserTools, tool)
 	}
+	for _, item := range f.Checklist {
+		if interpreter := inlineCheckInterpreter(item.Lang); interpreter != nil && !containsString(c.UserTools, interpreter[0]) {
+			c.UserTools = append(c.UserTools, interpreter[0])
+		}
+		if item.Privileged && os.Geteuid() != 0 && !containsString(c.UserTools, "sudo") {
+			c.UserTools = append(c.UserTools, "sudo")
+		}
+	}
 	return nil
 }
 
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
 func (c *Config) GetEnvList() []string {
 	var list []string
 
@@ -0,0 +1,30 @@
+package util
+
+import (
+	"fmt"
+	"os"
+)
+
+/**
+ * @brief      Checks that the confirmation token of every checklist that
+ *             requires one was given, as a deliberate speed bump before
+ *             running the dangerous checklists. The tokens given are never
+ *             echoed.
+ *
+ * @param      files   The checklist files of the run
+ * @param      tokens  The tokens given with -token, along with the one of the
+ *                     PREFLIGHTER_TOKEN environment variable
+ *
+ * @return     The error of the first checklist whose token is missing
+ */
+func CheckRequiredTokens(files []*ChecklistFile, tokens []string) error {
+	if token := os.Getenv("PREFLIGHTER_TOKEN"); token != "" {
+		tokens = append(tokens, token)
+	}
+	for _, file := range files {
+		if file.RequireToken != "" && !containsString(tokens, file.RequireToken) {
+			return fmt.Errorf("%s requires the confirmation token %s: give -token %s, or set it in PREFLIGHTER_TOKEN, to run it", file.Filename, file.RequireToken, file.RequireToken)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// The time to wait for an answer, unless the check defines its own
+const dnsDefaultTimeout = 5 * time.Second
+
+/**
+ * A built-in check on the resolution of a hostname, performed without the
+ * platform tools
+ */
+type DNSCheck struct {
+	// The hostname to resolve
+	Name string
+
+	// The record type to look up: A (default), AAAA or CNAME
+	Type string
+
+	// One of the answers must be equal to this value
+	Expect string
+
+	// The address of the DNS server to query (e.g. 10.0.0.2:53), instead of
+	// the resolver of the system
+	Resolver string
+
+	// The time to wait for an answer (e.g. 2s)
+	Timeout string
+}
+
+/**
+ * Validates the definition of the check
+ */
+func (c *DNSCheck) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("Missing the name to resolve")
+	}
+	switch strings.ToUpper(c.Type) {
+	case "", "A", "AAAA", "CNAME":
+	default:
+		return fmt.Errorf("Unsupported record type %s (expecting A, AAAA or CNAME)", c.Type)
+	}
+	if c.Resolver != "" {
+		if _, _, err := net.SplitHostPort(c.Resolver); err != nil {
+			return fmt.Errorf("Invalid resolver %s (expecting host:port)", c.Resolver)
+		}
+	}
+	return ValidateDuration(c.Timeout)
+}
+
+func (c *DNSCheck) resolver() *net.Resolver {
+	if c.Resolver == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, c.Resolver)
+		},
+	}
+}
+
+/**
+ * Runs the check, returning the answers or an error with the resolver used
+ * and the full answer
+ */
+func (c *DNSCheck) Run() (string, error) {
+	timeout := dnsDefaultTimeout
+	if c.Timeout != "" {
+		timeout, _ = time.ParseDuration(c.Timeout)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	resolver := c.resolver()
+	recordType := strings.ToUpper(c.Type)
+	if recordType == "" {
+		recordType = "A"
+	}
+	server := c.Resolver
+	if server == "" {
+		server = "system resolver"
+	}
+
+	var answers []string
+	if recordType == "CNAME" {
+		cname, err := resolver.LookupCNAME(ctx, c.Name)
+		if err != nil {
+			return "", fmt.Errorf("Could not resolve %s %s with %s: %s", recordType, c.Name, server, err.Error())
+		}
+		answers = append(answers, cname)
+	} else {
+		addrs, err := resolver.LookupIPAddr(ctx, c.Name)
+		if err != nil {
+			return "", fmt.Errorf("Could not resolve %s %s with %s: %s", recordType, c.Name, server, err.Error())
+		}
+		var all []string
+		for _, addr := range addrs {
+			all = append(all, addr.IP.String())
+			if (addr.IP.To4() != nil) == (recordType == "A") {
+				answers = append(answers, addr.IP.String())
+			}
+		}
+		if len(answers) == 0 {
+			return "", fmt.Errorf("No %s records for %s with %s (answer: %s)", recordType, c.Name, server, strings.Join(all, ", "))
+		}
+	}
+
+	value := strings.Join(answers, ", ")
+	if c.Expect != "" {
+		found := false
+		for _, answer := range answers {
+			if strings.TrimSuffix(answer, ".") == strings.TrimSuffix(c.Expect, ".") {
+				found = true
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("%s %s resolves to %s with %s, expecting %s", recordType, c.Name, value, server, c.Expect)
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,284 @@
+package util
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+type envFilter func(string) (string, error)
+
+// The filters that can be applied to the output of a `${...}` env command
+var envFilters = map[string]func(arg string) envFilter{
+	"lower": func(arg string) envFilter {
+		return func(v string) (string, error) { return strings.ToLower(v), nil }
+	},
+	"upper": func(arg string) envFilter {
+		return func(v string) (string, error) { return strings.ToUpper(v), nil }
+	},
+	"trim": func(arg string) envFilter {
+		return func(v string) (string, error) { return strings.TrimSpace(v), nil }
+	},
+	"trimprefix": func(arg string) envFilter {
+		return func(v string) (string, error) { return strings.TrimPrefix(v, arg), nil }
+	},
+	"trimsuffix": func(arg string) envFilter {
+		return func(v string) (string, error) { return strings.TrimSuffix(v, arg), nil }
+	},
+	"base64": func(arg string) envFilter {
+		return func(v string) (string, error) { return base64.StdEncoding.EncodeToString([]byte(v)), nil }
+	},
+	"base64decode": func(arg string) envFilter {
+		return func(v string) (string, error) {
+			out, err := base64.StdEncoding.DecodeString(v)
+			if err != nil {
+				return "", fmt.Errorf("Could not base64-decode value: %s", err.Error())
+			}
+			return string(out), nil
+		}
+	},
+}
+
+type EnvCommand struct {
+	Command string
+	filters []envFilter
+}
+
+/**
+ * Parses an env value in the form `${command} | filter | filter:arg ...`
+ */
+func ParseEnvCommand(value string) (*EnvCommand, error) {
+	end := -1
+	if strings.HasPrefix(value, "${") {
+		end = closingBrace(value, 2)
+	}
+	if end < 0 {
+		return nil, fmt.Errorf("Expecting a command in the form ${...}, got '%s'", value)
+	}
+
+	envCmd := &EnvCommand{
+		Command: value[2:end],
+	}
+
+	rest := strings.TrimSpace(value[end+1:])
+	if rest == "" {
+		return envCmd, nil
+	}
+	if !strings.HasPrefix(rest, "|") {
+		return nil, fmt.Errorf("Unexpected '%s' after command", rest)
+	}
+
+	for _, part := range strings.Split(rest[1:], "|") {
+		name := strings.TrimSpace(part)
+		arg := ""
+		if idx := strings.Index(name, ":"); idx >= 0 {
+			arg = name[idx+1:]
+			name = name[:idx]
+		}
+
+		filter, ok := envFilters[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown filter '%s'", name)
+		}
+		envCmd.filters = append(envCmd.filters, filter(arg))
+	}
+
+	return envCmd, nil
+}
+
+/**
+ * Returns the index of the brace that closes the one before `start`, skipping
+ * the nested and the quoted braces of the command, or -1 if it is not closed
+ */
+func closingBrace(value string, start int) int {
+	depth := 0
+	var quote byte
+	for i := start; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i += 1
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\\':
+			i += 1
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '{':
+			depth += 1
+		case c == '}':
+			if depth == 0 {
+				return i
+			}
+			depth -= 1
+		}
+	}
+	return -1
+}
+
+/**
+ * Applies all the filters to the given command output
+ */
+func (c *EnvCommand) Filter(value string) (string, error) {
+	var err error
+	for _, filter := range c.filters {
+		value, err = filter(value)
+		if err != nil {
+			return "", err
+		}
+	}
+	return value, nil
+}
+
+// The forms of the values of the checklist variables
+const ENV_LITERAL = "literal"
+const ENV_REQUIRED = "required"
+const ENV_DEFAULT = "default"
+const ENV_COMMAND = "command"
+
+/**
+ * The value of a checklist variable, parsed from its definition:
+ *
+ *   <                    required from the environment, handled as a secret
+ *   <default             from the environment, or the default if empty
+ *   ${command} | filter  the output of the command, through the filters
+ *   \<text, \$text       the literal text after the first backslash
+ *   ${                   an empty value
+ *
+ * Any other value is literal, including the ones that start with backslashes
+ * that are not followed by `<` or `$`.
+ */
+type EnvValue struct {
+	Kind string
+
+	// The literal value, or the default
+	Text string
+
+	Command *EnvCommand
+}
+
+/**
+ * Parses the definition of a checklist variable
+ */
+func ParseEnvValue(value string) (*EnvValue, error) {
+	switch {
+	case isEscapedEnvValue(value):
+		return &EnvValue{Kind: ENV_LITERAL, Text: value[1:]}, nil
+	case value == "<":
+		return &EnvValue{Kind: ENV_REQUIRED}, nil
+	case strings.HasPrefix(value, "<"):
+		return &EnvValue{Kind: ENV_DEFAULT, Text: value[1:]}, nil
+	case value == "${":
+		return &EnvValue{Kind: ENV_LITERAL}, nil
+	case strings.HasPrefix(value, "${"):
+		envCmd, err := ParseEnvCommand(value)
+		if err != nil {
+			return nil, err
+		}
+		return &EnvValue{Kind: ENV_COMMAND, Command: envCmd}, nil
+	}
+	return &EnvValue{Kind: ENV_LITERAL, Text: value}, nil
+}
+
+/**
+ * Returns whether the value starts with backslashes followed by `<` or `$`
+ */
+func isEscapedEnvValue(value string) bool {
+	rest := strings.TrimLeft(value, "\\")
+	return len(rest) < len(value) && (strings.HasPrefix(rest, "<") || strings.HasPrefix(rest, "$"))
+}
+
+/**
+ * Parses `KEY=value` lines, as emitted by tools that print environment
+ * definitions. Values can be single- or double-quoted and span multiple lines.
+ */
+func ParseEnvOutput(text string) (map[string]string, error) {
+	env := make(map[string]string)
+	lineNo := 1
+	for len(text) > 0 {
+		// Take the next line
+		line := text
+		if idx := strings.IndexByte(text, '\n'); idx >= 0 {
+			line = text[:idx]
+			text = text[idx+1:]
+		} else {
+			text = ""
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			lineNo += 1
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		eq := strings.IndexByte(line, '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("Line %d: expecting KEY=value, got '%s'", lineNo, line)
+		}
+		key := strings.TrimSpace(line[:eq])
+		value := line[eq+1:]
+
+		// Quoted values continue until the closing quote, even across lines
+		if len(value) > 0 && (value[0] == '"' || value[0] == '\'') {
+			quote := value[0]
+			raw := value[1:]
+			for !hasClosingQuote(raw, quote) {
+				if text == "" {
+					return nil, fmt.Errorf("Line %d: unterminated quote in the value of %s", lineNo, key)
+				}
+				if idx := strings.IndexByte(text, '\n'); idx >= 0 {
+					raw += "\n" + text[:idx]
+					text = text[idx+1:]
+				} else {
+					raw += "\n" + text
+					text = ""
+				}
+				lineNo += 1
+			}
+			value = unquoteEnvValue(raw, quote)
+		}
+
+		env[key] = value
+		lineNo += 1
+	}
+
+	return env, nil
+}
+
+func hasClosingQuote(raw string, quote byte) bool {
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '\\' && quote == '"' {
+			i += 1
+		} else if raw[i] == quote {
+			return true
+		}
+	}
+	return false
+}
+
+func unquoteEnvValue(raw string, quote byte) string {
+	var out strings.Builder
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if c == quote {
+			break
+		}
+		if c == '\\' && quote == '"' && i+1 < len(raw) {
+			i += 1
+			switch raw[i] {
+			case 'n':
+				out.WriteByte('\n')
+			case 't':
+				out.WriteByte('\t')
+			default:
+				out.WriteByte(raw[i])
+			}
+			continue
+		}
+		out.WriteByte(c)
+	}
+	return out.String()
+}
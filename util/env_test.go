@@ -0,0 +1,90 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestParseEnvValue(t *testing.T) {
+	cases := []struct {
+		value   string
+		kind    string
+		text    string
+		command string
+	}{
+		{"<", ENV_REQUIRED, "", ""},
+		{"<default", ENV_DEFAULT, "default", ""},
+		// Changed: the values starting with < used to be literal, they
+		// must now be escaped as below to stay literal
+		{"<html>", ENV_DEFAULT, "html>", ""},
+		{"${echo Hello}", ENV_COMMAND, "", "echo Hello"},
+		{"${echo Hello} | lower", ENV_COMMAND, "", "echo Hello"},
+		{"${echo {a,b}} | trim", ENV_COMMAND, "", "echo {a,b}"},
+		{"${echo '}'}", ENV_COMMAND, "", "echo '}'"},
+		{"${echo \\}}", ENV_COMMAND, "", "echo \\}"},
+		{"${", ENV_LITERAL, "", ""},
+		{"\\<html>", ENV_LITERAL, "<html>", ""},
+		{"\\$HOME", ENV_LITERAL, "$HOME", ""},
+		{"\\${echo}", ENV_LITERAL, "${echo}", ""},
+		{"\\\\<", ENV_LITERAL, "\\<", ""},
+		{"\\n", ENV_LITERAL, "\\n", ""},
+		{"plain", ENV_LITERAL, "plain", ""},
+		{"a<b", ENV_LITERAL, "a<b", ""},
+		{"$HOME", ENV_LITERAL, "$HOME", ""},
+		{"", ENV_LITERAL, "", ""},
+	}
+	for _, c := range cases {
+		parsed, err := ParseEnvValue(c.value)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", c.value, err.Error())
+			continue
+		}
+		if parsed.Kind != c.kind || parsed.Text != c.text {
+			t.Errorf("%q: got (%s, %q), want (%s, %q)", c.value, parsed.Kind, parsed.Text, c.kind, c.text)
+		}
+		command := ""
+		if parsed.Command != nil {
+			command = parsed.Command.Command
+		}
+		if command != c.command {
+			t.Errorf("%q: got the command %q, want %q", c.value, command, c.command)
+		}
+	}
+}
+
+func TestParseEnvValueFilters(t *testing.T) {
+	cases := []struct {
+		value  string
+		output string
+		want   string
+	}{
+		{"${cmd}", " Hello ", " Hello "},
+		{"${cmd} | lower", "Hello", "hello"},
+		{"${cmd} | trim | upper", " Hello\n", "HELLO"},
+		{"${cmd} | trimprefix:v", "v1.2", "1.2"},
+		{"${cmd} | base64", "Hello", "SGVsbG8="},
+		{"${cmd} | base64decode", "SGVsbG8=", "Hello"},
+		{"${cmd} | trimsuffix:}", "a}", "a"},
+		{"${cmd} | trimprefix:{ | trimsuffix:}", "{a}", "a"},
+	}
+	for _, c := range cases {
+		parsed, err := ParseEnvValue(c.value)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", c.value, err.Error())
+			continue
+		}
+		got, err := parsed.Command.Filter(c.output)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", c.value, err.Error())
+		} else if got != c.want {
+			t.Errorf("%q: got %q, want %q", c.value, got, c.want)
+		}
+	}
+}
+
+func TestParseEnvValueErrors(t *testing.T) {
+	for _, value := range []string{"${echo", "${echo '}", "${echo} lower", "${echo} | unknown"} {
+		if _, err := ParseEnvValue(value); err == nil {
+			t.Errorf("%q: expecting an error", value)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package util
+
+import "os"
+
+// The exit codes of the process, by class of outcome
+const EXIT_SUCCESS = 0
+const EXIT_CHECKS_FAILED = 1
+const EXIT_CONFIG_ERROR = 2
+const EXIT_MISSING_TOOLS = 3
+const EXIT_ENVIRONMENT_ERROR = 4
+
+// Exit with 1 on any failure, as the earlier versions did
+var legacyExitCodes = false
+
+/**
+ * Exits with a code of the given outcome class, or with 1 for any failure
+ * if the legacy exit codes are enabled
+ */
+func Exit(code int) {
+	UxStopClock()
+	stopProfiling()
+	if legacyExitCodes && code != EXIT_SUCCESS {
+		code = 1
+	}
+	os.Exit(code)
+}
+
+func SetLegacyExitCodes(enabled bool) {
+	legacyExitCodes = enabled
+}
@@ -0,0 +1,98 @@
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The parts of an error line that differ between occurrences of the same
+// error: quoted strings, addresses and numbers
+var rxErrorDetails = regexp.MustCompile(`"[^"]*"|'[^']*'|\b0x[0-9a-fA-F]+\b|[0-9]+`)
+
+/**
+ * The failed items that share a category or an error, with the
+ * remediation of each of them
+ */
+type FailureGroup struct {
+	// The category of the items, or the error they have in common
+	Category string
+	Pattern  string
+
+	// The failed items, with their number in the run
+	Numbers []int
+	Results []*ItemResult
+}
+
+/**
+ * Returns the line that describes the error of the failed item, with the
+ * details that differ between occurrences replaced, so that the items
+ * failing the same way have the same pattern
+ */
+func failurePattern(result *ItemResult) string {
+	line := ""
+	for _, text := range []string{result.Stderr, result.Value} {
+		lines := strings.Split(strings.TrimSpace(text), "\n")
+		if line = strings.TrimSpace(lines[len(lines)-1]); line != "" {
+			break
+		}
+	}
+	if line == "" {
+		return ""
+	}
+	return rxErrorDetails.ReplaceAllStringFunc(line, func(s string) string {
+		if s[0] == '"' || s[0] == '\'' {
+			return s[:1] + "…" + s[:1]
+		}
+		return "N"
+	})
+}
+
+/**
+ * @brief      Groups the failed items of the run for triage: by category
+ *             when they have one, or by the pattern of the last line of
+ *             their error output otherwise
+ *
+ * @return     The groups, in the order of their first failed item
+ */
+func (s *RunSummary) FailureGroups() []*FailureGroup {
+	var groups []*FailureGroup
+	byKey := make(map[string]*FailureGroup)
+	for i, result := range s.Results {
+		if result.Status != STATUS_FAIL && !result.Unknown {
+			continue
+		}
+		group := &FailureGroup{Category: result.Item.Category}
+		if group.Category == "" {
+			group.Pattern = failurePattern(result)
+		}
+		key := group.Category + "\x00" + group.Pattern
+		if existing, ok := byKey[key]; ok {
+			group = existing
+		} else {
+			byKey[key] = group
+			groups = append(groups, group)
+		}
+		group.Numbers = append(group.Numbers, i+1)
+		group.Results = append(group.Results, result)
+	}
+	return groups
+}
+
+/**
+ * Returns the title of the group, e.g. "network (2 items)"
+ */
+func (g *FailureGroup) Title() string {
+	title := g.Category
+	switch {
+	case title != "":
+	case g.Pattern != "":
+		title = fmt.Sprintf("Failing with \"%s\"", g.Pattern)
+	default:
+		title = "Failing without any output"
+	}
+	if len(g.Results) == 1 {
+		return title + " (1 item)"
+	}
+	return fmt.Sprintf("%s (%d items)", title, len(g.Results))
+}
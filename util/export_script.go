@@ -0,0 +1,212 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+/**
+ * Quotes the value for bash
+ */
+func shellQuote(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+/**
+ * Returns the given script as a bash heredoc that is assigned to a variable
+ */
+func exportHeredoc(name string, script string) string {
+	return fmt.Sprintf("%s=$(cat <<'PREFLIGHTER_EOF'\n%s\nPREFLIGHTER_EOF\n)\n", name, strings.TrimRight(script, "\n"))
+}
+
+/**
+ * Returns the variable assignment, or a reference to the variable of the
+ * environment the script runs in if it is a secret
+ */
+func exportVariable(key string, value string, secrets map[string]bool) string {
+	if secrets[key] {
+		return fmt.Sprintf(": \"${%s:?Missing required %s environment variable}\"\nexport %s\n", key, key, key)
+	}
+	return fmt.Sprintf("export %s=%s\n", key, shellQuote(value))
+}
+
+const exportScriptHeader = `#!/usr/bin/env bash
+#
+# Pre-flight checks, generated by preflighter on %s
+#
+# Usage: %s [args...]
+
+export LC_ALL=C
+`
+
+const exportScriptFunctions = `
+PF_PASSED=0
+PF_FAILED=0
+PF_WARNINGS=0
+PF_SKIPPED=0
+
+# Runs the given script with the library, the variables of the item and the
+# arguments, through the commands of the item (sudo, timeout and limits)
+function pf_run() {
+  printf '%s\n%s\n' "$PF_LIB" "$1" | "${PF_PREFIX[@]}" env "${PF_ENV[@]}" bash -s -- "${PF_ARGS[@]}"
+}
+
+# Starts the variables of an item that runs in a clean environment, with
+# only the variables of the checklists, PATH and HOME
+function pf_clean_env() {
+  PF_ENV=(-i "PATH=$PATH" "HOME=$HOME" "LC_ALL=$LC_ALL" "CACHE_DIR=$CACHE_DIR" "PREFLIGHTER_SHARED_DIR=$PREFLIGHTER_SHARED_DIR" "PREFLIGHTER_ARGS=$PREFLIGHTER_ARGS")
+  for pf_var in "${PF_VARS[@]}"; do
+    PF_ENV+=("$pf_var=${!pf_var}")
+  done
+}
+
+# Reports the outcome of an item: <title> <ok> <value> <allow failure>
+function pf_result() {
+  if [ "$2" -eq 1 ]; then
+    PF_PASSED=$((PF_PASSED+1))
+    printf ' [PASS] %s: %s\n' "$1" "$3"
+  elif [ "$4" -eq 1 ]; then
+    PF_WARNINGS=$((PF_WARNINGS+1))
+    printf ' [WARN] %s: %s\n' "$1" "$3"
+  else
+    PF_FAILED=$((PF_FAILED+1))
+    printf ' [FAIL] %s: %s\n' "$1" "$3"
+  fi
+}
+
+PF_ARGS=("$@")
+PF_ENV=()
+PF_PREFIX=()
+export PREFLIGHTER_ARGS="$*"
+export CACHE_DIR=$(mktemp -d)
+export PREFLIGHTER_SHARED_DIR="$CACHE_DIR/shared"
+mkdir -p "$PREFLIGHTER_SHARED_DIR"
+trap 'rm -rf "$CACHE_DIR"' EXIT
+`
+
+const exportScriptFooter = `
+echo
+echo "Passed: $PF_PASSED, Failed: $PF_FAILED, Warnings: $PF_WARNINGS, Skipped: $PF_SKIPPED"
+[ $PF_FAILED -eq 0 ]
+`
+
+/**
+ * Returns the commands that the script of the item runs through: sudo for
+ * the privileged items, then its timeout, then its umask and limits
+ */
+func exportItemPrefix(item *ChecklistItem, config *Config) string {
+	script := "PF_PREFIX=()\n"
+	if item.Privileged {
+		var sudo []string
+		for _, word := range strings.Fields(config.SudoCommand) {
+			sudo = append(sudo, shellQuote(word))
+		}
+		script += fmt.Sprintf("[ \"$(id -u)\" -eq 0 ] || PF_PREFIX+=(%s)\n", strings.Join(sudo, " "))
+	}
+	if timeout := item.GetTimeout(); timeout > 0 {
+		script += fmt.Sprintf("PF_PREFIX+=(timeout -s KILL %g)\n", timeout.Seconds())
+	}
+	if prelude := limitsPrelude(item.Umask, item.Rlimits); prelude != "" {
+		script += fmt.Sprintf("PF_PREFIX+=(bash -c %s preflighter)\n", shellQuote(prelude))
+	}
+	return script
+}
+
+/**
+ * Returns the bash commands that check the item and report its outcome
+ */
+func exportItem(index int, item *ChecklistItem, config *Config, secrets map[string]bool) string {
+	title := shellQuote(item.Title)
+	script := fmt.Sprintf("\n# %d. %s\n", index, item.Title)
+
+	// The conditions need the outcome of the other items, which the script
+	// does not track
+	conditional := item.SkipIf != nil || item.RunIf != nil || len(item.DependsOn) > 0
+	if conditional || item.HasBuiltinCheck() || item.JUnitOutput != "" || item.GoldenFile != "" || len(item.ExpectJSON) > 0 || inlineCheckInterpreter(item.Lang) != nil {
+		return script + fmt.Sprintf("PF_SKIPPED=$((PF_SKIPPED+1))\nprintf ' [SKIP] %%s: %%s\\n' %s 'Not supported in exported scripts'\n", title)
+	}
+
+	var env []string
+	for _, key := range sortedKeys(item.Env) {
+		if secrets[key] {
+			script += fmt.Sprintf(": \"${%s:?Missing required %s environment variable}\"\n", key, key)
+			env = append(env, fmt.Sprintf("\"%s=$%s\"", key, key))
+		} else {
+			env = append(env, shellQuote(key+"="+item.Env[key]))
+		}
+	}
+	if item.Locale != "" {
+		env = append(env, shellQuote("LC_ALL="+item.Locale))
+	}
+	if item.CleanEnv {
+		script += fmt.Sprintf("pf_clean_env\nPF_ENV+=(%s)\n", strings.Join(env, " "))
+	} else {
+		script += fmt.Sprintf("PF_ENV=(%s)\n", strings.Join(env, " "))
+	}
+	script += exportItemPrefix(item, config)
+	script += exportHeredoc("pf_script", item.Script)
+	script += "pf_value=$(pf_run \"$pf_script\")\npf_code=$?\npf_ok=1\n"
+
+	expectCode := 0
+	if item.ExpectExitCode != nil {
+		expectCode = *item.ExpectExitCode
+	}
+	script += fmt.Sprintf("[ $pf_code -eq %d ] || pf_ok=0\n", expectCode)
+	if item.ExpectMatch != "" {
+		script += fmt.Sprintf("printf '%%s' \"$pf_value\" | grep -Eq %s || pf_ok=0\n", shellQuote(item.ExpectMatch))
+	}
+	if item.ExpectMin != nil {
+		script += fmt.Sprintf("awk -v v=\"$pf_value\" 'BEGIN { exit !(v ~ /^ *-?[0-9.]+ *$/ && v+0 >= %v) }' || pf_ok=0\n", *item.ExpectMin)
+	}
+	if item.ExpectMax != nil {
+		script += fmt.Sprintf("awk -v v=\"$pf_value\" 'BEGIN { exit !(v ~ /^ *-?[0-9.]+ *$/ && v+0 <= %v) }' || pf_ok=0\n", *item.ExpectMax)
+	}
+	if item.ExpectScript != "" {
+		script += exportHeredoc("pf_expect", item.ExpectScript)
+		script += "[ $pf_ok -eq 0 ] || VALUE=\"$pf_value\" pf_run \"$pf_expect\" >/dev/null || pf_ok=0\n"
+	}
+
+	allowFailure := 0
+	if item.ToleratesFailure() {
+		allowFailure = 1
+	}
+	script += fmt.Sprintf("pf_result %s $pf_ok \"$pf_value\" %d\n", title, allowFailure)
+	return script
+}
+
+/**
+ * @brief      Writes a standalone bash script that performs the checks of the
+ *             items and prints their outcome, for the hosts where preflighter
+ *             cannot be installed
+ *
+ * @param      filename       The file to write the script to
+ * @param      items          The items to check
+ * @param      config         The configuration with the resolved variables
+ *                            and the library scripts
+ * @param      secrets        The variables to reference from the environment
+ *                            of the script instead of inlining, by name
+ *
+ * @return     Returns the error occurred or nil
+ */
+func WriteExportScript(filename string, items []ChecklistItem, config *Config, secrets map[string]bool) error {
+	script := fmt.Sprintf(exportScriptHeader, time.Now().Format(time.RFC3339), filename)
+	script += "\n"
+	for _, key := range sortedKeys(config.Env) {
+		script += exportVariable(key, config.Env[key], secrets)
+	}
+	script += fmt.Sprintf("PF_VARS=(%s)\n", strings.Join(sortedKeys(config.Env), " "))
+	script += "\n" + exportHeredoc("PF_LIB", BashLibrary+"\n"+config.UserLib)
+	script += exportScriptFunctions
+	for i := range items {
+		script += exportItem(i+1, &items[i], config, secrets)
+	}
+	script += exportScriptFooter
+
+	err := ioutil.WriteFile(filename, []byte(script), 0755)
+	if err != nil {
+		return fmt.Errorf("Could not write script %s: %s", filename, err.Error())
+	}
+	return nil
+}
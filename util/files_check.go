@@ -0,0 +1,109 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/**
+ * A built-in check on the freshness of files, against a reference file
+ */
+type FilesCheck struct {
+	// A glob pattern of the files to check
+	Path string
+
+	// The files must be modified after the reference file
+	NewerThan string `yaml:"newer_than"`
+
+	// The files must have the same content as the reference file
+	SameAs string `yaml:"same_as"`
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+/**
+ * Validates the definition of the check
+ */
+func (c *FilesCheck) Validate() error {
+	if c.Path == "" {
+		return fmt.Errorf("Missing the path of the files to check")
+	}
+	if _, err := filepath.Match(c.Path, ""); err != nil {
+		return fmt.Errorf("Invalid path pattern %s: %s", c.Path, err.Error())
+	}
+	if (c.NewerThan == "") == (c.SameAs == "") {
+		return fmt.Errorf("Expecting exactly one of newer_than or same_as")
+	}
+	return nil
+}
+
+/**
+ * Runs the check, returning a description of the files that were checked or
+ * an error describing the stale ones
+ */
+func (c *FilesCheck) Run() (string, error) {
+	paths, err := filepath.Glob(c.Path)
+	if err != nil {
+		return "", fmt.Errorf("Invalid path pattern %s: %s", c.Path, err.Error())
+	}
+	if len(paths) == 0 {
+		return "", fmt.Errorf("No files match %s", c.Path)
+	}
+
+	var stale []string
+	if c.NewerThan != "" {
+		ref, err := os.Stat(c.NewerThan)
+		if err != nil {
+			return "", fmt.Errorf("Could not check reference %s: %s", c.NewerThan, err.Error())
+		}
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				return "", fmt.Errorf("Could not check %s: %s", path, err.Error())
+			}
+			if !info.ModTime().After(ref.ModTime()) {
+				stale = append(stale, fmt.Sprintf("%s (modified %s)", path, info.ModTime().Format("2006-01-02 15:04:05")))
+			}
+		}
+		if len(stale) > 0 {
+			return "", fmt.Errorf("Stale files, not modified after %s (%s): %s",
+				c.NewerThan, ref.ModTime().Format("2006-01-02 15:04:05"), strings.Join(stale, ", "))
+		}
+		return fmt.Sprintf("%d files newer than %s", len(paths), c.NewerThan), nil
+	}
+
+	ref, err := fileSHA256(c.SameAs)
+	if err != nil {
+		return "", fmt.Errorf("Could not check reference %s: %s", c.SameAs, err.Error())
+	}
+	for _, path := range paths {
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return "", fmt.Errorf("Could not check %s: %s", path, err.Error())
+		}
+		if sum != ref {
+			stale = append(stale, path)
+		}
+	}
+	if len(stale) > 0 {
+		return "", fmt.Errorf("Files differ from %s: %s", c.SameAs, strings.Join(stale, ", "))
+	}
+	return fmt.Sprintf("%d files same as %s", len(paths), c.SameAs), nil
+}
@@ -0,0 +1,116 @@
+package util
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+/**
+ * A repeatable command-line flag that collects `key=value` pairs
+ */
+type KeyValueFlag map[string]string
+
+func (f KeyValueFlag) String() string {
+	var pairs []string
+	for k, v := range f {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f KeyValueFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("Expecting key=value, got '%s'", value)
+	}
+	f[parts[0]] = parts[1]
+	return nil
+}
+
+/**
+ * A repeatable command-line flag that collects its values in order
+ */
+type StringListFlag []string
+
+func (f *StringListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *StringListFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+/**
+ * Leaves the given flags out of the usage, for the ones meant for the
+ * developers of preflighter
+ */
+func HideFlags(names ...string) {
+	hidden := make(map[string]bool)
+	for _, name := range names {
+		hidden[name] = true
+	}
+	flag.Usage = func() {
+		visible := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+		visible.SetOutput(flag.CommandLine.Output())
+		flag.VisitAll(func(f *flag.Flag) {
+			if !hidden[f.Name] {
+				visible.Var(f.Value, f.Name, f.Usage)
+				visible.Lookup(f.Name).DefValue = f.DefValue
+			}
+		})
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
+		visible.PrintDefaults()
+	}
+}
+
+/**
+ * The flags that can be given with an environment variable instead, for
+ * pipelines that are configured through their environment
+ */
+var envFlags = [][2]string{
+	{"s", "PREFLIGHTER_SKIP"},
+	{"a", "PREFLIGHTER_AUTO"},
+	{"v", "PREFLIGHTER_VERBOSE"},
+	{"compact", "PREFLIGHTER_COMPACT"},
+	{"summary-only", "PREFLIGHTER_SUMMARY_ONLY"},
+	{"github-output", "PREFLIGHTER_GITHUB_OUTPUT"},
+	{"no-color", "PREFLIGHTER_NO_COLOR"},
+	{"fail-on-warning", "PREFLIGHTER_FAIL_ON_WARNING"},
+	{"timeout", "PREFLIGHTER_TIMEOUT"},
+	{"retries", "PREFLIGHTER_RETRIES"},
+	{"env-name", "PREFLIGHTER_ENV_NAME"},
+	{"run-id", "PREFLIGHTER_RUN_ID"},
+	{"html", "PREFLIGHTER_HTML"},
+	{"output-dir", "PREFLIGHTER_OUTPUT_DIR"},
+	{"heartbeat", "PREFLIGHTER_HEARTBEAT"},
+	{"format", "PREFLIGHTER_FORMAT"},
+	{"j", "PREFLIGHTER_JOBS"},
+}
+
+/**
+ * Sets the flags that were not given in the command-line from their
+ * environment variable, if defined
+ */
+func ApplyEnvFlags(fs *flag.FlagSet) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	for _, pair := range envFlags {
+		name, key := pair[0], pair[1]
+		value, ok := os.LookupEnv(key)
+		if !ok || given[name] || fs.Lookup(name) == nil {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("Invalid value '%s' of %s: %s", value, key, err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package util
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+/**
+ * Returns the YAML keys of the fields of the struct type, with their types
+ */
+func yamlFields(t reflect.Type) ([]string, map[string]reflect.Type) {
+	var keys []string
+	types := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if key == "-" || field.PkgPath != "" {
+			continue
+		}
+		if key == "" {
+			key = strings.ToLower(field.Name)
+		}
+		keys = append(keys, key)
+		types[key] = field.Type
+	}
+	return keys, types
+}
+
+/**
+ * Orders the keys of the mappings in the value as the fields of the given
+ * type, with the unknown keys sorted after them, and the keys of free-form
+ * mappings sorted alphabetically
+ */
+func canonicalYAML(value interface{}, t reflect.Type) interface{} {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		var order map[string]int
+		var types map[string]reflect.Type
+		var elem reflect.Type
+		if t != nil && t.Kind() == reflect.Struct {
+			var keys []string
+			keys, types = yamlFields(t)
+			order = make(map[string]int)
+			for i, key := range keys {
+				order[key] = i
+			}
+		} else if t != nil && t.Kind() == reflect.Map {
+			elem = t.Elem()
+		}
+
+		rank := func(item yaml.MapItem) (int, string) {
+			key := fmt.Sprintf("%v", item.Key)
+			if i, ok := order[key]; ok {
+				return i, key
+			}
+			return len(order), key
+		}
+		sorted := append(yaml.MapSlice{}, v...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			ri, ki := rank(sorted[i])
+			rj, kj := rank(sorted[j])
+			if ri != rj {
+				return ri < rj
+			}
+			return ki < kj
+		})
+		for i := range sorted {
+			childType := elem
+			if types != nil {
+				childType = types[fmt.Sprintf("%v", sorted[i].Key)]
+			}
+			sorted[i].Value = canonicalYAML(sorted[i].Value, childType)
+		}
+		return sorted
+
+	case []interface{}:
+		var elem reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			elem = t.Elem()
+		}
+		for i := range v {
+			v[i] = canonicalYAML(v[i], elem)
+		}
+	}
+	return value
+}
+
+/**
+ * Rewrites the content of a checklist file in its canonical form, with the
+ * keys in a stable order and a consistent indentation. The comments are not
+ * preserved.
+ */
+func FormatChecklist(content []byte) ([]byte, error) {
+	var doc yaml.MapSlice
+	err := yaml.Unmarshal(content, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := yaml.Marshal(canonicalYAML(doc, reflect.TypeOf(ChecklistFile{})))
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
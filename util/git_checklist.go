@@ -0,0 +1,111 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const GIT_CHECKLIST_PREFIX = "git:"
+
+// A ref that names a single commit, so its clone never changes
+var gitCommitRef = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+/**
+ * A checklist file in a git repository, given as `git:<repo>//<path>@<ref>`
+ */
+type GitChecklistRef struct {
+	Repo string
+	Path string
+	Ref  string
+}
+
+/**
+ * Parses a `git:https://host/repo.git//path/to/file.yaml@ref` argument. The
+ * ref is optional and defaults to the HEAD of the repository.
+ */
+func ParseGitChecklistRef(arg string) (*GitChecklistRef, error) {
+	rest := strings.TrimPrefix(arg, GIT_CHECKLIST_PREFIX)
+	start := 0
+	if idx := strings.Index(rest, "://"); idx >= 0 {
+		start = idx + 3
+	}
+	sep := strings.Index(rest[start:], "//")
+	if sep < 0 {
+		return nil, fmt.Errorf("Invalid git checklist %s (expecting git:<repo>//<path>@<ref>)", arg)
+	}
+
+	ref := &GitChecklistRef{
+		Repo: rest[:start+sep],
+		Path: rest[start+sep+2:],
+		Ref:  "HEAD",
+	}
+	if idx := strings.LastIndex(ref.Path, "@"); idx >= 0 {
+		ref.Ref = ref.Path[idx+1:]
+		ref.Path = ref.Path[:idx]
+	}
+	if ref.Repo == "" || ref.Path == "" || ref.Ref == "" {
+		return nil, fmt.Errorf("Invalid git checklist %s (expecting git:<repo>//<path>@<ref>)", arg)
+	}
+	// Keep git from taking them for options
+	if strings.HasPrefix(ref.Repo, "-") || strings.HasPrefix(ref.Ref, "-") {
+		return nil, fmt.Errorf("Invalid git checklist %s (the repository and the ref cannot start with '-')", arg)
+	}
+	return ref, nil
+}
+
+/**
+ * @brief      Fetches the ref of the repository into a clone under the cache
+ *             directory, re-using an earlier clone of the same repository
+ *             and ref, and returns the path of the checklist file in it
+ *
+ * @param      ref       The git checklist reference
+ * @param      cacheDir  The directory to keep the clones in
+ *
+ * @return     Returns the path of the checklist file, or the error occurred
+ */
+func FetchGitChecklist(ref *GitChecklistRef, cacheDir string) (string, error) {
+	hash := sha256.Sum256([]byte(ref.Repo + "@" + ref.Ref))
+	dir := filepath.Join(cacheDir, hex.EncodeToString(hash[:8]))
+	filename := filepath.Join(dir, filepath.FromSlash(ref.Path))
+
+	git := func(args ...string) error {
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("Could not fetch %s of %s: git %s: %s", ref.Ref, ref.Repo, args[0], strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+
+	// A clone of a commit is always up to date, other refs can move
+	_, err := os.Stat(filepath.Join(dir, ".git"))
+	if err == nil && gitCommitRef.MatchString(ref.Ref) {
+		return filename, nil
+	}
+	if err != nil {
+		err = os.MkdirAll(dir, os.ModePerm)
+		if err != nil {
+			return "", fmt.Errorf("Could not create %s: %s", dir, err.Error())
+		}
+		err = git("init", "-q")
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = git("fetch", "-q", "--depth", "1", "--", ref.Repo, ref.Ref)
+	if err != nil {
+		return "", err
+	}
+	err = git("checkout", "-q", "--force", "FETCH_HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	return filename, nil
+}
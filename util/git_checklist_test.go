@@ -0,0 +1,29 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestParseGitChecklistRef(t *testing.T) {
+	cases := []struct {
+		arg  string
+		want GitChecklistRef
+	}{
+		{"git:https://example.com/checks.git//a/b.yaml@v1", GitChecklistRef{Repo: "https://example.com/checks.git", Path: "a/b.yaml", Ref: "v1"}},
+		{"git:/srv/checks//b.yaml", GitChecklistRef{Repo: "/srv/checks", Path: "b.yaml", Ref: "HEAD"}},
+	}
+	for _, c := range cases {
+		ref, err := ParseGitChecklistRef(c.arg)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.arg, err.Error())
+		} else if *ref != c.want {
+			t.Errorf("%s: got %+v, want %+v", c.arg, *ref, c.want)
+		}
+	}
+
+	for _, arg := range []string{"git:repo", "git://b.yaml", "git:--upload-pack=touch x//b.yaml", "git:repo//b.yaml@--output=x"} {
+		if _, err := ParseGitChecklistRef(arg); err == nil {
+			t.Errorf("%s: expecting an error", arg)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+/**
+ * Escapes the message of a GitHub Actions workflow command
+ */
+func githubEscapeData(value string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(value)
+}
+
+/**
+ * Escapes a property of a GitHub Actions workflow command
+ */
+func githubEscapeProperty(value string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(value)
+}
+
+/**
+ * Prints the result of an item as GitHub Actions workflow commands: a
+ * collapsible group with its output, followed by an error annotation if it
+ * failed, or a warning if the failure was allowed
+ */
+func PrintGithubResult(index int, result *ItemResult) {
+	if result.Status == STATUS_SKIP {
+		return
+	}
+	title := fmt.Sprintf("%d. %s", index, result.Item.Title)
+
+	fmt.Printf("::group::%s (%s)\n", githubEscapeData(title), result.Status)
+	if result.Stdout != "" {
+		fmt.Println(strings.TrimRight(result.Stdout, "\n"))
+	}
+	if result.Stderr != "" {
+		fmt.Println(strings.TrimRight(result.Stderr, "\n"))
+	}
+	fmt.Println("::endgroup::")
+
+	if result.Status != STATUS_FAIL {
+		return
+	}
+	level := "error"
+	if result.Item.ToleratesFailure() {
+		level = "warning"
+	}
+	message := result.Value
+	if result.Item.Category != "" {
+		message = fmt.Sprintf("[%s] %s", result.Item.Category, message)
+	}
+	fmt.Printf("::%s title=%s::%s\n", level, githubEscapeProperty(title), githubEscapeData(message))
+}
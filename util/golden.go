@@ -0,0 +1,67 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+/**
+ * Normalizes the output lines for the comparison against the golden file of
+ * the item, removing the parts matching its ignore patterns and sorting the
+ * lines if requested
+ */
+func normalizeGoldenOutput(item *ChecklistItem, output string) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(output, "\n"), "\n") {
+		for _, pattern := range item.GoldenIgnore {
+			line = regexp.MustCompile(pattern).ReplaceAllString(line, "")
+		}
+		lines = append(lines, strings.TrimRight(line, " \t\r"))
+	}
+	if item.GoldenSort {
+		sort.Strings(lines)
+	}
+	return lines
+}
+
+/**
+ * Compares the output of the item against its golden file. Returns false and
+ * a line diff if they differ.
+ */
+func compareGoldenFile(item *ChecklistItem, output string) (bool, string, error) {
+	content, err := ioutil.ReadFile(item.GoldenFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, "", fmt.Errorf("Missing golden file %s (create it with -update-golden)", item.GoldenFile)
+		}
+		return false, "", fmt.Errorf("Could not read golden file %s: %s", item.GoldenFile, err.Error())
+	}
+
+	diff, same := diffLines(
+		normalizeGoldenOutput(item, string(content)),
+		normalizeGoldenOutput(item, output),
+	)
+	if same {
+		return true, "", nil
+	}
+	return false, fmt.Sprintf("--- %s\n+++ output\n%s\n", item.GoldenFile, diff), nil
+}
+
+/**
+ * Replaces the golden file of the item with the given output
+ */
+func updateGoldenFile(item *ChecklistItem, output string) error {
+	err := os.MkdirAll(filepath.Dir(item.GoldenFile), 0755)
+	if err == nil {
+		err = ioutil.WriteFile(item.GoldenFile, []byte(output+"\n"), 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("Could not write golden file %s: %s", item.GoldenFile, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package util
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The commands that run an inline check from their standard input, by
+// language. The positional arguments of the scripts are appended.
+var inlineCheckInterpreters = map[string][]string{
+	"bash":    {"bash", "-s", "--"},
+	"sh":      {"sh", "-s", "--"},
+	"python":  {"python3", "-"},
+	"python3": {"python3", "-"},
+	"ruby":    {"ruby", "-"},
+	"perl":    {"perl", "-"},
+	"node":    {"node", "-"},
+}
+
+/**
+ * The check of an item, written inline in a language other than bash
+ */
+type InlineCheck struct {
+	Lang string
+	Code string
+}
+
+/**
+ * Validates the definition of the check
+ */
+func (c *InlineCheck) Validate() error {
+	if _, ok := inlineCheckInterpreters[c.Lang]; !ok {
+		var langs []string
+		for lang := range inlineCheckInterpreters {
+			langs = append(langs, lang)
+		}
+		sort.Strings(langs)
+		return fmt.Errorf("Unsupported language '%s' (expecting one of %s)", c.Lang, strings.Join(langs, ", "))
+	}
+	if c.Code == "" {
+		return fmt.Errorf("Missing the code of the check")
+	}
+	return nil
+}
+
+/**
+ * Returns the command that runs the scripts of the language, or nil for the
+ * default bash runner with the library functions
+ */
+func inlineCheckInterpreter(lang string) []string {
+	if lang == "bash" {
+		return nil
+	}
+	return inlineCheckInterpreters[lang]
+}
+
+/**
+ * Turns the inline checks of the items into their scripts, so that the
+ * templates and the values are rendered in them as well
+ */
+func resolveInlineChecks(cf *ChecklistFile) error {
+	resolve := func(item *ChecklistItem) error {
+		if item.Check == nil {
+			return nil
+		}
+		if item.Script != "" {
+			return fmt.Errorf("Item '%s' defines both a script and a check", item.Title)
+		}
+		if err := item.Check.Validate(); err != nil {
+			return fmt.Errorf("Item '%s' has an invalid check: %s", item.Title, err.Error())
+		}
+		item.Script = item.Check.Code
+		item.Lang = item.Check.Lang
+		item.Check = nil
+		return nil
+	}
+
+	for i := range cf.Checklist {
+		if err := resolve(&cf.Checklist[i]); err != nil {
+			return err
+		}
+	}
+	for name, tmpl := range cf.Templates {
+		if err := resolve(&tmpl); err != nil {
+			return err
+		}
+		cf.Templates[name] = tmpl
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+/**
+ * A reference of an item to another one, through its dependencies or its
+ * conditions
+ */
+type ItemGraphEdge struct {
+	// The index of the referenced item, or -1 if it is not known
+	To int
+
+	// The referenced title or id
+	Ref string
+
+	// How the item refers to the other one, e.g. "depends on" or
+	// "skip if fail"
+	Kind string
+}
+
+/**
+ * The graph of the references between the items of a run
+ */
+type ItemGraph struct {
+	Items []ChecklistItem
+	Edges [][]ItemGraphEdge
+}
+
+/**
+ * Creates the graph of the references between the given items, resolved by
+ * their titles and ids
+ */
+func CreateItemGraph(items []ChecklistItem) *ItemGraph {
+	refs := make(map[string]int)
+	for i := range items {
+		for _, ref := range items[i].Refs() {
+			if _, ok := refs[ref]; !ok {
+				refs[ref] = i
+			}
+		}
+	}
+	resolve := func(ref string, kind string) ItemGraphEdge {
+		to, ok := refs[ref]
+		if !ok {
+			to = -1
+		}
+		return ItemGraphEdge{To: to, Ref: ref, Kind: kind}
+	}
+
+	graph := &ItemGraph{Items: items, Edges: make([][]ItemGraphEdge, len(items))}
+	for i, item := range items {
+		for _, dep := range item.DependsOn {
+			graph.Edges[i] = append(graph.Edges[i], resolve(dep, "depends on"))
+		}
+		if item.SkipIf != nil {
+			graph.Edges[i] = append(graph.Edges[i], resolve(item.SkipIf.Item, "skip if "+item.SkipIf.Status))
+		}
+		if item.RunIf != nil {
+			graph.Edges[i] = append(graph.Edges[i], resolve(item.RunIf.Item, "run if "+item.RunIf.Status))
+		}
+	}
+	return graph
+}
+
+/**
+ * Returns the cycles of the graph, as the indexes of their items from the
+ * first item of the cycle back to it
+ */
+func (g *ItemGraph) Cycles() [][]int {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(g.Items))
+	var path []int
+	var cycles [][]int
+
+	var visit func(i int)
+	visit = func(i int) {
+		state[i] = visiting
+		path = append(path, i)
+		for _, edge := range g.Edges[i] {
+			switch {
+			case edge.To < 0:
+			case state[edge.To] == visiting:
+				// The cycle is the part of the path from the referenced item
+				for start, j := range path {
+					if j == edge.To {
+						cycle := append([]int{}, path[start:]...)
+						cycles = append(cycles, append(cycle, edge.To))
+						break
+					}
+				}
+			case state[edge.To] == unvisited:
+				visit(edge.To)
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+	}
+	for i := range g.Items {
+		if state[i] == unvisited {
+			visit(i)
+		}
+	}
+	return cycles
+}
+
+/**
+ * Returns the references to unknown items, as "Title: kind 'ref'" lines
+ */
+func (g *ItemGraph) UnknownRefs() []string {
+	var unknown []string
+	for i, edges := range g.Edges {
+		for _, edge := range edges {
+			if edge.To < 0 {
+				unknown = append(unknown, fmt.Sprintf("%s: %s '%s'", g.Items[i].Title, edge.Kind, edge.Ref))
+			}
+		}
+	}
+	return unknown
+}
+
+/**
+ * Returns the graph in the DOT language of Graphviz, with an arrow from every
+ * item to the items it refers to, and the cycles in red
+ */
+func (g *ItemGraph) Dot() string {
+	inCycle := make(map[[2]int]bool)
+	for _, cycle := range g.Cycles() {
+		for i := 0; i+1 < len(cycle); i++ {
+			inCycle[[2]int{cycle[i], cycle[i+1]}] = true
+		}
+	}
+	quote := func(text string) string {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text) + `"`
+	}
+
+	var dot strings.Builder
+	dot.WriteString("digraph checklist {\n")
+	for i, item := range g.Items {
+		fmt.Fprintf(&dot, "  %d [label=%s];\n", i+1, quote(fmt.Sprintf("%d. %s", i+1, item.Title)))
+	}
+	for i, edges := range g.Edges {
+		for _, edge := range edges {
+			if edge.To < 0 {
+				fmt.Fprintf(&dot, "  %d -> %s [label=%s, color=red];\n", i+1, quote(edge.Ref), quote(edge.Kind))
+			} else if inCycle[[2]int{i, edge.To}] {
+				fmt.Fprintf(&dot, "  %d -> %d [label=%s, color=red];\n", i+1, edge.To+1, quote(edge.Kind))
+			} else {
+				fmt.Fprintf(&dot, "  %d -> %d [label=%s];\n", i+1, edge.To+1, quote(edge.Kind))
+			}
+		}
+	}
+	dot.WriteString("}\n")
+	return dot.String()
+}
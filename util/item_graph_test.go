@@ -0,0 +1,51 @@
+package util
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestItemGraphCycles(t *testing.T) {
+	items := []ChecklistItem{
+		{ID: "first", Title: "First"},
+		{Title: "Second", DependsOn: []string{"first"}},
+		{ID: "third", Title: "Third", DependsOn: []string{"Second", "fourth"}},
+		{ID: "fourth", Title: "Fourth", DependsOn: []string{"third"}, SkipIf: &ItemCondition{Item: "nope", Status: "fail"}},
+	}
+	graph := CreateItemGraph(items)
+
+	if cycles := graph.Cycles(); !reflect.DeepEqual(cycles, [][]int{{2, 3, 2}}) {
+		t.Errorf("got the cycles %v, want [[2 3 2]]", cycles)
+	}
+	if unknown := graph.UnknownRefs(); !reflect.DeepEqual(unknown, []string{"Fourth: skip if fail 'nope'"}) {
+		t.Errorf("got the unknown references %q", unknown)
+	}
+
+	dot := graph.Dot()
+	for _, line := range []string{
+		`2 -> 1 [label="depends on"];`,
+		`3 -> 4 [label="depends on", color=red];`,
+		`4 -> 3 [label="depends on", color=red];`,
+		`4 -> "nope" [label="skip if fail", color=red];`,
+	} {
+		if !strings.Contains(dot, line) {
+			t.Errorf("expecting %q in the DOT graph:\n%s", line, dot)
+		}
+	}
+}
+
+func TestItemGraphWithoutCycles(t *testing.T) {
+	items := []ChecklistItem{
+		{Title: "First"},
+		{Title: "Second", RunIf: &ItemCondition{Item: "First", Status: "pass"}},
+		{Title: "Third", DependsOn: []string{"First", "Second"}},
+	}
+	graph := CreateItemGraph(items)
+	if cycles := graph.Cycles(); len(cycles) != 0 {
+		t.Errorf("got the cycles %v, want none", cycles)
+	}
+	if unknown := graph.UnknownRefs(); len(unknown) != 0 {
+		t.Errorf("got the unknown references %q, want none", unknown)
+	}
+}
@@ -0,0 +1,166 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A single step of a JSON path: `.key`, `["key"]` or `[index]`
+var rxJSONPathStep = regexp.MustCompile(`^(?:\.([A-Za-z_][\w-]*)|\["((?:[^"\\]|\\.)*)"\]|\[(\d+)\])`)
+
+/**
+ * An assertion on a field of the JSON output of the item script
+ */
+type JSONAssertion struct {
+	// The path of the field, e.g. `.status.ready` or `$.items[0].name`
+	Path string
+
+	// The field must be equal to this value
+	Equals interface{}
+
+	// The field must be a number within these bounds
+	Min *float64
+	Max *float64
+}
+
+/**
+ * Validates the definition of the assertion
+ */
+func (a *JSONAssertion) Validate() error {
+	if _, err := parseJSONPath(a.Path); err != nil {
+		return err
+	}
+	if a.Equals == nil && a.Min == nil && a.Max == nil {
+		return fmt.Errorf("JSON assertion on %s has no equals, min or max", a.Path)
+	}
+	return nil
+}
+
+/**
+ * Splits the path in the keys (strings) and indices (ints) to follow
+ */
+func parseJSONPath(path string) ([]interface{}, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	if rest == "" || rest == "." {
+		return nil, nil
+	}
+
+	var steps []interface{}
+	for rest != "" {
+		m := rxJSONPathStep.FindStringSubmatch(rest)
+		if m == nil {
+			return nil, fmt.Errorf("Invalid JSON path '%s' at '%s'", path, rest)
+		}
+		switch {
+		case m[1] != "":
+			steps = append(steps, m[1])
+		case m[3] != "":
+			index, _ := strconv.Atoi(m[3])
+			steps = append(steps, index)
+		default:
+			key, err := strconv.Unquote(`"` + m[2] + `"`)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid JSON path '%s': %s", path, err.Error())
+			}
+			steps = append(steps, key)
+		}
+		rest = rest[len(m[0]):]
+	}
+	return steps, nil
+}
+
+/**
+ * Returns the value at the given path in the decoded document
+ */
+func lookupJSONPath(doc interface{}, path string) (interface{}, error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	value := doc
+	for _, step := range steps {
+		switch s := step.(type) {
+		case string:
+			obj, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("No field %s (not an object)", path)
+			}
+			if value, ok = obj[s]; !ok {
+				return nil, fmt.Errorf("No field %s", path)
+			}
+		case int:
+			list, ok := value.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("No field %s (not an array)", path)
+			}
+			if s >= len(list) {
+				return nil, fmt.Errorf("No field %s (the array has %d elements)", path, len(list))
+			}
+			value = list[s]
+		}
+	}
+	return value, nil
+}
+
+/**
+ * Returns the compact JSON representation of the value
+ */
+func jsonText(value interface{}) string {
+	text, err := json.Marshal(normalizeValues(value))
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(text)
+}
+
+/**
+ * Checks the assertion against the decoded document. Returns an empty string
+ * if it holds, otherwise the description of the mismatch.
+ */
+func (a *JSONAssertion) check(doc interface{}) string {
+	value, err := lookupJSONPath(doc, a.Path)
+	if err != nil {
+		return err.Error()
+	}
+
+	if a.Equals != nil && jsonText(value) != jsonText(a.Equals) {
+		return fmt.Sprintf("expected %s=%s, got %s", a.Path, jsonText(a.Equals), jsonText(value))
+	}
+	if a.Min != nil || a.Max != nil {
+		number, ok := value.(float64)
+		if !ok {
+			return fmt.Sprintf("expected %s to be a number, got %s", a.Path, jsonText(value))
+		}
+		if a.Min != nil && number < *a.Min {
+			return fmt.Sprintf("expected %s >= %v, got %v", a.Path, *a.Min, number)
+		}
+		if a.Max != nil && number > *a.Max {
+			return fmt.Sprintf("expected %s <= %v, got %v", a.Path, *a.Max, number)
+		}
+	}
+	return ""
+}
+
+/**
+ * Parses the value as JSON and checks all the assertions against it. Returns
+ * an error if the value is not valid JSON, otherwise the descriptions of the
+ * assertions that failed.
+ */
+func checkJSONAssertions(assertions []JSONAssertion, value string) ([]string, error) {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(value), &doc); err != nil {
+		return nil, fmt.Errorf("Invalid JSON output: %s", err.Error())
+	}
+
+	var failures []string
+	for _, assertion := range assertions {
+		if failure := assertion.check(doc); failure != "" {
+			failures = append(failures, failure)
+		}
+	}
+	return failures, nil
+}
@@ -0,0 +1,133 @@
+package util
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+/**
+ * The outcome of one of the test cases of the JUnit output of an item
+ */
+type SubResult struct {
+	Name    string
+	Status  string
+	Message string
+}
+
+type junitImportMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+type junitImportCase struct {
+	Name      string              `xml:"name,attr"`
+	ClassName string              `xml:"classname,attr"`
+	Failure   *junitImportMessage `xml:"failure"`
+	Error     *junitImportMessage `xml:"error"`
+	Skipped   *junitImportMessage `xml:"skipped"`
+}
+
+// Either a <testsuite>, or the <testsuites> that holds several of them
+type junitImportSuite struct {
+	Cases  []junitImportCase  `xml:"testcase"`
+	Suites []junitImportSuite `xml:"testsuite"`
+}
+
+func (s *junitImportSuite) results() []SubResult {
+	var results []SubResult
+	for _, tc := range s.Cases {
+		result := SubResult{Name: tc.Name, Status: STATUS_PASS}
+		if tc.ClassName != "" {
+			result.Name = tc.ClassName + "." + tc.Name
+		}
+		for _, msg := range []*junitImportMessage{tc.Failure, tc.Error, tc.Skipped} {
+			if msg == nil {
+				continue
+			}
+			result.Status = STATUS_FAIL
+			if msg == tc.Skipped {
+				result.Status = STATUS_SKIP
+			}
+			result.Message = firstNonEmpty(msg.Message, strings.TrimSpace(msg.Body))
+			break
+		}
+		results = append(results, result)
+	}
+	for i := range s.Suites {
+		results = append(results, s.Suites[i].results()...)
+	}
+	return results
+}
+
+/**
+ * Reads the test cases of a JUnit XML file, with either a <testsuite> or a
+ * <testsuites> root. The cases with an error count as failed.
+ */
+func ImportJUnitOutput(filename string) ([]SubResult, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read the JUnit output %s: %s", filename, err.Error())
+	}
+	var suite junitImportSuite
+	err = xml.Unmarshal(content, &suite)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse the JUnit output %s: %s", filename, err.Error())
+	}
+	results := suite.results()
+	if len(results) == 0 {
+		return nil, fmt.Errorf("The JUnit output %s has no test cases", filename)
+	}
+	return results, nil
+}
+
+/**
+ * Returns the path of the JUnit output of the item, with the variables of
+ * the item expanded
+ */
+func (r *Runner) itemJUnitOutput(item *ChecklistItem) string {
+	env := r.ItemEnvironment(item, nil)
+	return os.Expand(item.JUnitOutput, func(name string) string {
+		if value, ok := env[name]; ok {
+			return value
+		}
+		return os.Getenv(name)
+	})
+}
+
+/**
+ * Imports the JUnit output the script of the item produced, as the outcome
+ * of the item: it fails if any of the test cases failed
+ */
+func (r *Runner) importItemJUnit(item *ChecklistItem, sout string, serr string, err error) (string, string, error) {
+	if _, ok := err.(*ScriptExitError); err != nil && !ok {
+		return sout, serr, err
+	}
+	results, ierr := ImportJUnitOutput(r.itemJUnitOutput(item))
+	r.subResults[checkKey(item, r)] = results
+	if ierr != nil {
+		return sout, serr, ierr
+	}
+
+	counts := make(map[string]int)
+	for _, result := range results {
+		counts[result.Status] += 1
+	}
+	value := fmt.Sprintf("%d passed, %d failed, %d skipped", counts[STATUS_PASS], counts[STATUS_FAIL], counts[STATUS_SKIP])
+	if counts[STATUS_FAIL] > 0 {
+		return value, serr, fmt.Errorf("%d of %d test cases failed", counts[STATUS_FAIL], len(results))
+	}
+	return value, serr, err
+}
+
+/**
+ * Returns the test cases imported from the JUnit output of the item, if any
+ */
+func ItemSubResults(item *ChecklistItem, runner *Runner) []SubResult {
+	if item.JUnitOutput == "" {
+		return nil
+	}
+	return runner.subResults[checkKey(item, runner)]
+}
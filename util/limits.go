@@ -0,0 +1,95 @@
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// A umask, in octal
+var rxUmask = regexp.MustCompile(`^0?[0-7]{3}$`)
+
+/**
+ * The resource limits of the item scripts and of all of their processes
+ */
+type ResourceLimits struct {
+	// The CPU time of every process (e.g. 30s)
+	CPU string `yaml:"cpu"`
+
+	// The virtual memory of every process (e.g. 512M)
+	Memory string
+
+	// The number of files every process can open
+	OpenFiles int `yaml:"open_files"`
+}
+
+/**
+ * Validates the limits
+ */
+func (l *ResourceLimits) Validate() error {
+	if l.CPU != "" {
+		if d, err := time.ParseDuration(l.CPU); err != nil || d < time.Second {
+			return fmt.Errorf("Invalid cpu limit '%s' (expecting a duration of at least 1s)", l.CPU)
+		}
+	}
+	if l.Memory != "" {
+		if size, err := ParseSize(l.Memory); err != nil || size < 1024 {
+			return fmt.Errorf("Invalid memory limit '%s' (expecting a size of at least 1K)", l.Memory)
+		}
+	}
+	if l.OpenFiles < 0 {
+		return fmt.Errorf("Invalid open_files limit %d", l.OpenFiles)
+	}
+	return nil
+}
+
+/**
+ * Validates the umask and the resource limits of an item or a checklist
+ */
+func validateLimits(umask string, limits *ResourceLimits) error {
+	if umask != "" && !rxUmask.MatchString(umask) {
+		return fmt.Errorf("Invalid umask '%s' (expecting an octal mask, e.g. 022)", umask)
+	}
+	if limits != nil {
+		return limits.Validate()
+	}
+	return nil
+}
+
+/**
+ * @brief      Returns the shell commands that apply the umask and the limits
+ *             before running the script. A limit the platform does not
+ *             support is reported on the stderr of the script and ignored.
+ *
+ * @param      umask   The umask, or empty to inherit the one of preflighter
+ * @param      limits  The resource limits, or nil
+ *
+ * @return     The commands, or an empty string if there is nothing to apply
+ */
+func limitsPrelude(umask string, limits *ResourceLimits) string {
+	var commands []string
+	if umask != "" {
+		commands = append(commands, "umask "+umask)
+	}
+	if limits != nil {
+		limit := func(option string, value interface{}, what string) {
+			commands = append(commands, fmt.Sprintf("ulimit %s %v 2>/dev/null || echo 'WARNING: Could not limit the %s of the script, ignoring' >&2", option, value, what))
+		}
+		if limits.CPU != "" {
+			cpu, _ := time.ParseDuration(limits.CPU)
+			limit("-t", int64(cpu/time.Second), "CPU time")
+		}
+		if limits.Memory != "" {
+			size, _ := ParseSize(limits.Memory)
+			limit("-v", size/1024, "memory")
+		}
+		if limits.OpenFiles > 0 {
+			limit("-n", limits.OpenFiles, "open files")
+		}
+	}
+	if len(commands) == 0 {
+		return ""
+	}
+	return strings.Join(commands, "; ") + `; exec "$@"`
+}
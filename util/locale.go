@@ -0,0 +1,37 @@
+package util
+
+import (
+	"strconv"
+	"strings"
+)
+
+// The locale of the scripts that don't define their own, so that their
+// output is the same on all machines
+const defaultLocale = "C"
+
+/**
+ * Parses a number printed in any locale: with a decimal point or a decimal
+ * comma, and with or without grouping separators (e.g. 1,234.5 or 1.234,5)
+ */
+func parseNumber(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	number, err := strconv.ParseFloat(value, 64)
+	if err == nil {
+		return number, nil
+	}
+
+	normalized := strings.NewReplacer(" ", "", "\u00a0", "", "\u202f", "", "'", "").Replace(value)
+	dot, comma := strings.LastIndex(normalized, "."), strings.LastIndex(normalized, ",")
+	switch {
+	case comma > dot && (dot >= 0 || strings.Count(normalized, ",") == 1):
+		// The comma is the decimal separator, the dots group the digits
+		normalized = strings.Replace(normalized, ".", "", -1)
+		normalized = strings.Replace(normalized, ",", ".", 1)
+	default:
+		normalized = strings.Replace(normalized, ",", "", -1)
+	}
+	if number, nerr := strconv.ParseFloat(normalized, 64); nerr == nil {
+		return number, nil
+	}
+	return 0, err
+}
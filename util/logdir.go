@@ -0,0 +1,63 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var rxLogNameUnsafe = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+/**
+ * Returns the log file name of the item with the given (1-based) index
+ */
+func itemLogName(index int, title string) string {
+	name := strings.Trim(rxLogNameUnsafe.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if len(name) > 60 {
+		name = strings.TrimRight(name[:60], "-")
+	}
+	if name == "" {
+		name = "item"
+	}
+	return fmt.Sprintf("%02d-%s.log", index, name)
+}
+
+/**
+ * @brief      Writes the full output of every executed item to its own log
+ *             file, along with an index of all the items
+ *
+ * @param      dir      The directory to write the logs to, created if missing
+ * @param      summary  The summary of the run
+ *
+ * @return     Returns the error occurred or nil
+ */
+func WriteItemLogs(dir string, summary *RunSummary) error {
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("Could not create log directory %s: %s", dir, err.Error())
+	}
+
+	index := ""
+	for i, result := range summary.Results {
+		name := "-"
+		if result.Status != STATUS_SKIP {
+			name = itemLogName(i+1, result.Item.Title)
+			content := fmt.Sprintf("Title: %s\nStatus: %s\nDuration: %s\n\n--- script ---\n%s\n--- stdout ---\n%s\n--- stderr ---\n%s\n",
+				result.Item.Title, result.Status, result.Duration, result.Item.Script, result.Stdout, result.Stderr)
+			err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+			if err != nil {
+				return fmt.Errorf("Could not write log %s: %s", name, err.Error())
+			}
+		}
+		index += fmt.Sprintf("%02d\t%s\t%s\t%s\n", i+1, result.Status, name, result.Item.Title)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "index.txt"), []byte(index), 0644)
+	if err != nil {
+		return fmt.Errorf("Could not write log index: %s", err.Error())
+	}
+	return nil
+}
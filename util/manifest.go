@@ -0,0 +1,93 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+/**
+ * A checklist file referenced by a manifest, or another manifest to include
+ */
+type ManifestEntry struct {
+	File    string
+	Include string
+
+	// Variables that override the ones of the checklist file
+	Env map[string]string `yaml:"vars"`
+
+	// Leave the entry out of the run, if false
+	Enabled *bool
+}
+
+/**
+ * An ordered set of checklist files, describing a whole preflight in a
+ * single entry point
+ */
+type Manifest struct {
+	Checklists []ManifestEntry
+}
+
+/**
+ * @brief      Loads the manifest and the manifests it includes, with the paths
+ *             resolved relatively to the manifest that references them
+ *
+ * @param      filename  The manifest file
+ *
+ * @return     The enabled checklist files, in order, or the error occurred
+ */
+func LoadManifest(filename string) ([]ManifestEntry, error) {
+	return loadManifest(filepath.Clean(filename), nil)
+}
+
+func loadManifest(filename string, parents []string) ([]ManifestEntry, error) {
+	for _, parent := range parents {
+		if parent == filename {
+			return nil, fmt.Errorf("Manifest %s includes itself", filename)
+		}
+	}
+
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read manifest %s: %s", filename, err.Error())
+	}
+	var manifest Manifest
+	err = yaml.Unmarshal(content, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse manifest %s: %s", filename, err.Error())
+	}
+
+	dir := filepath.Dir(filename)
+	var entries []ManifestEntry
+	for i, entry := range manifest.Checklists {
+		if (entry.File == "") == (entry.Include == "") {
+			return nil, fmt.Errorf("Entry #%d of manifest %s must define either file or include", i+1, filename)
+		}
+		if entry.Enabled != nil && !*entry.Enabled {
+			continue
+		}
+		if entry.Include != "" {
+			included, err := loadManifest(resolvePath(dir, entry.Include), append(parents, filename))
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, included...)
+			continue
+		}
+		entry.File = resolvePath(dir, entry.File)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+/**
+ * Resolves the path relatively to the given directory, unless absolute
+ */
+func resolvePath(dir string, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
@@ -0,0 +1,101 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+/**
+ * Shuffles the items in place, in an order that is determined by the seed
+ */
+func ShuffleItems(items []ChecklistItem, seed int64) {
+	rand.New(rand.NewSource(seed)).Shuffle(len(items), func(i, j int) {
+		items[i], items[j] = items[j], items[i]
+	})
+}
+
+/**
+ * Reverses the order of the items in place, e.g. to run the teardown of a
+ * setup checklist
+ */
+func ReverseItems(items []ChecklistItem) {
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+}
+
+/**
+ * Sorts the checklist files in place by their priority, the highest first,
+ * keeping the order of the arguments for the files of the same priority
+ */
+func SortChecklistFiles(files []*ChecklistFile) {
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].Priority > files[j].Priority
+	})
+}
+
+/**
+ * Saves the order of the items as the list of their ids, or of their titles
+ */
+func SaveOrder(filename string, items []ChecklistItem) error {
+	var titles []string
+	for _, item := range items {
+		titles = append(titles, item.Ref())
+	}
+
+	content, err := yaml.Marshal(titles)
+	if err != nil {
+		return fmt.Errorf("Could not marshal order: %s", err.Error())
+	}
+	err = ioutil.WriteFile(filename, content, 0644)
+	if err != nil {
+		return fmt.Errorf("Could not write order %s: %s", filename, err.Error())
+	}
+	return nil
+}
+
+/**
+ * Reorders the items according to the order saved in the given file. Returns
+ * the reordered items, along with warnings for the titles that don't match
+ * the current items. The items missing from the file are kept at the end.
+ */
+func ApplyOrder(filename string, items []ChecklistItem) ([]ChecklistItem, []error, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not read order %s: %s", filename, err.Error())
+	}
+	var titles []string
+	err = yaml.Unmarshal(content, &titles)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not parse order %s: %s", filename, err.Error())
+	}
+
+	var ordered []ChecklistItem
+	var warnings []error
+	used := make([]bool, len(items))
+	for _, title := range titles {
+		found := false
+		for i, item := range items {
+			if !used[i] && containsString(item.Refs(), title) {
+				ordered = append(ordered, item)
+				used[i], found = true, true
+				break
+			}
+		}
+		if !found {
+			warnings = append(warnings, fmt.Errorf("The saved order refers to '%s', which is not an item", title))
+		}
+	}
+	for i, item := range items {
+		if !used[i] {
+			warnings = append(warnings, fmt.Errorf("Item '%s' is not in the saved order, running it last", item.Title))
+			ordered = append(ordered, item)
+		}
+	}
+
+	return ordered, warnings, nil
+}
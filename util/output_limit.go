@@ -0,0 +1,71 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/**
+ * A buffer that keeps up to the given number of bytes, and counts the rest
+ */
+type limitedBuffer struct {
+	max     int64
+	buf     bytes.Buffer
+	omitted int64
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.max <= 0 {
+		return b.buf.Write(p)
+	}
+
+	room := b.max - int64(b.buf.Len())
+	if room < 0 {
+		room = 0
+	}
+	if int64(len(p)) > room {
+		b.buf.Write(p[:room])
+		b.omitted += int64(len(p)) - room
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+/**
+ * Returns the captured output, followed by a marker if it was truncated
+ */
+func (b *limitedBuffer) String() string {
+	if b.omitted == 0 {
+		return b.buf.String()
+	}
+	return fmt.Sprintf("%s\n[output truncated, %d bytes omitted]\n", b.buf.String(), b.omitted)
+}
+
+/**
+ * Parses a size in bytes, with an optional K, M or G suffix (e.g. 512K)
+ */
+func ParseSize(text string) (int64, error) {
+	text = strings.ToUpper(strings.TrimSpace(text))
+	text = strings.TrimSuffix(text, "B")
+
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(text, "K"):
+		multiplier = 1024
+	case strings.HasSuffix(text, "M"):
+		multiplier = 1024 * 1024
+	case strings.HasSuffix(text, "G"):
+		multiplier = 1024 * 1024 * 1024
+	}
+	if multiplier > 1 {
+		text = text[:len(text)-1]
+	}
+
+	value, err := strconv.ParseInt(text, 10, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("Invalid size '%s', expecting e.g. 4096, 512K or 10M", text)
+	}
+	return value * multiplier, nil
+}
@@ -0,0 +1,211 @@
+package util
+
+import (
+	"fmt"
+	"sort"
+)
+
+/**
+ * The changes to an item in a given environment
+ */
+type ItemOverride struct {
+	Timeout        *string
+	Retries        *int
+	Expect         *string
+	ExpectExitCode *int     `yaml:"expect_exit_code"`
+	ExpectMin      *float64 `yaml:"expect_min"`
+	ExpectMax      *float64 `yaml:"expect_max"`
+	AllowFailure   *bool    `yaml:"allow_failure"`
+
+	// Don't run the item in this environment
+	Skip bool
+}
+
+/**
+ * The local changes to an item fetched from a runbook, by runbook item ID
+ */
+type RunbookItemAugmentation struct {
+	ItemOverride `yaml:",inline"`
+
+	Remediation *string
+	Fix         *string
+	Category    *string
+	DocURL      *string `yaml:"doc_url"`
+}
+
+/**
+ * The changes to a checklist in a given environment
+ */
+type ChecklistOverride struct {
+	Env   map[string]string `yaml:"vars"`
+	Items map[string]ItemOverride
+}
+
+/**
+ * Checks that the override refers to existing items, with valid values
+ */
+func (o *ChecklistOverride) validate(cf *ChecklistFile) error {
+	titles := make(map[string]bool)
+	for _, item := range cf.Checklist {
+		for _, ref := range item.Refs() {
+			titles[ref] = true
+		}
+	}
+	for title, item := range o.Items {
+		if !titles[title] {
+			return fmt.Errorf("There is no item '%s'", title)
+		}
+		if item.Timeout != nil {
+			if err := ValidateDuration(*item.Timeout); err != nil {
+				return fmt.Errorf("Item '%s' has an invalid timeout: %s", title, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+/**
+ * Applies the layer of overrides of the given environment to the checklist.
+ * Fails if the checklist has overrides, but none for this environment.
+ */
+func ApplyChecklistOverrides(cf *ChecklistFile, envName string) error {
+	if len(cf.Overrides) == 0 {
+		return nil
+	}
+	override, ok := cf.Overrides[envName]
+	if !ok {
+		return fmt.Errorf("%s has no overrides for environment '%s' (expecting one of %v)", cf.Filename, envName, sortedOverrideNames(cf.Overrides))
+	}
+	if err := override.validate(cf); err != nil {
+		return fmt.Errorf("Invalid overrides for environment '%s' in %s: %s", envName, cf.Filename, err.Error())
+	}
+
+	for key, value := range override.Env {
+		if cf.Env == nil {
+			cf.Env = make(map[string]string)
+		}
+		cf.Env[key] = value
+	}
+
+	for i := range cf.Checklist {
+		item := &cf.Checklist[i]
+		o, ok := override.Items[item.Title]
+		if !ok && item.ID != "" {
+			o, ok = override.Items[item.ID]
+		}
+		if !ok {
+			continue
+		}
+		o.apply(item)
+		if o.Skip {
+			item.DisabledIn = envName
+		}
+	}
+	return nil
+}
+
+/**
+ * Applies the changes to the item
+ */
+func (o *ItemOverride) apply(item *ChecklistItem) {
+	if o.Timeout != nil {
+		item.Timeout = *o.Timeout
+	}
+	if o.Retries != nil {
+		item.Retries = o.Retries
+	}
+	if o.Expect != nil {
+		item.ExpectMatch = *o.Expect
+	}
+	if o.ExpectExitCode != nil {
+		item.ExpectExitCode = o.ExpectExitCode
+	}
+	if o.ExpectMin != nil {
+		item.ExpectMin = o.ExpectMin
+	}
+	if o.ExpectMax != nil {
+		item.ExpectMax = o.ExpectMax
+	}
+	if o.AllowFailure != nil {
+		item.AllowFailure = *o.AllowFailure
+	}
+}
+
+/**
+ * Checks that the augmentation has valid values
+ */
+func (a *RunbookItemAugmentation) validate() error {
+	if a.Skip {
+		return fmt.Errorf("Cannot skip runbook items, leave them out of the runbook step instead")
+	}
+	if a.Timeout != nil {
+		if err := ValidateDuration(*a.Timeout); err != nil {
+			return fmt.Errorf("Invalid timeout: %s", err.Error())
+		}
+	}
+	if a.DocURL != nil && !isDocURL(*a.DocURL) {
+		return fmt.Errorf("Invalid doc_url %s (expecting an http or https URL)", *a.DocURL)
+	}
+	return nil
+}
+
+/**
+ * @brief      Applies the `runbook_items` of the checklist to the items that
+ *             were fetched from one of its runbook steps
+ *
+ * @param      cf       The checklist file with the augmentations
+ * @param      items    The items of the runbook step
+ * @param      matched  The runbook item IDs augmented so far, updated with
+ *                      the ones of these items
+ */
+func AugmentRunbookItems(cf *ChecklistFile, items []ChecklistItem, matched map[string]bool) {
+	for i := range items {
+		item := &items[i]
+		a, ok := cf.RunbookItems[item.RunbookID]
+		if !ok {
+			continue
+		}
+		matched[item.RunbookID] = true
+		a.apply(item)
+		if a.Remediation != nil {
+			item.Remediation = *a.Remediation
+		}
+		if a.Fix != nil {
+			item.Fix = *a.Fix
+		}
+		if a.Category != nil {
+			item.Category = *a.Category
+		}
+		if a.DocURL != nil {
+			item.DocURL = *a.DocURL
+		}
+	}
+}
+
+/**
+ * Returns a warning for every augmentation of the checklist that did not
+ * match any of the items fetched from its runbook steps
+ */
+func UnusedRunbookAugmentations(cf *ChecklistFile, matched map[string]bool) []error {
+	var ids []string
+	for id := range cf.RunbookItems {
+		if !matched[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	var warnings []error
+	for _, id := range ids {
+		warnings = append(warnings, fmt.Errorf("%s augments runbook item %s, which is not in any of its runbook steps", cf.Filename, id))
+	}
+	return warnings
+}
+
+func sortedOverrideNames(overrides map[string]ChecklistOverride) []string {
+	names := make(map[string]string)
+	for name := range overrides {
+		names[name] = name
+	}
+	return sortedKeys(names)
+}
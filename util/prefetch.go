@@ -0,0 +1,171 @@
+package util
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// The variables through which the scripts of an item can depend on the
+// earlier items
+var prefetchBlockingVars = []string{"PREFLIGHTER_STATUS_", "PREFLIGHTER_SHARED_DIR", "CACHE_DIR"}
+
+// The definition of a function in a library script
+var rxLibFunction = regexp.MustCompile(`(?m)^\s*(?:function\s+([\w:.-]+)|([\w:.-]+)\s*\(\s*\))`)
+
+/**
+ * Returns the names of the functions defined in the library script
+ */
+func libFunctions(lib string) []string {
+	var names []string
+	for _, match := range rxLibFunction.FindAllStringSubmatch(lib, -1) {
+		names = append(names, match[1]+match[2])
+	}
+	return names
+}
+
+/**
+ * Returns the scripts that the check of the item runs
+ */
+func itemCheckScripts(item *ChecklistItem) []string {
+	scripts := []string{item.Script, item.ExpectScript}
+	if item.Wait != nil {
+		scripts = append(scripts, item.Wait.Until)
+	}
+	if item.Check != nil {
+		scripts = append(scripts, item.Check.Code)
+	}
+	return scripts
+}
+
+/**
+ * Checks if the item calls one of the functions of the user libraries
+ */
+func callsLibFunction(item *ChecklistItem, runner *Runner) bool {
+	functions := libFunctions(runner.Config.UserLib)
+	for _, script := range itemCheckScripts(item) {
+		for _, name := range functions {
+			if regexp.MustCompile(`(^|[^\w.-])` + regexp.QuoteMeta(name) + `($|[^\w.-])`).MatchString(script) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/**
+ * Checks if the check of the item can read the statuses of the earlier items,
+ * from its own scripts or from the functions of the user libraries it calls
+ */
+func usesItemStatuses(item *ChecklistItem, runner *Runner) bool {
+	for _, script := range itemCheckScripts(item) {
+		if strings.Contains(script, "PREFLIGHTER_STATUS_") {
+			return true
+		}
+	}
+	return strings.Contains(runner.Config.UserLib, "PREFLIGHTER_STATUS_") && callsLibFunction(item, runner)
+}
+
+/**
+ * Checks if the check of the item can run in the background, ahead of its
+ * turn in the run. Only the passive checks whose outcome does not depend on
+ * the earlier items qualify: not the ones with conditions or dependencies,
+ * with a cost, linked to the runbook, running with sudo, or using the status
+ * of other items or the directories the items exchange data in. The functions
+ * of the user libraries may use these directories too, so the checks that call
+ * them don't qualify either.
+ */
+func CanPrefetchItemCheck(item *ChecklistItem, runner *Runner) bool {
+	if !CanCheckItem(item) || item.DisabledIn != "" {
+		return false
+	}
+	if item.SkipIf != nil || item.RunIf != nil || len(item.DependsOn) > 0 {
+		return false
+	}
+	if item.Cost > 0 || item.RunbookID != "" || item.Privileged || item.CacheTTL != "" || item.JUnitOutput != "" {
+		return false
+	}
+	for _, script := range itemCheckScripts(item) {
+		for _, name := range prefetchBlockingVars {
+			if strings.Contains(script, name) {
+				return false
+			}
+		}
+	}
+	return !callsLibFunction(item, runner)
+}
+
+/**
+ * Returns the semaphores that the check of the item must hold while it runs,
+ * in the run or in the background, so that at most `max_concurrency` checks
+ * of its checklist file run at once, and a single check of the items with its
+ * mutex. The semaphores are always taken in this order.
+ */
+func (r *Runner) checkSlots(item *ChecklistItem) []chan struct{} {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var slots []chan struct{}
+	if item.FileMaxConcurrency > 0 {
+		key := "file:" + item.Filename
+		if _, ok := r.slots[key]; !ok {
+			r.slots[key] = make(chan struct{}, item.FileMaxConcurrency)
+		}
+		slots = append(slots, r.slots[key])
+	}
+	if item.Mutex != "" {
+		key := "mutex:" + item.Mutex
+		if _, ok := r.slots[key]; !ok {
+			r.slots[key] = make(chan struct{}, 1)
+		}
+		slots = append(slots, r.slots[key])
+	}
+	return slots
+}
+
+/**
+ * @brief      Runs the checks of the given items in the background, in
+ *             order, so that their outcome is ready when the run reaches
+ *             them. The run performs the checks that were not started yet
+ *             by itself, so that at most `jobs` checks run at once.
+ *
+ * @param      items   The items whose checks can run in the background
+ * @param      runner  The runner of the checks
+ * @param      jobs    The number of checks to run at once, with the one of
+ *                     the run
+ *
+ * @return     A function that stops starting checks, and waits for the
+ *             running ones to complete
+ */
+func PrefetchItemChecks(items []*ChecklistItem, runner *Runner, jobs int) func() {
+	queue := make(chan *ChecklistItem)
+	stop := make(chan struct{})
+	go func() {
+		defer close(queue)
+		for _, item := range items {
+			select {
+			case queue <- item:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var workers sync.WaitGroup
+	for i := 1; i < jobs; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for item := range queue {
+				if outcome, found := runner.claimCheck(checkKey(item, runner), true); !found {
+					outcome.run(item, runner)
+				}
+			}
+		}()
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(stop) })
+		workers.Wait()
+	}
+}
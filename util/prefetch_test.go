@@ -0,0 +1,270 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+/**
+ * Creates a runner in a temporary directory, removed with its Cleanup
+ */
+func createTestRunner(t *testing.T) *Runner {
+	runner, err := CreateRunner(&Config{Env: make(map[string]string)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runner
+}
+
+func TestCanPrefetchItemCheck(t *testing.T) {
+	runner := createTestRunner(t)
+	defer runner.Cleanup()
+	runner.Config.UserLib = "function lib_fetch() {\n  cat $CACHE_DIR/x\n}\nother_fetch () {\n  :\n}\n"
+	exitCode := 0
+	cases := []struct {
+		name string
+		item ChecklistItem
+		want bool
+	}{
+		{"passive", ChecklistItem{Script: "echo ok", ExpectMatch: "ok"}, true},
+		{"no checks", ChecklistItem{Script: "echo ok"}, false},
+		{"condition", ChecklistItem{Script: "echo ok", ExpectMatch: "ok", RunIf: &ItemCondition{}}, false},
+		{"dependency", ChecklistItem{Script: "echo ok", ExpectMatch: "ok", DependsOn: []string{"a"}}, false},
+		{"cost", ChecklistItem{Script: "echo ok", ExpectMatch: "ok", Cost: 1}, false},
+		{"runbook", ChecklistItem{Script: "echo ok", ExpectMatch: "ok", RunbookID: "a"}, false},
+		{"privileged", ChecklistItem{Script: "echo ok", ExpectMatch: "ok", Privileged: true}, false},
+		{"status", ChecklistItem{Script: "echo $PREFLIGHTER_STATUS_A", ExpectMatch: "pass"}, false},
+		{"shared dir", ChecklistItem{Script: "cat $PREFLIGHTER_SHARED_DIR/x", ExpectExitCode: &exitCode}, false},
+		{"cache dir", ChecklistItem{Script: "echo ok", ExpectScript: "test -f $CACHE_DIR/x"}, false},
+		{"wait", ChecklistItem{Wait: &WaitCheck{Until: "test -f $PREFLIGHTER_SHARED_DIR/x"}}, false},
+		{"inline check", ChecklistItem{Check: &InlineCheck{Lang: "python", Code: "print(open(os.environ['CACHE_DIR'] + '/x').read())"}, ExpectMatch: "ok"}, false},
+		{"lib function", ChecklistItem{Script: "lib_fetch | grep ok", ExpectMatch: "ok"}, false},
+		{"other lib function", ChecklistItem{Script: "other_fetch", ExpectMatch: "ok"}, false},
+		{"cached helper", ChecklistItem{Script: "cached_dcos node", ExpectMatch: "ok"}, true},
+		{"lib function prefix", ChecklistItem{Script: "lib_fetcher", ExpectMatch: "ok"}, true},
+	}
+	for _, c := range cases {
+		if got := CanPrefetchItemCheck(&c.item, runner); got != c.want {
+			t.Errorf("%s: CanPrefetchItemCheck() = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestPrefetchItemChecks(t *testing.T) {
+	runner := createTestRunner(t)
+	defer runner.Cleanup()
+	var items []*ChecklistItem
+	for i := 1; i <= 6; i++ {
+		items = append(items, &ChecklistItem{Script: fmt.Sprintf("sleep 0.3; echo v%d", i), ExpectMatch: "v"})
+	}
+
+	started := time.Now()
+	stop := PrefetchItemChecks(items, runner, 6)
+	defer stop()
+	for i, item := range items {
+		value, _, ok, err := RunItemCheck(item, runner)
+		if want := fmt.Sprintf("v%d", i+1); value != want || !ok || err != nil {
+			t.Errorf("item %d: got (%q, %v, %v), want (%q, true, nil)", i+1, value, ok, err, want)
+		}
+		if d := ItemCheckDuration(item, runner); d < 300*time.Millisecond {
+			t.Errorf("item %d: duration %s, expecting the time of its check", i+1, d)
+		}
+	}
+	if elapsed := time.Since(started); elapsed > 1500*time.Millisecond {
+		t.Errorf("the checks took %s, expecting them to run at once", elapsed)
+	}
+
+	// The outcomes were used once, so they are cached from now on
+	for i, item := range items {
+		if !IsItemCheckCached(item, runner) {
+			t.Errorf("item %d: expecting its check to be cached after it was used", i+1)
+		}
+	}
+}
+
+func TestPrefetchItemChecksFileMaxConcurrency(t *testing.T) {
+	runner := createTestRunner(t)
+	defer runner.Cleanup()
+	lock := filepath.Join(runner.CacheDir, "lock")
+
+	// The checks of the file limited to 1 fail if they overlap
+	var items []*ChecklistItem
+	for i := 1; i <= 4; i++ {
+		items = append(items, &ChecklistItem{
+			Filename:           "serial.yml",
+			FileMaxConcurrency: 1,
+			Script:             fmt.Sprintf("mkdir %s || exit 1; sleep 0.2; rmdir %s; echo ok%d", lock, lock, i),
+			ExpectMatch:        "ok",
+		})
+	}
+	for i := 1; i <= 4; i++ {
+		items = append(items, &ChecklistItem{Filename: "parallel.yml", Script: fmt.Sprintf("sleep 0.2; echo v%d", i), ExpectMatch: "v"})
+	}
+
+	started := time.Now()
+	stop := PrefetchItemChecks(items, runner, 8)
+	defer stop()
+	for i, item := range items {
+		if _, serr, ok, err := RunItemCheck(item, runner); !ok || err != nil {
+			t.Errorf("item %d: failed with %v: %s", i+1, err, serr)
+		}
+	}
+	if elapsed := time.Since(started); elapsed < 800*time.Millisecond {
+		t.Errorf("the checks took %s, expecting the ones of serial.yml to run one at a time", elapsed)
+	}
+}
+
+func TestPrefetchItemChecksMutex(t *testing.T) {
+	runner := createTestRunner(t)
+	defer runner.Cleanup()
+	lock := filepath.Join(runner.CacheDir, "lock")
+
+	// The checks with the same mutex fail if they overlap, the others run at
+	// the same time
+	var items []*ChecklistItem
+	for i := 1; i <= 3; i++ {
+		items = append(items, &ChecklistItem{
+			Filename:    fmt.Sprintf("file%d.yml", i),
+			Mutex:       "lock",
+			Script:      fmt.Sprintf("mkdir %s || exit 1; sleep 0.2; rmdir %s; echo ok%d", lock, lock, i),
+			ExpectMatch: "ok",
+		})
+		items = append(items, &ChecklistItem{Script: fmt.Sprintf("sleep 0.2; echo v%d", i), ExpectMatch: "v"})
+	}
+
+	started := time.Now()
+	stop := PrefetchItemChecks(items, runner, 6)
+	defer stop()
+	for i, item := range items {
+		if _, serr, ok, err := RunItemCheck(item, runner); !ok || err != nil {
+			t.Errorf("item %d: failed with %v: %s", i+1, err, serr)
+		}
+	}
+	if elapsed := time.Since(started); elapsed < 600*time.Millisecond || elapsed > 1200*time.Millisecond {
+		t.Errorf("the checks took %s, expecting the ones with the mutex to run one at a time", elapsed)
+	}
+}
+
+func TestPrefetchItemChecksNotCachedBeforeUse(t *testing.T) {
+	runner := createTestRunner(t)
+	defer runner.Cleanup()
+	item := &ChecklistItem{Script: "echo ok", ExpectMatch: "ok"}
+	other := &ChecklistItem{Script: "sleep 0.5; echo other", ExpectMatch: "other"}
+
+	// With a single check in the background, the first item is still
+	// running when the run gets to it
+	stop := PrefetchItemChecks([]*ChecklistItem{other, item}, runner, 2)
+	defer stop()
+	time.Sleep(100 * time.Millisecond)
+	if IsItemCheckCached(other, runner) {
+		t.Errorf("a check running in the background is reported as cached")
+	}
+	if value, _, _, _ := RunItemCheck(other, runner); value != "other" {
+		t.Errorf("got %q, want other", value)
+	}
+}
+
+func TestPrefetchItemChecksStop(t *testing.T) {
+	runner := createTestRunner(t)
+	defer runner.Cleanup()
+	dir := filepath.Join(runner.CacheDir, "started")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	var items []*ChecklistItem
+	for i := 1; i <= 10; i++ {
+		items = append(items, &ChecklistItem{Script: fmt.Sprintf("touch %s/%d; sleep 0.2; echo ok", dir, i), ExpectMatch: "ok"})
+	}
+	count := func() int {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(files)
+	}
+
+	stop := PrefetchItemChecks(items, runner, 3)
+	time.Sleep(100 * time.Millisecond)
+	stop()
+
+	// The running checks completed, and no other check starts afterwards
+	stopped := count()
+	if stopped == 0 || stopped >= len(items) {
+		t.Fatalf("%d checks started before the stop, expecting some of %d", stopped, len(items))
+	}
+	for _, item := range items[:stopped] {
+		runner.lock.Lock()
+		outcome, ok := runner.checks[checkKey(item, runner)]
+		runner.lock.Unlock()
+		if !ok {
+			t.Fatalf("missing the outcome of a started check")
+		}
+		select {
+		case <-outcome.done:
+		default:
+			t.Errorf("a check was still running after the stop")
+		}
+	}
+	time.Sleep(400 * time.Millisecond)
+	if after := count(); after != stopped {
+		t.Errorf("%d checks started after the stop", after-stopped)
+	}
+
+	// Stopping again does not block
+	stop()
+}
+
+func TestCachedOutputConcurrent(t *testing.T) {
+	runner := createTestRunner(t)
+	defer runner.Cleanup()
+	script := "cached_output key bash -c 'echo run >> $CACHE_DIR/runs; printf partial-; sleep 0.3; echo done'"
+
+	outputs := make(chan string, 4)
+	for i := 0; i < cap(outputs); i++ {
+		go func() {
+			sout, _, err := runner.Run(script)
+			if err != nil {
+				sout = err.Error()
+			}
+			outputs <- sout
+		}()
+	}
+	for i := 0; i < cap(outputs); i++ {
+		if sout := <-outputs; sout != "partial-done\n" {
+			t.Errorf("got %q, want the complete output", sout)
+		}
+	}
+
+	runs, err := ioutil.ReadFile(filepath.Join(runner.CacheDir, "runs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(runs) != "run\n" {
+		t.Errorf("the command ran %d times, want once", len(runs)/4)
+	}
+}
+
+func TestItemCheckKeyWithStatuses(t *testing.T) {
+	runner := createTestRunner(t)
+	defer runner.Cleanup()
+	earlier := &ChecklistItem{Title: "Earlier"}
+	item := &ChecklistItem{Script: "echo ${PREFLIGHTER_STATUS_EARLIER:-none}", ExpectMatch: "."}
+	other := &ChecklistItem{Script: "echo ok", ExpectMatch: "ok"}
+
+	otherKey := checkKey(other, runner)
+	for _, want := range []string{"none", "pass", "fail"} {
+		if want != "none" {
+			runner.SetItemStatus(earlier, want)
+		}
+		if value, _, _, _ := RunItemCheck(item, runner); value != want {
+			t.Errorf("got %q, want %q from the status of the earlier item", value, want)
+		}
+	}
+	if checkKey(other, runner) != otherKey {
+		t.Errorf("the statuses changed the key of a check that does not read them")
+	}
+}
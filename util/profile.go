@@ -0,0 +1,61 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// The CPU profile being written, and the file to write the heap profile to
+// when the process exits
+var profileCPUFile *os.File = nil
+var profileMemFilename = ""
+
+/**
+ * @brief      Starts profiling preflighter itself, for its developers. The
+ *             profiles are written when the process exits with Exit.
+ *
+ * @param      cpuFilename  The file to write the CPU profile to, if any
+ * @param      memFilename  The file to write the heap profile to, if any
+ *
+ * @return     The error occurred, if the CPU profiling could not start
+ */
+func StartProfiling(cpuFilename string, memFilename string) error {
+	if cpuFilename != "" {
+		f, err := os.Create(cpuFilename)
+		if err != nil {
+			return fmt.Errorf("Could not create CPU profile: %s", err.Error())
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return fmt.Errorf("Could not start CPU profile: %s", err.Error())
+		}
+		profileCPUFile = f
+	}
+	profileMemFilename = memFilename
+	return nil
+}
+
+/**
+ * Writes the profiles started with StartProfiling
+ */
+func stopProfiling() {
+	if profileCPUFile != nil {
+		pprof.StopCPUProfile()
+		profileCPUFile.Close()
+		profileCPUFile = nil
+	}
+	if profileMemFilename != "" {
+		f, err := os.Create(profileMemFilename)
+		if err == nil {
+			runtime.GC()
+			err = pprof.WriteHeapProfile(f)
+			f.Close()
+		}
+		if err != nil {
+			UxPrintWarning(fmt.Errorf("Could not write memory profile: %s", err.Error()))
+		}
+		profileMemFilename = ""
+	}
+}
@@ -0,0 +1,72 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+/**
+ * Masks the parts of the captured output that match any of a set of
+ * patterns, before it is shared in reports
+ */
+type Redactor struct {
+	patterns []*regexp.Regexp
+}
+
+/**
+ * Loads the patterns to redact from the file, one regular expression per
+ * line. Empty lines and lines starting with `#` are ignored.
+ */
+func LoadRedactPatterns(filename string) (*Redactor, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read redact patterns %s: %s", filename, err.Error())
+	}
+
+	redactor := &Redactor{}
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		pattern, err := regexp.Compile(line)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid redact pattern on line %d of %s: %s", i+1, filename, err.Error())
+		}
+		redactor.patterns = append(redactor.patterns, pattern)
+	}
+	return redactor, nil
+}
+
+/**
+ * Returns the text with the matches of every pattern masked
+ */
+func (r *Redactor) Redact(text string) string {
+	if r == nil {
+		return text
+	}
+	for _, pattern := range r.patterns {
+		text = pattern.ReplaceAllLiteralString(text, "********")
+	}
+	return text
+}
+
+/**
+ * Masks the output and the environment captured in the result
+ */
+func (r *Redactor) RedactResult(result *ItemResult) {
+	if r == nil {
+		return
+	}
+	result.Value = r.Redact(result.Value)
+	result.Stdout = r.Redact(result.Stdout)
+	result.Stderr = r.Redact(result.Stderr)
+	for i := range result.SubResults {
+		result.SubResults[i].Message = r.Redact(result.SubResults[i].Message)
+	}
+	for key, value := range result.Env {
+		result.Env[key] = r.Redact(value)
+	}
+}
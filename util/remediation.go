@@ -0,0 +1,42 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+/**
+ * @brief      Writes a shell script with the remediation commands of all the
+ *             failed items, to be reviewed and run by the operator
+ *
+ * @param      filename  The file to write the script to
+ * @param      summary   The summary of the run
+ *
+ * @return     Returns true if the script was written, false if no failed
+ *             item has remediation commands, and the error occurred or nil
+ */
+func WriteRemediationScript(filename string, summary *RunSummary) (bool, error) {
+	script := ""
+	for i, result := range summary.Results {
+		if result.Status != STATUS_FAIL || result.Item.Remediation == "" {
+			continue
+		}
+		script += fmt.Sprintf("\n# ---------------------------------------------\n# %d. %s\n", i+1, result.Item.Title)
+		if result.Item.Category != "" {
+			script += fmt.Sprintf("# Category: %s\n", result.Item.Category)
+		}
+		script += "# ---------------------------------------------\n"
+		script += strings.TrimRight(result.Item.Remediation, "\n") + "\n"
+	}
+	if script == "" {
+		return false, nil
+	}
+
+	script = "#!/usr/bin/env bash\n# Remediation of the failed pre-flight checks, review before running\n" + script
+	err := ioutil.WriteFile(filename, []byte(script), 0755)
+	if err != nil {
+		return false, fmt.Errorf("Could not write remediation script %s: %s", filename, err.Error())
+	}
+	return true, nil
+}
@@ -0,0 +1,135 @@
+package util
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"time"
+)
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"duration": func(d time.Duration) string { return d.Round(time.Millisecond).String() },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} Pre-Flight Checklist</title>
+<style>
+  body { font-family: -apple-system, Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 60em; color: #222; }
+  h1 { margin-bottom: 0.2em; }
+  .description { color: #666; margin-top: 0; }
+  .meta th { text-align: left; padding-right: 1em; color: #666; }
+  .counts span { display: inline-block; margin-right: 1.5em; font-weight: bold; }
+  details { border: 1px solid #ddd; border-left-width: 6px; border-radius: 3px; margin: 0.4em 0; padding: 0.4em 0.8em; }
+  summary { cursor: pointer; }
+  summary .duration { float: right; color: #888; }
+  pre { background: #f6f6f6; padding: 0.6em; overflow-x: auto; white-space: pre-wrap; }
+  .pass { border-left-color: #2ea44f; } .pass .status, .counts .pass { color: #2ea44f; }
+  .fail { border-left-color: #cb2431; } .fail .status, .counts .fail { color: #cb2431; }
+  .warning { border-left-color: #999; } .warning .status, .counts .warning { color: #999; }
+  .skip { border-left-color: #dbab09; } .skip .status, .counts .skip { color: #dbab09; }
+  .unknown { border-left-color: #8250df; } .unknown .status, .counts .unknown { color: #8250df; }
+</style>
+</head>
+<body>
+<h1>{{.Title}} Pre-Flight Checklist</h1>
+{{if .Description}}<p class="description">{{.Description}}</p>{{end}}
+<p>Generated on {{.Generated}}</p>
+{{if .Summary.Meta}}<table class="meta">
+{{range $k, $v := .Summary.Meta}}  <tr><th>{{$k}}</th><td>{{$v}}</td></tr>
+{{end}}</table>{{end}}
+{{range .Files}}{{if .Meta}}<p><b>{{.Title}}</b> ({{.Filename}})</p>
+<table class="meta">
+{{range .MetaPairs}}  <tr><th>{{index . 0}}</th><td>{{index . 1}}</td></tr>
+{{end}}</table>{{end}}{{end}}
+<p class="counts">
+  <span class="pass">{{.Summary.Passed}} passed</span>
+  <span class="fail">{{.Summary.Failed}} failed{{with .Summary.FailureCategories}} ({{.}}){{end}}</span>
+  {{if .Summary.Warnings}}<span class="warning">{{.Summary.Warnings}} warnings</span>{{end}}
+  {{if .Summary.XFailed}}<span class="warning">{{.Summary.XFailed}} failed as expected</span>{{end}}
+  {{if .Summary.XPassed}}<span class="warning">{{.Summary.XPassed}} unexpectedly passed</span>{{end}}
+  {{if .Summary.Unknown}}<span class="unknown">{{.Summary.Unknown}} unknown (as {{.Summary.UnknownAs}})</span>{{end}}
+  <span class="skip">{{.Summary.Skipped}} skipped</span>
+  <span>{{.Summary.Total}} total</span>
+</p>
+{{range .Summary.Snapshots}}
+<details class="{{if .Verified}}pass{{else}}fail{{end}}">
+  <summary>
+    <span class="status">{{if .Verified}}VERIFIED{{else}}VERIFICATION FAILED{{end}}</span> &ndash; Snapshot of {{.Checklist}}
+  </summary>
+  {{if .Output}}<pre>{{.Output}}</pre>{{end}}
+  {{if and (not .Verified) .VerifyOutput}}<p><b>Verification Output</b></p>
+  <pre>{{.VerifyOutput}}</pre>{{end}}
+</details>
+{{end}}
+{{range $i, $r := .Results}}
+<details class="{{index $.Classes $i}}">
+  <summary>
+    <span class="status">{{index $.Labels $i}}</span> &ndash; {{$r.Item.Title}}
+    <span class="duration">{{duration $r.Duration}}</span>
+  </summary>
+  {{if $r.Value}}<p><b>Value:</b> {{$r.Value}}</p>{{end}}
+  {{if $r.Item.Category}}<p><b>Category:</b> {{$r.Item.Category}}</p>{{end}}
+  {{if $r.FixApplied}}<p><b>Fix:</b> applied, {{if $r.FixResolved}}resolved the failure{{else}}did not resolve the failure{{end}}</p>{{end}}
+  {{if $r.Item.DocURL}}<p><b>Documentation:</b> <a href="{{$r.Item.DocURL}}">{{$r.Item.DocURL}}</a></p>{{end}}
+  <p><b>Script</b></p>
+  <pre>{{$r.Item.Script}}</pre>
+  {{if $r.Stdout}}<p><b>Standard Output</b></p>
+  <pre>{{$r.Stdout}}</pre>{{end}}
+  {{if $r.Stderr}}<p><b>Standard Error</b></p>
+  <pre>{{$r.Stderr}}</pre>{{end}}
+  {{if $r.Env}}<p><b>Environment</b></p>
+  <pre>{{$r.EnvText}}</pre>{{end}}
+</details>
+{{end}}
+</body>
+</html>
+`))
+
+/**
+ * @brief      Writes a self-contained HTML report of the run
+ *
+ * @param      filename  The file to write the report to
+ * @param      title     The title of the run
+ * @param      files     The checklist files, the first gives the report its
+ *                       description
+ * @param      summary   The summary of the run
+ *
+ * @return     Returns the error occurred or nil
+ */
+func WriteHTMLReport(filename string, title string, files []*ChecklistFile, summary *RunSummary) error {
+	results := summary.VisibleResults()
+	var classes, labels []string
+	for _, result := range results {
+		class := result.Status
+		if result.Unknown {
+			class = "unknown"
+		} else if result.Status == STATUS_FAIL && result.Item.ToleratesFailure() {
+			class = "warning"
+		}
+		classes = append(classes, class)
+		labels = append(labels, result.Label())
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("Could not create %s: %s", filename, err.Error())
+	}
+	defer f.Close()
+
+	err = htmlReportTemplate.Execute(f, map[string]interface{}{
+		"Title":       title,
+		"Description": files[0].Description,
+		"Files":       files,
+		"Generated":   time.Now().Format(time.RFC1123),
+		"Summary":     summary,
+		"Results":     results,
+		"Classes":     classes,
+		"Labels":      labels,
+	})
+	if err != nil {
+		return fmt.Errorf("Could not write %s: %s", filename, err.Error())
+	}
+
+	return nil
+}
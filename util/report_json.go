@@ -0,0 +1,173 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+type jsonReportCounts struct {
+	Passed   int `json:"passed"`
+	Failed   int `json:"failed"`
+	Warnings int `json:"warnings"`
+	Skipped  int `json:"skipped"`
+	XFailed  int `json:"xfailed,omitempty"`
+	XPassed  int `json:"xpassed,omitempty"`
+	Unknown  int `json:"unknown,omitempty"`
+	Total    int `json:"total"`
+	Cost     int `json:"cost,omitempty"`
+
+	// The remaining items were aborted after -max-failures failures
+	StoppedEarly bool `json:"stopped_early,omitempty"`
+}
+
+type jsonReportItem struct {
+	Index        int    `json:"index"`
+	Title        string `json:"title"`
+	Filename     string `json:"filename,omitempty"`
+	Category     string `json:"category,omitempty"`
+	DocURL       string `json:"doc_url,omitempty"`
+	Status       string `json:"status"`
+	AllowFailure bool   `json:"allow_failure,omitempty"`
+	ExpectFail   bool   `json:"expect_fail,omitempty"`
+	Unknown      bool   `json:"unknown,omitempty"`
+	Value        string `json:"value,omitempty"`
+	Stdout       string `json:"stdout,omitempty"`
+	Stderr       string `json:"stderr,omitempty"`
+	DurationMs   int64  `json:"duration_ms"`
+	FixApplied   bool   `json:"fix_applied,omitempty"`
+	FixResolved  bool   `json:"fix_resolved,omitempty"`
+
+	SubResults []jsonReportSubResult `json:"sub_results,omitempty"`
+
+	Env map[string]string `json:"env,omitempty"`
+}
+
+type jsonReportSubResult struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+type jsonReportSnapshot struct {
+	Checklist    string `json:"checklist"`
+	Snapshot     string `json:"snapshot,omitempty"`
+	Verified     bool   `json:"verified"`
+	VerifyOutput string `json:"verify_output,omitempty"`
+}
+
+type jsonReport struct {
+	Title     string               `json:"title"`
+	Generated string               `json:"generated"`
+	Meta      map[string]string    `json:"meta,omitempty"`
+	Success   bool                 `json:"success"`
+	Summary   jsonReportCounts     `json:"summary"`
+	Snapshots []jsonReportSnapshot `json:"snapshots,omitempty"`
+	Items     []jsonReportItem     `json:"items"`
+}
+
+/**
+ * Converts the summary of the run to its JSON report
+ */
+func createJSONReport(title string, summary *RunSummary, failure bool) *jsonReport {
+	report := &jsonReport{
+		Title:     title,
+		Generated: time.Now().Format(time.RFC3339),
+		Meta:      summary.Meta,
+		Success:   !failure,
+		Summary: jsonReportCounts{
+			Passed:   summary.Passed,
+			Failed:   summary.Failed,
+			Warnings: summary.Warnings,
+			Skipped:  summary.Skipped,
+			XFailed:  summary.XFailed,
+			XPassed:  summary.XPassed,
+			Unknown:  summary.Unknown,
+			Total:    summary.Total(),
+			Cost:     summary.Cost,
+
+			StoppedEarly: summary.StoppedEarly,
+		},
+		Items: []jsonReportItem{},
+	}
+	for _, snapshot := range summary.Snapshots {
+		report.Snapshots = append(report.Snapshots, jsonReportSnapshot{
+			Checklist:    snapshot.Checklist,
+			Snapshot:     snapshot.Output,
+			Verified:     snapshot.Verified,
+			VerifyOutput: snapshot.VerifyOutput,
+		})
+	}
+	for i, result := range summary.VisibleResults() {
+		var subResults []jsonReportSubResult
+		for _, sub := range result.SubResults {
+			subResults = append(subResults, jsonReportSubResult{sub.Name, sub.Status, sub.Message})
+		}
+		status := result.Status
+		if result.Blank {
+			status = STATUS_BLANK
+		}
+		report.Items = append(report.Items, jsonReportItem{
+			Index:        i + 1,
+			Title:        result.Item.Title,
+			Filename:     result.Item.Filename,
+			Category:     result.Item.Category,
+			DocURL:       result.Item.DocURL,
+			Status:       status,
+			AllowFailure: result.Item.AllowFailure,
+			ExpectFail:   result.Item.ExpectFail,
+			Unknown:      result.Unknown,
+			Value:        result.Value,
+			Stdout:       result.Stdout,
+			Stderr:       result.Stderr,
+			DurationMs:   int64(result.Duration / time.Millisecond),
+			FixApplied:   result.FixApplied,
+			FixResolved:  result.FixResolved,
+			SubResults:   subResults,
+			Env:          result.Env,
+		})
+	}
+	return report
+}
+
+/**
+ * @brief      Writes a JSON report of the run
+ *
+ * @param      filename  The file to write the report to
+ * @param      title     The title of the report
+ * @param      summary   The summary of the run
+ * @param      failure   True if the run failed
+ *
+ * @return     Returns the error occurred or nil
+ */
+func WriteJSONReport(filename string, title string, summary *RunSummary, failure bool) error {
+	content, err := json.MarshalIndent(createJSONReport(title, summary, failure), "", "  ")
+	if err != nil {
+		return fmt.Errorf("Could not marshal JSON report: %s", err.Error())
+	}
+
+	err = ioutil.WriteFile(filename, append(content, '\n'), 0644)
+	if err != nil {
+		return fmt.Errorf("Could not write %s: %s", filename, err.Error())
+	}
+	return nil
+}
+
+/**
+ * Prints the results of the items as a JSON array, with the same objects as
+ * the items of the JSON report, for the -format json output
+ */
+func PrintJSONResults(w io.Writer, summary *RunSummary) error {
+	content, err := json.MarshalIndent(createJSONReport("", summary, false).Items, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Could not marshal JSON results: %s", err.Error())
+	}
+
+	_, err = w.Write(append(content, '\n'))
+	if err != nil {
+		return fmt.Errorf("Could not write the JSON results: %s", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package util
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"time"
+)
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+	SystemErr string        `xml:"system-err,omitempty"`
+}
+
+type junitTestSuite struct {
+	XMLName    xml.Name        `xml:"testsuite"`
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	TestCases  []junitTestCase `xml:"testcase"`
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+/**
+ * @brief      Writes a JUnit XML report of the run, where every item is a test
+ *             case. The allowed failures are not reported as failures, but
+ *             their details are kept in the error output.
+ *
+ * @param      filename  The file to write the report to
+ * @param      title     The name of the test suite
+ * @param      summary   The summary of the run
+ *
+ * @return     Returns the error occurred or nil
+ */
+func WriteJUnitReport(filename string, title string, summary *RunSummary) error {
+	suite := junitTestSuite{
+		Name:      title,
+		Tests:     summary.Total(),
+		Failures:  summary.Failed,
+		Skipped:   summary.Skipped,
+		Timestamp: time.Now().Format("2006-01-02T15:04:05"),
+	}
+
+	var keys []string
+	for key := range summary.Meta {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		suite.Properties = append(suite.Properties, junitProperty{key, summary.Meta[key]})
+	}
+
+	var total time.Duration
+	for _, result := range summary.VisibleResults() {
+		total += result.Duration
+		tc := junitTestCase{
+			Name:      result.Item.Title,
+			ClassName: title,
+			Time:      junitSeconds(result.Duration),
+			SystemOut: result.Stdout,
+			SystemErr: result.Stderr,
+		}
+		if result.Item.Category != "" {
+			tc.ClassName = title + "." + result.Item.Category
+		}
+		switch result.Status {
+		case STATUS_FAIL:
+			if result.Item.ExpectFail {
+				tc.SystemErr = "Expected failure: " + result.Value + "\n" + result.Stderr
+			} else if result.Item.AllowFailure {
+				tc.SystemErr = "Allowed failure: " + result.Value + "\n" + result.Stderr
+			} else {
+				tc.Failure = &junitMessage{Message: result.Value, Body: result.Stderr}
+				if len(result.Env) > 0 {
+					tc.Failure.Body += "\n--- environment ---\n" + result.EnvText()
+				}
+			}
+		case STATUS_SKIP:
+			tc.Skipped = &junitMessage{Message: result.Value}
+		}
+		// The unknown outcomes are not counted with the failed and skipped
+		if result.Unknown && tc.Failure != nil {
+			suite.Failures += 1
+		} else if result.Unknown && tc.Skipped != nil {
+			suite.Skipped += 1
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+	suite.Time = junitSeconds(total)
+
+	content, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Could not marshal JUnit report: %s", err.Error())
+	}
+
+	err = ioutil.WriteFile(filename, append([]byte(xml.Header), append(content, '\n')...), 0644)
+	if err != nil {
+		return fmt.Errorf("Could not write %s: %s", filename, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+)
+
+/**
+ * Escapes the text for a Markdown table cell
+ */
+func markdownCell(text string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(text)
+}
+
+/**
+ * @brief      Writes a Markdown report of the run, with a table of all the
+ *             items and the details of the failed ones
+ *
+ * @param      filename  The file to write the report to
+ * @param      title     The title of the report
+ * @param      summary   The summary of the run
+ *
+ * @return     Returns the error occurred or nil
+ */
+func WriteMarkdownReport(filename string, title string, summary *RunSummary) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s Pre-Flight Checklist\n\n", title)
+	fmt.Fprintf(&b, "Generated on %s\n\n", time.Now().Format(time.RFC1123))
+
+	if len(summary.Meta) > 0 {
+		var keys []string
+		for key := range summary.Meta {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		b.WriteString("| Metadata | Value |\n|---|---|\n")
+		for _, key := range keys {
+			fmt.Fprintf(&b, "| %s | %s |\n", markdownCell(key), markdownCell(summary.Meta[key]))
+		}
+		b.WriteString("\n")
+	}
+
+	fmt.Fprintf(&b, "**%d passed**, **%d failed**", summary.Passed, summary.Failed)
+	if categories := summary.FailureCategories(); categories != "" {
+		fmt.Fprintf(&b, " (%s)", categories)
+	}
+	if summary.Warnings > 0 {
+		fmt.Fprintf(&b, ", %d warnings", summary.Warnings)
+	}
+	if summary.XFailed > 0 {
+		fmt.Fprintf(&b, ", %d failed as expected", summary.XFailed)
+	}
+	if summary.XPassed > 0 {
+		fmt.Fprintf(&b, ", %d unexpectedly passed", summary.XPassed)
+	}
+	if summary.Unknown > 0 {
+		fmt.Fprintf(&b, ", %d unknown (as %s)", summary.Unknown, summary.UnknownAs)
+	}
+	fmt.Fprintf(&b, ", %d skipped, %d total\n\n", summary.Skipped, summary.Total())
+
+	for _, snapshot := range summary.Snapshots {
+		status := "✅ verified"
+		if !snapshot.Verified {
+			status = "❗️ verification failed"
+		}
+		fmt.Fprintf(&b, "Snapshot of %s (%s):\n\n```\n%s\n```\n\n", snapshot.Checklist, status, snapshot.Output)
+		if !snapshot.Verified && snapshot.VerifyOutput != "" {
+			fmt.Fprintf(&b, "Verification output:\n\n```\n%s\n```\n\n", snapshot.VerifyOutput)
+		}
+	}
+
+	results := summary.VisibleResults()
+	labels := map[string]string{STATUS_PASS: "✅ PASS", STATUS_FAIL: "❗️ FAIL", STATUS_SKIP: "SKIP"}
+	b.WriteString("| # | Status | Item | Value | Duration |\n|---|---|---|---|---|\n")
+	for i, result := range results {
+		label := labels[result.Status]
+		switch {
+		case result.Unknown:
+			label = "❓ UNKNOWN"
+		case result.Status == STATUS_FAIL && result.Item.ToleratesFailure():
+			label = "⚠️ " + result.Label()
+		case result.Status == STATUS_PASS && result.Item.ExpectFail:
+			label = "✅ XPASS"
+		}
+		fmt.Fprintf(&b, "| %d | %s | %s | %s | %s |\n", i+1, label,
+			markdownCell(result.Item.Title), markdownCell(result.Value),
+			result.Duration.Round(time.Millisecond))
+	}
+
+	for i, result := range results {
+		if result.Status != STATUS_FAIL {
+			continue
+		}
+		fmt.Fprintf(&b, "\n## %d. %s\n\n", i+1, result.Item.Title)
+		if result.Item.Category != "" {
+			fmt.Fprintf(&b, "Category: %s\n\n", result.Item.Category)
+		}
+		if result.FixApplied {
+			b.WriteString("The fix was applied, but it did not resolve the failure.\n\n")
+		}
+		if result.Item.DocURL != "" {
+			fmt.Fprintf(&b, "Documentation: <%s>\n\n", result.Item.DocURL)
+		}
+		fmt.Fprintf(&b, "Script:\n\n```sh\n%s\n```\n\n", strings.TrimRight(result.Item.Script, "\n"))
+		fmt.Fprintf(&b, "Output:\n\n```\n%s\n```\n", strings.TrimRight(result.Stdout+"\n"+result.Stderr, "\n"))
+		if len(result.SubResults) > 0 {
+			b.WriteString("\nTest cases:\n\n")
+			for _, sub := range result.SubResults {
+				fmt.Fprintf(&b, "- %s %s", strings.ToUpper(sub.Status), sub.Name)
+				if sub.Status != STATUS_PASS && sub.Message != "" {
+					fmt.Fprintf(&b, ": %s", strings.Split(sub.Message, "\n")[0])
+				}
+				b.WriteString("\n")
+			}
+		}
+		if len(result.Env) > 0 {
+			fmt.Fprintf(&b, "\nEnvironment:\n\n```\n%s\n```\n", result.EnvText())
+		}
+	}
+
+	err := ioutil.WriteFile(filename, []byte(b.String()), 0644)
+	if err != nil {
+		return fmt.Errorf("Could not write %s: %s", filename, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+/**
+ * A passing item result, persisted across runs
+ */
+type cachedResult struct {
+	Value   string
+	Expires time.Time
+}
+
+func resultCachePath(item *ChecklistItem, runner *Runner) string {
+	return filepath.Join(runner.Config.ResultCacheDir, checkKey(item, runner)+".yaml")
+}
+
+/**
+ * Checks if the item's result can be cached across runs
+ */
+func isResultCacheable(item *ChecklistItem, runner *Runner) bool {
+	if item.GoldenFile != "" && runner.Config.UpdateGolden {
+		return false
+	}
+	return runner.Config.ResultCacheDir != "" && item.GetCacheTTL() > 0
+}
+
+/**
+ * Returns the value of a passing result of an identical check that was
+ * stored by an earlier run and did not expire yet
+ */
+func LoadCachedResult(item *ChecklistItem, runner *Runner) (string, time.Time, bool) {
+	if !isResultCacheable(item, runner) {
+		return "", time.Time{}, false
+	}
+
+	content, err := ioutil.ReadFile(resultCachePath(item, runner))
+	if err != nil {
+		return "", time.Time{}, false
+	}
+
+	var cached cachedResult
+	err = yaml.Unmarshal(content, &cached)
+	if err != nil || time.Now().After(cached.Expires) {
+		return "", time.Time{}, false
+	}
+	return cached.Value, cached.Expires, true
+}
+
+/**
+ * Stores the value of a passing result for the TTL of the item
+ */
+func StoreCachedResult(item *ChecklistItem, runner *Runner, value string) error {
+	if !isResultCacheable(item, runner) {
+		return nil
+	}
+
+	content, err := yaml.Marshal(cachedResult{
+		Value:   value,
+		Expires: time.Now().Add(item.GetCacheTTL()),
+	})
+	if err != nil {
+		return fmt.Errorf("Could not marshal cached result: %s", err.Error())
+	}
+
+	err = os.MkdirAll(runner.Config.ResultCacheDir, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("Could not create cache directory: %s", err.Error())
+	}
+	err = ioutil.WriteFile(resultCachePath(item, runner), content, 0600)
+	if err != nil {
+		return fmt.Errorf("Could not write cached result: %s", err.Error())
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"regexp"
 	"strings"
@@ -15,10 +16,33 @@ import (
 	"github.com/lithammer/dedent"
 )
 
+// The number of checklist items to request on every page
+const checklistPageSize = 100
+
 type RunbookClient struct {
 	client    *http.Client
 	baseUrl   string
 	authToken string
+	codes     RunbookStatusCodes
+}
+
+/**
+ * The metadata of a runbook step
+ */
+type RunbookStepInfo struct {
+	Name      string `json:"name"`
+	Owner     string `json:"owner"`
+	Component string `json:"component"`
+}
+
+/**
+ * Describes the step, e.g. "Update the frontend (owner: jane)"
+ */
+func (i *RunbookStepInfo) String() string {
+	if i.Owner == "" {
+		return i.Name
+	}
+	return fmt.Sprintf("%s (owner: %s)", i.Name, i.Owner)
 }
 
 type apiResponse struct {
@@ -42,6 +66,7 @@ func CreateRunbookClient(baseUrl string, authToken string) (*RunbookClient, erro
 		client:    client,
 		baseUrl:   baseUrl,
 		authToken: authToken,
+		codes:     DefaultRunbookStatusCodes,
 	}, nil
 }
 
@@ -59,7 +84,24 @@ func CreateRunbookClientWithEnvConfig() (*RunbookClient, error) {
 		return nil, fmt.Errorf("Missing Personal Authentication Token in the RUNBOOK_KEY environment variable")
 	}
 
-	return CreateRunbookClient(baseUrl, authToken)
+	codes, err := RunbookStatusCodesFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := CreateRunbookClient(baseUrl, authToken)
+	if err != nil {
+		return nil, err
+	}
+	client.codes = codes
+	return client, nil
+}
+
+/**
+ * Returns the codes of the statuses of the checklist items
+ */
+func (c *RunbookClient) StatusCodes() RunbookStatusCodes {
+	return c.codes
 }
 
 /**
@@ -148,16 +190,68 @@ func (c *RunbookClient) GetVariables(domain string) (map[string]string, error) {
 	return vars, nil
 }
 
+/**
+ * @brief      Returns the metadata of the given step
+ *
+ * @param      step  The step
+ *
+ * @return     The step metadata, or nil if the step has no name
+ */
+func (c *RunbookClient) StepInfo(step string) (*RunbookStepInfo, error) {
+	var info RunbookStepInfo
+	err := c.apiDo("GET", fmt.Sprintf("/step/%s", step), nil, &info)
+	if err != nil {
+		return nil, err
+	}
+	if info.Name == "" {
+		return nil, nil
+	}
+	return &info, nil
+}
+
+/**
+ * Splits a runbook step reference of the form `STEPID?key=value&...` in the
+ * step identifier and the parameters to fetch its checklist with
+ */
+func ParseRunbookStepRef(ref string) (string, url.Values, error) {
+	parts := strings.SplitN(ref, "?", 2)
+	if len(parts) == 1 {
+		return ref, nil, nil
+	}
+	params, err := url.ParseQuery(parts[1])
+	if err != nil {
+		return "", nil, fmt.Errorf("Invalid parameters of runbook step %s: %s", ref, err.Error())
+	}
+	return parts[0], params, nil
+}
+
 /**
  * @brief      Try to compose a set of commands to invoke by fetching the
  *             instructions from the runbook app.
  *
- * @param      component  The component
  * @param      step       The step
+ * @param      params     The parameters forwarded to the runbook API, that
+ *                        can influence the items returned (e.g. a version)
  *
  * @return     Returns
  */
-func (c *RunbookClient) ChecklistFromRunbook(step string) (Checklist, error) {
+func (c *RunbookClient) ChecklistFromRunbook(step string, params url.Values) (Checklist, error) {
+	return c.itemsFromRunbook(step, params, false)
+}
+
+/**
+ * @brief      Fetches all the open items of the step, including the ones
+ *             without a shell script in the instructions, that are returned
+ *             with an empty script
+ *
+ * @param      step    The step
+ * @param      params  The parameters forwarded to the runbook API
+ */
+func (c *RunbookClient) AllItemsFromRunbook(step string, params url.Values) (Checklist, error) {
+	return c.itemsFromRunbook(step, params, true)
+}
+
+func (c *RunbookClient) itemsFromRunbook(step string, params url.Values, withoutScripts bool) (Checklist, error) {
 	rxBlock := regexp.MustCompile(`\x60\x60\x60sh([\w\W]*)\x60\x60\x60`)
 	type RunbookChecklistItem struct {
 		Id     string `json:"id"`
@@ -174,8 +268,17 @@ func (c *RunbookClient) ChecklistFromRunbook(step string) (Checklist, error) {
 	// Get all the dynamic variables used in the operation
 	vars, err := c.GetVariables("global")
 
+	query := ""
+	if len(params) > 0 {
+		query = "&" + params.Encode()
+	}
+
 	// Get the step info to get the instructions markdown
-	err = c.apiDo("GET", fmt.Sprintf("/step/%s", step), nil, &stepInfo)
+	stepPath := fmt.Sprintf("/step/%s", step)
+	if query != "" {
+		stepPath += "?" + query[1:]
+	}
+	err = c.apiDo("GET", stepPath, nil, &stepInfo)
 	if err != nil {
 		return nil, err
 	}
@@ -187,10 +290,37 @@ func (c *RunbookClient) ChecklistFromRunbook(step string) (Checklist, error) {
 		return nil, err
 	}
 
-	// Then collect the tokenized step details
-	err = c.apiDo("GET", fmt.Sprintf("/step/%s/checklist", step), nil, &checklists)
-	if err != nil {
-		return nil, err
+	// Then collect the tokenized step details, one page at a time
+	seen := make(map[string]bool)
+	for page := 1; ; page++ {
+		var pageItems []RunbookChecklistItem
+		err = c.apiDo("GET", fmt.Sprintf("/step/%s/checklist?page=%d&per_page=%d%s", step, page, checklistPageSize, query), nil, &pageItems)
+		if err != nil {
+			return nil, err
+		}
+
+		// Stop if the server does not paginate and keeps returning the
+		// same items over and over again. The items without an ID are not
+		// told apart, so only the others show the progress.
+		var fresh []RunbookChecklistItem
+		added := 0
+		for _, item := range pageItems {
+			if item.Id != "" {
+				if seen[item.Id] {
+					continue
+				}
+				seen[item.Id] = true
+				added += 1
+			}
+			fresh = append(fresh, item)
+		}
+		if page > 1 && added == 0 {
+			break
+		}
+		checklists = append(checklists, fresh...)
+		if len(pageItems) < checklistPageSize {
+			break
+		}
 	}
 
 	// Get all the items from the markdown in order to preserve the order
@@ -230,6 +360,13 @@ func (c *RunbookClient) ChecklistFromRunbook(step string) (Checklist, error) {
 		// On each markdown block, try to locate a shell script block
 		parts = rxBlock.FindStringSubmatch(parts[1])
 		if parts == nil {
+			if withoutScripts {
+				checklist = append(checklist, ChecklistItem{
+					Title:       item.Title,
+					RunbookID:   item.Id,
+					RunbookStep: step,
+				})
+			}
 			continue
 		}
 
@@ -251,6 +388,26 @@ func (c *RunbookClient) ChecklistFromRunbook(step string) (Checklist, error) {
 	return checklist, nil
 }
 
+/**
+ * @brief      Returns the current status of the checklist item
+ *
+ * @param      stepId  The step identifier
+ * @param      itemId  The item identifier
+ *
+ * @return     The status of the item, or the failure if it happened
+ */
+func (c *RunbookClient) ChecklistItemStatus(stepId string, itemId string) (int, error) {
+	var item struct {
+		Status int `json:"status"`
+	}
+
+	err := c.apiDo("GET", fmt.Sprintf("/step/%s/checklist/%s", stepId, itemId), nil, &item)
+	if err != nil {
+		return 0, err
+	}
+	return item.Status, nil
+}
+
 /**
  * @brief      Update the checklist item with the given status
  *
@@ -0,0 +1,145 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+
+	"gopkg.in/yaml.v2"
+)
+
+/**
+ * An interface to the runbook operations used by the checklists
+ */
+type Runbook interface {
+	ChecklistFromRunbook(step string, params url.Values) (Checklist, error)
+	AllItemsFromRunbook(step string, params url.Values) (Checklist, error)
+	StepInfo(step string) (*RunbookStepInfo, error)
+	ChecklistItemStatus(stepId string, itemId string) (int, error)
+	ChecklistItemUpdate(stepId string, itemId string, status int, reason string) error
+	StatusCodes() RunbookStatusCodes
+}
+
+type RunbookFixtureUpdate struct {
+	StepID string
+	ItemID string
+	Status int
+	Reason string
+}
+
+/**
+ * An in-memory runbook that serves canned checklist items
+ */
+type RunbookFixture struct {
+	Steps     map[string]Checklist
+	StepInfos map[string]*RunbookStepInfo `yaml:"step_info"`
+
+	// The initial status of the checklist items, by step and item
+	Statuses map[string]map[string]int
+	Updates  []RunbookFixtureUpdate `yaml:"-"`
+
+	// The codes of the statuses, instead of the default ones
+	Codes RunbookStatusCodes `yaml:"status_codes"`
+}
+
+/**
+ * @brief      Load a runbook fixture from the given YAML file
+ *
+ * @param      filename  The fixture file
+ */
+func LoadRunbookFixture(filename string) (*RunbookFixture, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read %s: %s", filename, err.Error())
+	}
+
+	fixture := RunbookFixture{Codes: DefaultRunbookStatusCodes}
+	err = yaml.Unmarshal(content, &fixture)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse %s: %s", filename, err.Error())
+	}
+	if err = fixture.Codes.Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid status_codes in %s: %s", filename, err.Error())
+	}
+
+	return &fixture, nil
+}
+
+/**
+ * @brief      Return the canned checklist items for the given step, preferring
+ *             the ones defined for the step with the same parameters (e.g.
+ *             `STEPID?version=1.2.3`) if any
+ *
+ * @param      step    The step
+ * @param      params  The parameters of the step
+ */
+func (f *RunbookFixture) ChecklistFromRunbook(step string, params url.Values) (Checklist, error) {
+	items, ok := f.Steps[step+"?"+params.Encode()]
+	if !ok {
+		items, ok = f.Steps[step]
+	}
+	if !ok {
+		return nil, fmt.Errorf("Step %s is not defined in the fixture", step)
+	}
+
+	var checklist Checklist = nil
+	for _, item := range items {
+		if item.RunbookStep == "" {
+			item.RunbookStep = step
+		}
+		checklist = append(checklist, item)
+	}
+
+	return checklist, nil
+}
+
+/**
+ * Return the canned checklist items for the given step, since the fixture
+ * defines no items without scripts
+ */
+func (f *RunbookFixture) AllItemsFromRunbook(step string, params url.Values) (Checklist, error) {
+	return f.ChecklistFromRunbook(step, params)
+}
+
+/**
+ * @brief      Return the canned metadata of the given step, or nil if the
+ *             fixture does not define any
+ *
+ * @param      step  The step
+ */
+func (f *RunbookFixture) StepInfo(step string) (*RunbookStepInfo, error) {
+	return f.StepInfos[step], nil
+}
+
+/**
+ * @brief      Return the status of the last update of the checklist item, or
+ *             its initial status in the fixture
+ */
+func (f *RunbookFixture) ChecklistItemStatus(stepId string, itemId string) (int, error) {
+	for i := len(f.Updates) - 1; i >= 0; i-- {
+		if f.Updates[i].StepID == stepId && f.Updates[i].ItemID == itemId {
+			return f.Updates[i].Status, nil
+		}
+	}
+	return f.Statuses[stepId][itemId], nil
+}
+
+/**
+ * @brief      Record the checklist item update in memory
+ */
+func (f *RunbookFixture) ChecklistItemUpdate(stepId string, itemId string, status int, reason string) error {
+	f.Updates = append(f.Updates, RunbookFixtureUpdate{
+		StepID: stepId,
+		ItemID: itemId,
+		Status: status,
+		Reason: reason,
+	})
+	return nil
+}
+
+/**
+ * Returns the codes of the statuses of the checklist items
+ */
+func (f *RunbookFixture) StatusCodes() RunbookStatusCodes {
+	return f.Codes
+}
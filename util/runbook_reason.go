@@ -0,0 +1,93 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+)
+
+/**
+ * The values that the runbook failure templates can refer to
+ */
+type runbookFailureData struct {
+	Title       string
+	Category    string
+	DocURL      string
+	Remediation string
+	Output      string
+	Stderr      string
+	RunID       string
+	Meta        string
+}
+
+func parseRunbookFailureTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	return template.New("runbook_failure_template").Option("missingkey=error").Parse(text)
+}
+
+/**
+ * Checks that the template parses, and only refers to the known values
+ */
+func validateRunbookFailureTemplate(text string) error {
+	tmpl, err := parseRunbookFailureTemplate(text)
+	if err != nil || tmpl == nil {
+		return err
+	}
+	return tmpl.Execute(ioutil.Discard, &runbookFailureData{})
+}
+
+/**
+ * Returns the reason of the failure pushed to the runbook in the default
+ * format, with the output of the script
+ */
+func defaultRunbookFailureReason(data *runbookFailureData) string {
+	reason := ""
+	if data.Category != "" {
+		reason = "Category: " + data.Category + "\n"
+	}
+	if data.DocURL != "" {
+		reason += "Documentation: <" + data.DocURL + ">\n"
+	}
+	return reason + "Script failed with:\n```\n" + data.Output + "\n---\n" + data.Stderr + "\n```\n" + data.Meta
+}
+
+/**
+ * @brief      Renders the reason of the failure of the item to push to the
+ *             runbook, with the runbook_failure_template of the item, or in
+ *             the default format if it has none
+ *
+ * @param      item     The failed item
+ * @param      stdout   The output of the script of the item
+ * @param      stderr   The error output of the script of the item
+ * @param      summary  The summary of the run, with its metadata
+ *
+ * @return     The reason, and the error of the template if it could not be
+ *             rendered, in which case the reason is in the default format
+ */
+func RunbookFailureReason(item *ChecklistItem, stdout string, stderr string, summary *RunSummary) (string, error) {
+	data := &runbookFailureData{
+		Title:       item.Title,
+		Category:    item.Category,
+		DocURL:      item.DocURL,
+		Remediation: item.Remediation,
+		Output:      stdout,
+		Stderr:      stderr,
+		RunID:       summary.Meta["run_id"],
+		Meta:        summary.MetaText(),
+	}
+
+	tmpl, err := parseRunbookFailureTemplate(item.RunbookFailureTemplate)
+	if err == nil && tmpl != nil {
+		var b strings.Builder
+		if err = tmpl.Execute(&b, data); err == nil {
+			return b.String(), nil
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("Could not render the runbook failure template of %s: %s", item.Title, err.Error())
+	}
+	return defaultRunbookFailureReason(data), err
+}
@@ -0,0 +1,154 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+/**
+ * The statuses of the runbook items at the end of a run, by step and item ID
+ */
+type RunbookState struct {
+	RunID    string                    `yaml:"run_id"`
+	Recorded time.Time                 `yaml:"recorded"`
+	Statuses map[string]map[string]int `yaml:"statuses"`
+}
+
+/**
+ * Returns the default directory of the runbook states, in the cache directory
+ * of the user, so that the states of the users are kept apart
+ */
+func DefaultRunbookStateDir() string {
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "preflighter", "runbook-state")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("preflighter-runbook-state-%d", os.Getuid()))
+}
+
+func NewRunbookState(runID string) *RunbookState {
+	return &RunbookState{
+		RunID:    runID,
+		Statuses: make(map[string]map[string]int),
+	}
+}
+
+/**
+ * Records the status of the runbook item
+ */
+func (s *RunbookState) Set(step string, itemID string, status int) {
+	if s.Statuses[step] == nil {
+		s.Statuses[step] = make(map[string]int)
+	}
+	s.Statuses[step][itemID] = status
+}
+
+/**
+ * Returns whether the runbook item is new, or its status is different from
+ * the recorded one
+ */
+func (s *RunbookState) Changed(step string, itemID string, status int) bool {
+	recorded, ok := s.Statuses[step][itemID]
+	return !ok || recorded != status
+}
+
+/**
+ * Saves the state to the directory, as the state of its run
+ */
+func (s *RunbookState) Save(dir string) error {
+	s.Recorded = time.Now()
+	content, err := yaml.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("Could not marshal runbook state: %s", err.Error())
+	}
+
+	err = os.MkdirAll(dir, 0700)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, s.RunID+".yaml"), content, 0600)
+	}
+	if err != nil {
+		return fmt.Errorf("Could not write runbook state to %s: %s", dir, err.Error())
+	}
+	return nil
+}
+
+/**
+ * @brief      Loads the most recently recorded state of the directory, other
+ *             than the one of the current run
+ *
+ * @param      dir    The directory of the states, one file per run ID
+ * @param      runID  The ID of the current run
+ *
+ * @return     The last state, nil if none was recorded, or the error occurred
+ */
+func LoadLastRunbookState(dir string, runID string) (*RunbookState, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Could not read runbook states from %s: %s", dir, err.Error())
+	}
+
+	var last *RunbookState
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".yaml") || entry.Name() == runID+".yaml" {
+			continue
+		}
+		filename := filepath.Join(dir, entry.Name())
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read runbook state %s: %s", filename, err.Error())
+		}
+		state := &RunbookState{}
+		err = yaml.Unmarshal(content, state)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse runbook state %s: %s", filename, err.Error())
+		}
+		if last == nil || state.Recorded.After(last.Recorded) {
+			last = state
+		}
+	}
+	return last, nil
+}
+
+/**
+ * @brief      Removes the states of the directory but the given number of the
+ *             most recently written ones
+ *
+ * @param      dir   The directory of the states, one file per run ID
+ * @param      keep  The number of states to keep, or 0 to keep them all
+ *
+ * @return     The error occurred, if any
+ */
+func PruneRunbookStates(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Could not read runbook states from %s: %s", dir, err.Error())
+	}
+
+	var states []os.FileInfo
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".yaml") {
+			states = append(states, entry)
+		}
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].ModTime().After(states[j].ModTime()) })
+	for n := keep; n < len(states); n++ {
+		filename := filepath.Join(dir, states[n].Name())
+		if err := os.Remove(filename); err != nil {
+			return fmt.Errorf("Could not remove runbook state %s: %s", filename, err.Error())
+		}
+	}
+	return nil
+}
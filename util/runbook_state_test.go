@@ -0,0 +1,57 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPruneRunbookStates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "preflighter-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The states of the runs, from the oldest to the newest
+	for i := 1; i <= 5; i++ {
+		state := NewRunbookState(fmt.Sprintf("run%d", i))
+		state.Set("step", "item", i)
+		if err := state.Save(dir); err != nil {
+			t.Fatal(err)
+		}
+		written := time.Now().Add(time.Duration(i-5) * time.Hour)
+		if err := os.Chtimes(filepath.Join(dir, state.RunID+".yaml"), written, written); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("kept"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PruneRunbookStates(dir, 2); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if fmt.Sprint(names) != "[notes.txt run4.yaml run5.yaml]" {
+		t.Errorf("got the files %v, expecting the 2 most recent states to be kept", names)
+	}
+
+	// Keeping 0 states keeps them all
+	if err := PruneRunbookStates(dir, 0); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 3 {
+		t.Errorf("got %d files, expecting all of them to be kept", len(entries))
+	}
+}
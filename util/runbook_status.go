@@ -0,0 +1,121 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// The status code of the statuses that are not reported to the runbook
+const RUNBOOK_STATUS_UNREPORTED = -1
+
+/**
+ * The numeric codes of the statuses of the checklist items in the runbook,
+ * since the deployments of the runbook don't all use the same ones
+ */
+type RunbookStatusCodes struct {
+	Completed int
+	Failed    int
+
+	// The items skipped by the operator are reported as completed, unless
+	// this is given
+	Skipped int
+
+	// The status of the items while they run, before their final status
+	InProgress int `yaml:"in_progress"`
+
+	// The items whose check could not determine the outcome are reported
+	// with the status they are treated as, unless this is given
+	Unknown int
+}
+
+/**
+ * The codes of the runbook the integration was written for
+ */
+var DefaultRunbookStatusCodes = RunbookStatusCodes{
+	Completed:  1,
+	Failed:     2,
+	Skipped:    RUNBOOK_STATUS_UNREPORTED,
+	InProgress: 0,
+	Unknown:    RUNBOOK_STATUS_UNREPORTED,
+}
+
+/**
+ * Returns the code to report the skipped items with
+ */
+func (c *RunbookStatusCodes) SkippedCode() int {
+	if c.Skipped == RUNBOOK_STATUS_UNREPORTED {
+		return c.Completed
+	}
+	return c.Skipped
+}
+
+/**
+ * Returns the code to report the items with an unknown outcome with, given
+ * the code of the status they are treated as
+ */
+func (c *RunbookStatusCodes) UnknownCode(treatedAs int) int {
+	if c.Unknown == RUNBOOK_STATUS_UNREPORTED {
+		return treatedAs
+	}
+	return c.Unknown
+}
+
+/**
+ * Checks that the codes of the reported statuses are all different
+ */
+func (c *RunbookStatusCodes) Validate() error {
+	seen := make(map[int]string)
+	for _, status := range []struct {
+		name string
+		code int
+	}{{"completed", c.Completed}, {"failed", c.Failed}, {"skipped", c.Skipped}, {"in_progress", c.InProgress}, {"unknown", c.Unknown}} {
+		if status.code == RUNBOOK_STATUS_UNREPORTED {
+			continue
+		}
+		if status.code < 0 {
+			return fmt.Errorf("Invalid runbook status code %d for %s", status.code, status.name)
+		}
+		if other, ok := seen[status.code]; ok {
+			return fmt.Errorf("The runbook statuses %s and %s have the same code %d", other, status.name, status.code)
+		}
+		seen[status.code] = status.name
+	}
+	return nil
+}
+
+/**
+ * @brief      Returns the status codes of the runbook, with the defaults
+ *             overridden by the RUNBOOK_STATUS_COMPLETED,
+ *             RUNBOOK_STATUS_FAILED, RUNBOOK_STATUS_SKIPPED,
+ *             RUNBOOK_STATUS_IN_PROGRESS and RUNBOOK_STATUS_UNKNOWN
+ *             environment variables, where `none` leaves the optional
+ *             statuses unreported
+ *
+ * @return     The status codes, or the error of an invalid variable
+ */
+func RunbookStatusCodesFromEnv() (RunbookStatusCodes, error) {
+	codes := DefaultRunbookStatusCodes
+	for name, code := range map[string]*int{
+		"RUNBOOK_STATUS_COMPLETED":   &codes.Completed,
+		"RUNBOOK_STATUS_FAILED":      &codes.Failed,
+		"RUNBOOK_STATUS_SKIPPED":     &codes.Skipped,
+		"RUNBOOK_STATUS_IN_PROGRESS": &codes.InProgress,
+		"RUNBOOK_STATUS_UNKNOWN":     &codes.Unknown,
+	} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		if value == "none" && code != &codes.Completed && code != &codes.Failed {
+			*code = RUNBOOK_STATUS_UNREPORTED
+			continue
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 0 {
+			return codes, fmt.Errorf("Invalid %s '%s', expecting a status code", name, value)
+		}
+		*code = number
+	}
+	return codes, codes.Validate()
+}
@@ -0,0 +1,33 @@
+package util
+
+import (
+	"os"
+	"testing"
+)
+
+func TestRunbookStatusCodesUnknownCode(t *testing.T) {
+	codes := DefaultRunbookStatusCodes
+	for _, treatedAs := range []int{codes.Completed, codes.Failed, codes.SkippedCode()} {
+		if got := codes.UnknownCode(treatedAs); got != treatedAs {
+			t.Errorf("got %d, want the code %d of the status the item is treated as", got, treatedAs)
+		}
+	}
+
+	os.Setenv("RUNBOOK_STATUS_UNKNOWN", "7")
+	defer os.Unsetenv("RUNBOOK_STATUS_UNKNOWN")
+	codes, err := RunbookStatusCodesFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := codes.UnknownCode(codes.Failed); got != 7 {
+		t.Errorf("got %d, want the configured code 7", got)
+	}
+	if err := codes.Validate(); err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+	}
+
+	codes.Unknown = codes.Failed
+	if err := codes.Validate(); err == nil {
+		t.Errorf("expecting an error for the same code as the failed status")
+	}
+}
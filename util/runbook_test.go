@@ -0,0 +1,114 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+/**
+ * Serves a runbook step with the given checklist items, by pages when
+ * paginate is set, or all of them on every request otherwise
+ */
+func createTestRunbookServer(t *testing.T, items []map[string]interface{}, paginate bool, pages *[]int) *httptest.Server {
+	var instructions strings.Builder
+	for _, item := range items {
+		fmt.Fprintf(&instructions, "* {!%s} Check\n  ```sh\n  echo %s\n  ```\n", item["id"], item["id"])
+	}
+
+	reply := func(w http.ResponseWriter, data interface{}) {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "data": json.RawMessage(raw)})
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/op/vars/global":
+			reply(w, map[string]interface{}{"value": map[string]interface{}{}})
+		case "/step/deploy":
+			reply(w, map[string]interface{}{"component": "app", "instructions": instructions.String()})
+		case "/step/deploy/checklist":
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+			*pages = append(*pages, page)
+			if !paginate {
+				reply(w, items)
+				return
+			}
+			start := (page - 1) * perPage
+			if start > len(items) {
+				start = len(items)
+			}
+			end := start + perPage
+			if end > len(items) {
+				end = len(items)
+			}
+			reply(w, items[start:end])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func createTestRunbookItems(count int) []map[string]interface{} {
+	var items []map[string]interface{}
+	for i := 1; i <= count; i++ {
+		items = append(items, map[string]interface{}{"id": fmt.Sprintf("i%d", i), "title": fmt.Sprintf("Item %d", i), "status": 0})
+	}
+	return items
+}
+
+func TestChecklistFromRunbookPaginated(t *testing.T) {
+	var pages []int
+	server := createTestRunbookServer(t, createTestRunbookItems(2*checklistPageSize+50), true, &pages)
+	defer server.Close()
+	client, err := CreateRunbookClient(server.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checklist, err := client.ChecklistFromRunbook("deploy", url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checklist) != 2*checklistPageSize+50 {
+		t.Fatalf("got %d items, want %d", len(checklist), 2*checklistPageSize+50)
+	}
+	for i, item := range checklist {
+		if want := fmt.Sprintf("i%d", i+1); item.RunbookID != want || strings.TrimSpace(item.Script) != "echo "+want {
+			t.Errorf("item %d: got %s (%q), want %s", i+1, item.RunbookID, item.Script, want)
+		}
+	}
+	if fmt.Sprint(pages) != "[1 2 3]" {
+		t.Errorf("requested the pages %v, want [1 2 3]", pages)
+	}
+}
+
+func TestChecklistFromRunbookNotPaginated(t *testing.T) {
+	var pages []int
+	server := createTestRunbookServer(t, createTestRunbookItems(checklistPageSize), false, &pages)
+	defer server.Close()
+	client, err := CreateRunbookClient(server.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A server that ignores the pages returns the same items again
+	checklist, err := client.ChecklistFromRunbook("deploy", url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checklist) != checklistPageSize {
+		t.Errorf("got %d items, want %d", len(checklist), checklistPageSize)
+	}
+	if len(pages) != 2 {
+		t.Errorf("requested the pages %v, want [1 2]", pages)
+	}
+}
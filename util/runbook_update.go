@@ -0,0 +1,30 @@
+package util
+
+import (
+	"fmt"
+)
+
+/**
+ * @brief      Updates the runbook item linked to the checklist item, if any.
+ *             The runbook is nil when the item was not expected to be linked
+ *             to it, in which case the update is skipped with an error.
+ *
+ * @param      runbook  The runbook, or nil when it is not available
+ * @param      item     The checklist item
+ * @param      status   The status code of the runbook item
+ * @param      reason   The reason of the update
+ *
+ * @return     An error when the item could not be updated
+ */
+func UpdateRunbookItem(runbook Runbook, item *ChecklistItem, status int, reason string) error {
+	if item.RunbookID == "" {
+		return nil
+	}
+	if runbook == nil {
+		return fmt.Errorf("Could not update runbook item %s of %s: no runbook is available", item.RunbookID, item.Title)
+	}
+	if err := runbook.ChecklistItemUpdate(item.RunbookStep, item.RunbookID, status, reason); err != nil {
+		return fmt.Errorf("Could not update runbook item %s of %s: %s", item.RunbookID, item.Title, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package util
+
+import (
+	"errors"
+	"testing"
+)
+
+// A runbook whose updates fail
+type failingRunbook struct {
+	RunbookFixture
+}
+
+func (f *failingRunbook) ChecklistItemUpdate(stepId string, itemId string, status int, reason string) error {
+	return errors.New("unavailable")
+}
+
+func TestUpdateRunbookItemWithoutRunbook(t *testing.T) {
+	var runbook Runbook
+	if err := UpdateRunbookItem(runbook, &ChecklistItem{Title: "Local"}, 2, ""); err != nil {
+		t.Errorf("an item not linked to the runbook got an error: %s", err.Error())
+	}
+	if err := UpdateRunbookItem(runbook, &ChecklistItem{Title: "Linked", RunbookID: "a"}, 2, ""); err == nil {
+		t.Errorf("expecting an error for a linked item without a runbook")
+	}
+}
+
+func TestUpdateRunbookItemWithFixture(t *testing.T) {
+	fixture := &RunbookFixture{Codes: DefaultRunbookStatusCodes}
+	items := []ChecklistItem{
+		{Title: "Local"},
+		{Title: "Linked", RunbookStep: "deploy", RunbookID: "a"},
+	}
+	for i := range items {
+		if err := UpdateRunbookItem(fixture, &items[i], fixture.Codes.Completed, "ok"); err != nil {
+			t.Errorf("%s: unexpected error: %s", items[i].Title, err.Error())
+		}
+	}
+
+	want := RunbookFixtureUpdate{StepID: "deploy", ItemID: "a", Status: fixture.Codes.Completed, Reason: "ok"}
+	if len(fixture.Updates) != 1 || fixture.Updates[0] != want {
+		t.Errorf("got the updates %+v, want only %+v", fixture.Updates, want)
+	}
+}
+
+func TestUpdateRunbookItemError(t *testing.T) {
+	runbook := &failingRunbook{}
+	if err := UpdateRunbookItem(runbook, &ChecklistItem{Title: "Linked", RunbookID: "a"}, 2, ""); err == nil {
+		t.Errorf("expecting the error of the runbook")
+	}
+}
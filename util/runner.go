@@ -2,17 +2,87 @@ package util
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
+// The variables retained from the process environment for clean env items
+var cleanEnvKeep = []string{"PATH", "HOME"}
+
+type RunOptions struct {
+	// Additional environment variables
+	Env map[string]string
+
+	// Don't inherit the process environment
+	CleanEnv bool
+
+	// The locale of the script, instead of the default C locale
+	Locale string
+
+	// Run the script through the sudo command of the configuration
+	Privileged bool
+
+	// The number of bytes of every output to capture, overriding the one of
+	// the configuration
+	MaxOutput int64
+
+	// Kill the script and all of its processes after this long, if not zero
+	Timeout time.Duration
+
+	// Warn that the script is still running after this long, if not zero
+	SoftTimeout time.Duration
+
+	// The command that runs the script from its standard input, instead of
+	// bash with the library functions
+	Interpreter []string
+
+	// The umask and the resource limits applied before running the script
+	Umask  string
+	Limits *ResourceLimits
+}
+
+/**
+ * The error of a script that was killed because it exceeded its timeout
+ */
+type ScriptTimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *ScriptTimeoutError) Error() string {
+	return fmt.Sprintf("Timed out after %s", e.Timeout)
+}
+
 type Runner struct {
 	CacheDir       string
+	SharedDir      string
 	Config         *Config
 	StderrCallback func(string)
+
+	// Guards the outcomes of the checks and the statuses of the items, for
+	// the checks that run in the background
+	lock   sync.Mutex
+	checks map[string]*checkOutcome
+
+	// The test cases imported from the JUnit output of the item checks
+	subResults map[string][]SubResult
+
+	// The statuses of the completed items, by the variable that gives them
+	// to the scripts of the later items
+	itemStatuses map[string]string
+
+	// The semaphores that limit the checks running at once, by the checklist
+	// file or the mutex they are limited for
+	slots map[string]chan struct{}
 }
 
 func CreateRunner(c *Config) (*Runner, error) {
@@ -29,10 +99,23 @@ func CreateRunner(c *Config) (*Runner, error) {
 		os.MkdirAll(dir, os.ModePerm)
 	}
 
+	// A fresh directory for the scripts to exchange data in this run
+	shared := filepath.Join(dir, "shared")
+	os.RemoveAll(shared)
+	err = os.MkdirAll(shared, os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create shared dir: %s", err.Error())
+	}
+
 	return &Runner{
 		CacheDir:       dir,
+		SharedDir:      shared,
 		Config:         c,
 		StderrCallback: nil,
+		checks:         make(map[string]*checkOutcome),
+		subResults:     make(map[string][]SubResult),
+		itemStatuses:   make(map[string]string),
+		slots:          make(map[string]chan struct{}),
 	}, nil
 }
 
@@ -46,6 +129,13 @@ func (r *Runner) Cleanup() {
  * Return a list of tools that are required, yet not found in path
  */
 func (r *Runner) GetMissingTools() []string {
+	return MissingTools(r.Config.UserTools)
+}
+
+/**
+ * Return a list of the built-in and the given tools that are not found in path
+ */
+func MissingTools(userTools []string) []string {
 	var missing []string
 	var tools []string = []string{
 		"awk",
@@ -58,7 +148,7 @@ func (r *Runner) GetMissingTools() []string {
 		"tr",
 	}
 
-	tools = append(tools, r.Config.UserTools...)
+	tools = append(tools, userTools...)
 
 	for _, tool := range tools {
 		_, err := exec.LookPath(tool)
@@ -70,6 +160,49 @@ func (r *Runner) GetMissingTools() []string {
 	return missing
 }
 
+/**
+ * Checks that the privileged items can be executed through the sudo command,
+ * prompting for the password if interactive
+ */
+func (r *Runner) CheckPrivileges(interactive bool) error {
+	if os.Geteuid() == 0 {
+		return nil
+	}
+
+	sudo := strings.Fields(r.Config.SudoCommand)
+	if len(sudo) == 0 {
+		return fmt.Errorf("There are privileged items, but no sudo command is configured")
+	}
+	if _, err := exec.LookPath(sudo[0]); err != nil {
+		return fmt.Errorf("There are privileged items, but '%s' was not found", sudo[0])
+	}
+
+	check := exec.Command(sudo[0], "-n", "true")
+	if interactive {
+		check = exec.Command(sudo[0], "-v")
+		check.Stdin = os.Stdin
+		check.Stdout = os.Stdout
+		check.Stderr = os.Stderr
+	}
+	if err := check.Run(); err != nil {
+		return fmt.Errorf("There are privileged items, but you can't run commands with %s: %s", sudo[0], err.Error())
+	}
+	return nil
+}
+
+/**
+ * Returns the minimal process environment
+ */
+func cleanEnvironment() []string {
+	var env []string
+	for _, key := range cleanEnvKeep {
+		if value, ok := os.LookupEnv(key); ok {
+			env = append(env, fmt.Sprintf("%s=%s", key, value))
+		}
+	}
+	return env
+}
+
 /**
  * Execute the given script and collect stdout/stderr
  */
@@ -81,7 +214,145 @@ func (r *Runner) Run(script string) (string, string, error) {
  * Execute the given script and collect stdout/stderr
  */
 func (r *Runner) RunWithValue(script string, value string) (string, string, error) {
-	cmd := exec.Command("bash")
+	return r.RunWithOptions(script, value, RunOptions{})
+}
+
+/**
+ * Returns the environment of the scripts with the given item-specific options
+ */
+func (r *Runner) environment(value string, opts RunOptions) []string {
+	// The variables of the checklists can still change the default locale
+	list := append([]string{"LC_ALL=" + defaultLocale}, r.Config.GetEnvList()...)
+	list = append(list, fmt.Sprintf("CACHE_DIR=%s", r.CacheDir))
+	list = append(list, fmt.Sprintf("PREFLIGHTER_SHARED_DIR=%s", r.SharedDir))
+	list = append(list, fmt.Sprintf("PREFLIGHTER_ARGS=%s", strings.Join(r.Config.ScriptArgs, " ")))
+	if r.Config.RunID != "" {
+		list = append(list, fmt.Sprintf("PREFLIGHTER_RUN_ID=%s", r.Config.RunID))
+	}
+	r.lock.Lock()
+	for _, k := range sortedKeys(r.itemStatuses) {
+		list = append(list, fmt.Sprintf("%s=%s", k, r.itemStatuses[k]))
+	}
+	r.lock.Unlock()
+	if value != "" {
+		list = append(list, fmt.Sprintf("VALUE=%s", value))
+	}
+	for k, v := range opts.Env {
+		list = append(list, fmt.Sprintf("%s=%s", k, v))
+	}
+	if opts.Locale != "" {
+		list = append(list, fmt.Sprintf("LC_ALL=%s", opts.Locale))
+	}
+	if opts.CleanEnv {
+		return append(cleanEnvironment(), list...)
+	}
+	return append(os.Environ(), list...)
+}
+
+var rxNotVarNameChars = regexp.MustCompile(`[^A-Z0-9]+`)
+
+/**
+ * Returns the variable that gives the status of the item to the later items:
+ * PREFLIGHTER_STATUS_ followed by the id of the item, or by its title, in
+ * upper case and with every run of other characters than letters and
+ * digits replaced by an underscore
+ */
+func ItemStatusVar(item *ChecklistItem) string {
+	name := firstNonEmpty(item.ID, item.Title)
+	name = rxNotVarNameChars.ReplaceAllString(strings.ToUpper(name), "_")
+	return "PREFLIGHTER_STATUS_" + strings.Trim(name, "_")
+}
+
+/**
+ * Gives the status of the completed item to the scripts of the later items
+ */
+func (r *Runner) SetItemStatus(item *ChecklistItem, status string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.itemStatuses[ItemStatusVar(item)] = status
+}
+
+// The variables whose values are masked in the reports, besides the ones
+// required from the environment
+var rxSecretVarName = regexp.MustCompile(`(?i)token|secret|passw(or)?d|credential|private_key|api_key`)
+
+/**
+ * Returns the variables of the checklists and of preflighter that the item
+ * scripts run with, for reproducing a failure, with the values of the given
+ * secrets and of the variables named like secrets masked
+ */
+func (r *Runner) ItemEnvironment(item *ChecklistItem, secrets map[string]bool) map[string]string {
+	env := map[string]string{
+		"LC_ALL":                 defaultLocale,
+		"PREFLIGHTER_SHARED_DIR": r.SharedDir,
+		"PREFLIGHTER_ARGS":       strings.Join(r.Config.ScriptArgs, " "),
+	}
+	if r.Config.RunID != "" {
+		env["PREFLIGHTER_RUN_ID"] = r.Config.RunID
+	}
+	r.lock.Lock()
+	for k, v := range r.itemStatuses {
+		env[k] = v
+	}
+	r.lock.Unlock()
+	for k, v := range r.Config.Env {
+		env[k] = v
+	}
+	for k, v := range item.Env {
+		env[k] = v
+	}
+	if item.Locale != "" {
+		env["LC_ALL"] = item.Locale
+	}
+	for k, v := range env {
+		if v != "" && (secrets[k] || rxSecretVarName.MatchString(k)) {
+			env[k] = "********"
+		}
+	}
+	return env
+}
+
+/**
+ * Starts an interactive shell in the environment of the scripts, with the
+ * library functions loaded, and waits until the operator exits it
+ */
+func (r *Runner) Shell(opts RunOptions) error {
+	rcfile := filepath.Join(r.CacheDir, "shellrc")
+	rc := fmt.Sprintf("%s\n%s\nPS1='(preflighter) \\w \\$ '\n", BashLibrary, r.Config.UserLib)
+	err := ioutil.WriteFile(rcfile, []byte(rc), 0600)
+	if err != nil {
+		return fmt.Errorf("Could not prepare shell: %s", err.Error())
+	}
+
+	cmd := exec.Command("bash", "--rcfile", rcfile, "-i")
+	cmd.Env = r.environment("", opts)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if _, ok := err.(*exec.ExitError); ok {
+		return nil
+	}
+	return err
+}
+
+/**
+ * Execute the given script with the given item-specific options
+ */
+func (r *Runner) RunWithOptions(script string, value string, opts RunOptions) (string, string, error) {
+	args := append([]string{"bash", "-s", "--"}, r.Config.ScriptArgs...)
+	input := fmt.Sprintf("%s\n%s\n%s", BashLibrary, r.Config.UserLib, script)
+	if len(opts.Interpreter) > 0 {
+		args = append(append([]string{}, opts.Interpreter...), r.Config.ScriptArgs...)
+		input = script
+	}
+	if prelude := limitsPrelude(opts.Umask, opts.Limits); prelude != "" {
+		args = append([]string{"bash", "-c", prelude, "preflighter"}, args...)
+	}
+	if opts.Privileged && os.Geteuid() != 0 {
+		args = append(strings.Fields(r.Config.SudoCommand), args...)
+	}
+	cmd := exec.Command(args[0], args[1:]...)
 
 	// Open I/O pipes
 	stdout, err := cmd.StdoutPipe()
@@ -97,46 +368,103 @@ func (r *Runner) RunWithValue(script string, value string) (string, string, erro
 		return "", "", fmt.Errorf("Unable to open stdin pipe: %s", err.Error())
 	}
 
-	// Prepare environment
-	list := r.Config.GetEnvList()
-	list = append(list, fmt.Sprintf("CACHE_DIR=%s", r.CacheDir))
-	if value != "" {
-		list = append(list, fmt.Sprintf("VALUE=%s", value))
+	cmd.Env = r.environment(value, opts)
+
+	// Run the script in its own process group, so that all of its processes
+	// can be killed when it times out
+	if opts.Timeout > 0 {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 	}
-	cmd.Env = append(os.Environ(), list...)
 
 	err = cmd.Start()
 	if err != nil {
 		return "", "", fmt.Errorf("Unable to start process: %s", err.Error())
 	}
 
-	io.WriteString(stdin, fmt.Sprintf("%s\n%s\n%s", BashLibrary, r.Config.UserLib, script))
+	timedOut := func() bool { return false }
+	if opts.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+		defer cancel()
+		go func() {
+			<-ctx.Done()
+			if ctx.Err() == context.DeadlineExceeded {
+				syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			}
+		}()
+		timedOut = func() bool { return ctx.Err() == context.DeadlineExceeded }
+	}
+
+	// The warning of a slow script is shown with the live output of the
+	// script when there is one, or printed to stderr otherwise
+	var callbackLock sync.Mutex
+	callback := func(line string) {
+		callbackLock.Lock()
+		defer callbackLock.Unlock()
+		r.StderrCallback(line)
+	}
+	if opts.SoftTimeout > 0 {
+		warning := fmt.Sprintf("WARNING: Still running after %s", opts.SoftTimeout)
+		if opts.Timeout > 0 {
+			warning += fmt.Sprintf(", will kill at %s", opts.Timeout)
+		}
+		soft := time.AfterFunc(opts.SoftTimeout, func() {
+			if r.StderrCallback != nil {
+				callback(warning)
+			} else {
+				fmt.Fprintln(os.Stderr, warning)
+			}
+		})
+		defer soft.Stop()
+	}
+
+	io.WriteString(stdin, input)
 	stdin.Close()
 
-	sserr := ""
-	scanner := bufio.NewScanner(stderr)
-	for scanner.Scan() {
-		line := scanner.Text()
-		sserr += line + "\n"
-		if r.StderrCallback != nil {
-			r.StderrCallback(line)
+	// Read stdout in the background, so that neither of the pipes blocks
+	maxOutput := r.Config.MaxOutput
+	if opts.MaxOutput > 0 {
+		maxOutput = opts.MaxOutput
+	}
+	ssout := &limitedBuffer{max: maxOutput}
+	sserr := &limitedBuffer{max: maxOutput}
+	stdoutDone := make(chan error)
+	go func() {
+		_, err := io.Copy(ssout, stdout)
+		stdoutDone <- err
+	}()
+
+	reader := bufio.NewReader(stderr)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			sserr.Write([]byte(line))
+			if r.StderrCallback != nil {
+				callback(strings.TrimRight(line, "\n"))
+			}
+		}
+		if err != nil {
+			break
 		}
 	}
-	stderr.Close()
+	if sserr.omitted == 0 && sserr.buf.Len() > 0 && !strings.HasSuffix(sserr.buf.String(), "\n") {
+		sserr.Write([]byte("\n"))
+	}
 
-	ssout, err := ioutil.ReadAll(stdout)
+	err = <-stdoutDone
 	if err != nil {
 		return "", "", fmt.Errorf("Unable to read stdout: %s", err.Error())
 	}
-	stdout.Close()
 
 	err = cmd.Wait()
 	if err != nil {
+		if timedOut() {
+			return ssout.String(), sserr.String(), &ScriptTimeoutError{opts.Timeout}
+		}
 		if xerr, ok := err.(*exec.ExitError); ok {
-			return string(ssout), string(sserr), xerr
+			return ssout.String(), sserr.String(), xerr
 		}
 		return "", "", fmt.Errorf("Execution error: %s", err.Error())
 	}
 
-	return string(ssout), sserr, nil
+	return ssout.String(), sserr.String(), nil
 }
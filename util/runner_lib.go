@@ -5,6 +5,37 @@ package util
 // always available to the probe scripts
 //
 var BashLibrary = `
+# Prints the output of the command, running it only the first time for the
+# given cache ID. The output is written to a temporary file and moved in place
+# under a lock, so that the checks running at the same time with -j wait for
+# the first one instead of reading a partial output. The lock of a script that
+# was killed is taken over.
+function cached_output() {
+  local CACHE_FILE="${CACHE_DIR}/$1"; shift
+  local LOCK="${CACHE_FILE}.lock"
+  until mkdir "${LOCK}" 2>/dev/null; do
+    local OWNER=$(cat "${LOCK}/pid" 2>/dev/null)
+    if [ -n "${OWNER}" ] && ! kill -0 "${OWNER}" 2>/dev/null; then
+      rm -rf "${LOCK}"
+    fi
+    sleep 0.1
+  done
+  echo "${BASHPID:-$$}" > "${LOCK}/pid"
+  if [ ! -f "${CACHE_FILE}" ]; then
+    local TEMP_FILE=$(mktemp "${CACHE_FILE}.XXXXXX")
+    "$@" > "${TEMP_FILE}"
+    local RET=$?
+    if [ $RET -ne 0 ]; then
+      rm -f "${TEMP_FILE}"
+      rm -rf "${LOCK}"
+      return $RET
+    fi
+    mv "${TEMP_FILE}" "${CACHE_FILE}"
+  fi
+  rm -rf "${LOCK}"
+  cat "${CACHE_FILE}"
+}
+
 # Shorthand to 'curl -H <Auth> <DCOS_URL>/'
 function cluster_curl() {
   local URL=$1; shift
@@ -14,16 +45,7 @@ function cached_cluster_curl() {
   local URL=$1; shift
   local CACHE_ID=$(echo "${DCOS_URL}|curl|${URL}" | shasum - | awk '{print $1}')
   echo "[curl] Using cache ID: $CACHE_ID" >&2
-  local CACHE_FILE="${CACHE_DIR}/${CACHE_ID}"
-  if [ ! -f "${CACHE_FILE}" ]; then
-    cluster_curl $URL $* > ${CACHE_FILE}
-    RET=$?
-    if [ $RET -ne 0 ]; then
-      rm ${CACHE_FILE}
-      return $RET
-    fi
-  fi
-  cat ${CACHE_FILE}
+  cached_output $CACHE_ID cluster_curl $URL $*
 }
 
 # Perform a bash command on the specified node, making sure only the
@@ -42,35 +64,16 @@ function node_ssh() {
 }
 function cached_node_ssh() {
   local CACHE_ID
-  local CACHE_FILE
   CACHE_ID=$(echo "${DCOS_URL}|ssh|$*" | shasum - | awk '{print $1}')
   echo "[ssh] Using cache ID: $CACHE_ID" >&2
-  CACHE_FILE="${CACHE_DIR}/${CACHE_ID}"
-  if [ ! -f "${CACHE_FILE}" ]; then
-    node_ssh $* > ${CACHE_FILE}
-    RET=$?
-    if [ $RET != 0 ]; then
-      rm ${CACHE_FILE}
-      return $RET
-    fi
-  fi
-  cat ${CACHE_FILE}
+  cached_output $CACHE_ID node_ssh $*
 }
 
 # Cached call to 'dcos ...'
 function cached_dcos() {
   local CACHE_ID=$(echo "${DCOS_URL}|dcos|$*" | shasum - | awk '{print $1}')
   echo "[dcos] Using cache ID: $CACHE_ID" >&2
-  local CACHE_FILE="${CACHE_DIR}/${CACHE_ID}"
-  if [ ! -f "${CACHE_FILE}" ]; then
-    dcos $* > ${CACHE_FILE}
-    RET=$?
-    if [ $RET != 0 ]; then
-      rm ${CACHE_FILE}
-      return $RET
-    fi
-  fi
-  cat ${CACHE_FILE}
+  cached_output $CACHE_ID dcos $*
 }
 
 `
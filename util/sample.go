@@ -0,0 +1,52 @@
+package util
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+/**
+ * @brief      Picks a random fraction of the items, determined by the seed.
+ *             The items marked as always_run are always picked, on top of
+ *             the fraction of the others.
+ *
+ * @param      items     The items to sample
+ * @param      fraction  The fraction of the items to pick, between 0 and 1
+ * @param      seed      The seed of the random choice
+ * @param      weighted  Favor the items with a higher weight
+ *
+ * @return     Whether every item was picked
+ */
+func SampleItems(items []ChecklistItem, fraction float64, seed int64, weighted bool) []bool {
+	rng := rand.New(rand.NewSource(seed))
+	picked := make([]bool, len(items))
+
+	// Weighted sampling without replacement, picking the items with the
+	// highest random keys of u^(1/weight)
+	type candidate struct {
+		index int
+		key   float64
+	}
+	var candidates []candidate
+	for i, item := range items {
+		if item.AlwaysRun {
+			picked[i] = true
+			continue
+		}
+		weight := 1.0
+		if weighted {
+			weight = float64(item.GetWeight())
+		}
+		candidates = append(candidates, candidate{i, math.Pow(rng.Float64(), 1/weight)})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].key > candidates[j].key
+	})
+
+	count := int(math.Ceil(fraction * float64(len(candidates))))
+	for _, c := range candidates[:count] {
+		picked[c.index] = true
+	}
+	return picked
+}
@@ -0,0 +1,72 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+/**
+ * Returns the value as a YAML scalar, quoted if needed
+ */
+func yamlScalar(value string) string {
+	out, err := yaml.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%q", value)
+	}
+	return strings.TrimRight(string(out), "\n")
+}
+
+/**
+ * @brief      Generates a local checklist from the items of a runbook step,
+ *             with their titles and runbook linkage, and an empty check for
+ *             every item to fill in. The commands of the runbook items are
+ *             kept as comments.
+ *
+ * @param      runbook  The runbook to fetch the step from
+ * @param      ref      The step, optionally with parameters (see
+ *                      ParseRunbookStepRef)
+ *
+ * @return     The YAML of the checklist and the number of items, or the error
+ *             occurred
+ */
+func ScaffoldChecklist(runbook Runbook, ref string) ([]byte, int, error) {
+	step, params, err := ParseRunbookStepRef(ref)
+	if err != nil {
+		return nil, 0, err
+	}
+	items, err := runbook.AllItemsFromRunbook(step, params)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Could not fetch checklist for step %s: %s", ref, err.Error())
+	}
+	title := step
+	if info, err := runbook.StepInfo(step); err == nil && info != nil && info.Name != "" {
+		title = info.Name
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Scaffolded from the runbook step %s on %s. Write the check\n", ref, time.Now().Format("2006-01-02"))
+	b.WriteString("# of every item: its outcome keeps updating the linked runbook item.\n")
+	fmt.Fprintf(&b, "title: %s\n", yamlScalar(title))
+	if len(items) == 0 {
+		b.WriteString("checklist: []\n")
+	} else {
+		b.WriteString("checklist:\n")
+	}
+	for _, item := range items {
+		fmt.Fprintf(&b, "  - title: %s\n", yamlScalar(item.Title))
+		fmt.Fprintf(&b, "    runbook_step: %s\n", yamlScalar(firstNonEmpty(item.RunbookStep, step)))
+		fmt.Fprintf(&b, "    runbook_id: %s\n", yamlScalar(item.RunbookID))
+		if script := strings.TrimSpace(item.Script); script != "" {
+			b.WriteString("    # The commands of the runbook item:\n")
+			for _, line := range strings.Split(script, "\n") {
+				fmt.Fprintf(&b, "    #   %s\n", strings.TrimRight(line, " \t\r"))
+			}
+		}
+		b.WriteString("    # TODO: a script that checks the item, and an expect for its output\n")
+		b.WriteString("    script: \"\"\n")
+	}
+	return []byte(b.String()), len(items), nil
+}
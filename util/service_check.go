@@ -0,0 +1,111 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+/**
+ * A built-in check that a systemd unit is active, or that a process with the
+ * given name is running
+ */
+type ServiceCheck struct {
+	// The systemd unit that must be active (e.g. docker.service), on Linux
+	Unit string
+
+	// The name of the executable of a process that must be running
+	Process string
+}
+
+/**
+ * Validates the definition of the check
+ */
+func (c *ServiceCheck) Validate() error {
+	if (c.Unit == "") == (c.Process == "") {
+		return fmt.Errorf("Expecting either a unit or a process to check")
+	}
+	return nil
+}
+
+/**
+ * Runs the check, returning the state of the unit or the processes found
+ */
+func (c *ServiceCheck) Run() (string, error) {
+	if c.Unit != "" {
+		return c.checkUnit()
+	}
+	return c.checkProcess()
+}
+
+func (c *ServiceCheck) checkUnit() (string, error) {
+	if runtime.GOOS != "linux" {
+		return "", fmt.Errorf("Cannot check unit %s: systemd units are only available on Linux, not on %s", c.Unit, runtime.GOOS)
+	}
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return "", fmt.Errorf("Cannot check unit %s: systemctl was not found, the host does not seem to use systemd", c.Unit)
+	}
+
+	out, err := exec.Command("systemctl", "is-active", c.Unit).Output()
+	state := strings.TrimSpace(string(out))
+	if err != nil {
+		if state == "" {
+			state = "unknown"
+		}
+		return "", fmt.Errorf("Unit %s is %s, not active", c.Unit, state)
+	}
+	return fmt.Sprintf("%s is %s", c.Unit, state), nil
+}
+
+func (c *ServiceCheck) checkProcess() (string, error) {
+	pids, err := findProcesses(c.Process)
+	if err != nil {
+		return "", fmt.Errorf("Cannot check process %s: %s", c.Process, err.Error())
+	}
+	if len(pids) == 0 {
+		return "", fmt.Errorf("No process named %s is running", c.Process)
+	}
+	return fmt.Sprintf("%s is running (PID %s)", c.Process, strings.Join(pids, ", ")), nil
+}
+
+/**
+ * Returns the IDs of the processes whose executable has the given name, from
+ * /proc if available, or from the output of ps otherwise
+ */
+func findProcesses(name string) ([]string, error) {
+	var pids []string
+	if entries, err := ioutil.ReadDir("/proc"); err == nil {
+		for _, entry := range entries {
+			if _, err := strconv.Atoi(entry.Name()); err != nil {
+				continue
+			}
+			dir := filepath.Join("/proc", entry.Name())
+			comm, _ := ioutil.ReadFile(filepath.Join(dir, "comm"))
+			cmdline, _ := ioutil.ReadFile(filepath.Join(dir, "cmdline"))
+			argv0 := strings.SplitN(string(cmdline), "\x00", 2)[0]
+			if strings.TrimSpace(string(comm)) == name || (argv0 != "" && filepath.Base(argv0) == name) {
+				pids = append(pids, entry.Name())
+			}
+		}
+		return pids, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	out, err := exec.Command("ps", "-A", "-o", "pid=", "-o", "comm=").Output()
+	if err != nil {
+		return nil, fmt.Errorf("Could not list the processes: %s", err.Error())
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+		if len(fields) == 2 && filepath.Base(strings.TrimSpace(fields[1])) == name {
+			pids = append(pids, fields[0])
+		}
+	}
+	return pids, nil
+}
@@ -0,0 +1,90 @@
+package util
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+/**
+ * One of the deterministic subsets of the items, to split a large run
+ * across several machines
+ */
+type Shard struct {
+	// The number of the shard, from 1 to Count
+	Index int
+	Count int
+}
+
+/**
+ * Parses a shard given as `i/n`
+ */
+func ParseShard(spec string) (*Shard, error) {
+	parts := strings.SplitN(spec, "/", 2)
+	if len(parts) == 2 {
+		index, err1 := strconv.Atoi(parts[0])
+		count, err2 := strconv.Atoi(parts[1])
+		if err1 == nil && err2 == nil && count > 0 && index >= 1 && index <= count {
+			return &Shard{Index: index, Count: count}, nil
+		}
+	}
+	return nil, fmt.Errorf("Invalid shard '%s', expecting i/n with i between 1 and n", spec)
+}
+
+func (s *Shard) String() string {
+	return fmt.Sprintf("%d/%d", s.Index, s.Count)
+}
+
+/**
+ * Returns the shard of the item at the given index, from 1 to the count
+ */
+func (s *Shard) of(index int, item *ChecklistItem, byTitle bool) int {
+	if !byTitle {
+		return index%s.Count + 1
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(item.Ref()))
+	return int(hash.Sum32()%uint32(s.Count)) + 1
+}
+
+/**
+ * @brief      Picks the items of the shard, partitioned by their index or by
+ *             a hash of their title. The items cannot depend on the items of
+ *             other shards, since these are not run by the same invocation.
+ *
+ * @param      items    All of the items of the run
+ * @param      byTitle  Partition by a hash of the titles, so that the shard of
+ *                      an item does not change when other items are added
+ *
+ * @return     Whether every item is in the shard, or the error of an item
+ *             that depends on an item of another shard
+ */
+func (s *Shard) Pick(items []ChecklistItem, byTitle bool) ([]bool, error) {
+	picked := make([]bool, len(items))
+	shards := make(map[string]int)
+	for i := range items {
+		shard := s.of(i, &items[i], byTitle)
+		picked[i] = shard == s.Index
+		for _, ref := range items[i].Refs() {
+			shards[ref] = shard
+		}
+	}
+
+	// Every shard reports the dependencies across any of the shards, so that
+	// none of them runs a partial checklist
+	for _, item := range items {
+		deps := append([]string{}, item.DependsOn...)
+		for _, cond := range []*ItemCondition{item.SkipIf, item.RunIf} {
+			if cond != nil {
+				deps = append(deps, cond.Item)
+			}
+		}
+		for _, dep := range deps {
+			if shards[dep] != shards[item.Title] {
+				return nil, fmt.Errorf("Item '%s' of shard %d/%d depends on '%s', which is in shard %d/%d", item.Title, shards[item.Title], s.Count, dep, shards[dep], s.Count)
+			}
+		}
+	}
+	return picked, nil
+}
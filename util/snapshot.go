@@ -0,0 +1,79 @@
+package util
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+/**
+ * The state of the environment captured by the `snapshot` command of a
+ * checklist before the run, and its `verify` outcome after the run
+ */
+type EnvSnapshot struct {
+	Checklist string
+	Output    string
+
+	// The verify command of the checklist, its outcome and its output
+	VerifyCommand string
+	Verified      bool
+	VerifyOutput  string
+}
+
+/**
+ * Runs the `snapshot` command of the checklist, if any. Returns nil if the
+ * checklist has neither a snapshot nor a verify command.
+ */
+func TakeSnapshot(cf *ChecklistFile, runner *Runner) (*EnvSnapshot, error) {
+	if cf.Snapshot == "" && cf.Verify == "" {
+		return nil, nil
+	}
+
+	snapshot := &EnvSnapshot{Checklist: cf.Title, VerifyCommand: cf.Verify}
+	if cf.Snapshot != "" {
+		sout, serr, err := runner.Run(cf.Snapshot)
+		if err != nil {
+			if xerr, ok := err.(*exec.ExitError); ok {
+				err = fmt.Errorf("exited with %d", xerr.ExitCode())
+			}
+			return nil, fmt.Errorf("Could not take the snapshot of %s: %s\n%s", cf.Title, err.Error(), serr)
+		}
+		snapshot.Output = strings.TrimSpace(sout)
+	}
+	return snapshot, nil
+}
+
+/**
+ * Runs the `verify` command of the checklist, with the snapshot taken before
+ * the run in `PREFLIGHTER_SNAPSHOT`. Returns an error if it failed.
+ */
+func (s *EnvSnapshot) Verify(runner *Runner) error {
+	if s.VerifyCommand == "" {
+		s.Verified = true
+		return nil
+	}
+
+	opts := RunOptions{Env: map[string]string{"PREFLIGHTER_SNAPSHOT": s.Output}}
+	sout, serr, err := runner.RunWithOptions(s.VerifyCommand, "", opts)
+	s.VerifyOutput = strings.TrimSpace(sout + "\n" + serr)
+	if err != nil {
+		if xerr, ok := err.(*exec.ExitError); ok {
+			err = fmt.Errorf("exited with %d", xerr.ExitCode())
+		}
+		return fmt.Errorf("The verification of %s failed: %s", s.Checklist, err.Error())
+	}
+	s.Verified = true
+	return nil
+}
+
+/**
+ * Checks if any of the verifications after the run failed
+ */
+func (s *RunSummary) VerifyFailed() bool {
+	for _, snapshot := range s.Snapshots {
+		if !snapshot.Verified {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+/**
+ * The per-item outcomes accumulated over repeated runs
+ */
+type SoakStats struct {
+	Runs       int
+	FailedRuns int
+
+	titles []string
+	passed map[string]int
+	ran    map[string]int
+}
+
+func CreateSoakStats() *SoakStats {
+	return &SoakStats{
+		passed: make(map[string]int),
+		ran:    make(map[string]int),
+	}
+}
+
+/**
+ * Adds the outcome of a run, from the JSON report it wrote
+ */
+func (s *SoakStats) AddRun(reportFile string, failed bool) error {
+	s.Runs += 1
+	if failed {
+		s.FailedRuns += 1
+	}
+
+	content, err := ioutil.ReadFile(reportFile)
+	if err != nil {
+		return fmt.Errorf("Could not read the results of run %d: %s", s.Runs, err.Error())
+	}
+	var report jsonReport
+	err = json.Unmarshal(content, &report)
+	if err != nil {
+		return fmt.Errorf("Could not parse the results of run %d: %s", s.Runs, err.Error())
+	}
+
+	for _, item := range report.Items {
+		if item.Status == STATUS_SKIP {
+			continue
+		}
+		if _, ok := s.ran[item.Title]; !ok {
+			s.titles = append(s.titles, item.Title)
+		}
+		s.ran[item.Title] += 1
+		if item.Status == STATUS_PASS {
+			s.passed[item.Title] += 1
+		}
+	}
+	return nil
+}
+
+func UxPrintSoakSummary(stats *SoakStats) {
+	fmt.Println(colors.Bold("     ╒ Stability"))
+	for i, title := range stats.titles {
+		passed, ran := stats.passed[title], stats.ran[title]
+		text := fmt.Sprintf("%3d. %-35s passed %d/%d runs", i+1, title, passed, ran)
+		if passed == ran {
+			fmt.Println(colors.Bold("     │ "), colors.Green(text))
+		} else {
+			fmt.Println(colors.Bold("     │ "), colors.Bold(colors.Red(text)))
+		}
+	}
+	fmt.Println(colors.Bold("     │ "), fmt.Sprintf("%d of %d runs failed", stats.FailedRuns, stats.Runs))
+	fmt.Println(colors.Bold("     ╘ ●"))
+}
@@ -0,0 +1,164 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+/**
+ * Streams the events of the run as NDJSON to an HTTP endpoint in the
+ * background, so that sending them never blocks the checks
+ */
+type EventStream struct {
+	url     string
+	client  *http.Client
+	events  chan map[string]interface{}
+	done    chan bool
+	dropped int
+	failed  error
+}
+
+const streamBufferSize = 1000
+const streamMaxBatch = 100
+const streamRetries = 5
+
+func CreateEventStream(url string) *EventStream {
+	s := &EventStream{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+		events: make(chan map[string]interface{}, streamBufferSize),
+		done:   make(chan bool),
+	}
+	go s.run()
+	return s
+}
+
+/**
+ * Queues an event with the given type and fields. The event is dropped if
+ * the buffer is full because the endpoint is unavailable.
+ */
+func (s *EventStream) Send(event string, fields map[string]interface{}) {
+	if fields == nil {
+		fields = make(map[string]interface{})
+	}
+	fields["event"] = event
+	fields["time"] = time.Now().Format(time.RFC3339Nano)
+
+	select {
+	case s.events <- fields:
+	default:
+		s.dropped += 1
+	}
+}
+
+func (s *EventStream) SendItemStart(index int, item *ChecklistItem) {
+	s.Send("item_start", map[string]interface{}{"index": index, "title": item.Title})
+}
+
+func (s *EventStream) SendItemResult(index int, result *ItemResult) {
+	s.Send("item_result", map[string]interface{}{
+		"index":         index,
+		"title":         result.Item.Title,
+		"category":      result.Item.Category,
+		"status":        result.Status,
+		"allow_failure": result.Item.AllowFailure,
+		"expect_fail":   result.Item.ExpectFail,
+		"unknown":       result.Unknown,
+		"value":         result.Value,
+		"duration_ms":   int64(result.Duration / time.Millisecond),
+	})
+}
+
+func (s *EventStream) SendRunComplete(title string, summary *RunSummary, failure bool) {
+	report := createJSONReport(title, summary, failure)
+	s.Send("run_complete", map[string]interface{}{
+		"title":   report.Title,
+		"meta":    report.Meta,
+		"success": report.Success,
+		"summary": report.Summary,
+	})
+}
+
+/**
+ * Posts the queued events in batches, retrying with a backoff on failures
+ */
+func (s *EventStream) run() {
+	defer close(s.done)
+	for event := range s.events {
+		batch := []map[string]interface{}{event}
+	collect:
+		for len(batch) < streamMaxBatch {
+			select {
+			case next, ok := <-s.events:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, next)
+			default:
+				break collect
+			}
+		}
+
+		var body bytes.Buffer
+		encoder := json.NewEncoder(&body)
+		for _, e := range batch {
+			encoder.Encode(e)
+		}
+
+		// Don't insist once the endpoint was found to be unavailable
+		retries := streamRetries
+		if s.failed != nil {
+			retries = 1
+		}
+
+		delay := 500 * time.Millisecond
+		for attempt := 1; ; attempt++ {
+			err := s.post(body.Bytes())
+			if err == nil {
+				break
+			}
+			if attempt >= retries {
+				s.failed = err
+				break
+			}
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+}
+
+func (s *EventStream) post(body []byte) error {
+	resp, err := s.client.Post(s.url, "application/x-ndjson", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Unexpected HTTP status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+/**
+ * Waits up to the given time for the queued events to be sent. Returns an
+ * error if some events could not be delivered.
+ */
+func (s *EventStream) Close(timeout time.Duration) error {
+	close(s.events)
+	select {
+	case <-s.done:
+	case <-time.After(timeout):
+		return fmt.Errorf("Timed out sending the events to %s", s.url)
+	}
+
+	if s.failed != nil {
+		return fmt.Errorf("Could not send some events to %s: %s", s.url, s.failed.Error())
+	}
+	if s.dropped > 0 {
+		return fmt.Errorf("Dropped %d events for %s", s.dropped, s.url)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// The references to variables, with the expansion modifier if braced
+var rxVarRef = regexp.MustCompile(`\$\{([A-Za-z_]\w*)([^}]*)\}|\$([A-Za-z_]\w*)`)
+
+// The ways a script can define its own variables
+var rxVarAssign = regexp.MustCompile(`(?:^|[\s;&|(])([A-Za-z_]\w*)(?:\[[^\]]*\])?\+?=`)
+var rxVarDeclare = regexp.MustCompile(`\b(?:local|declare|typeset|readonly|export|read|mapfile|readarray|unset)\b([^;&|<>\n]*)`)
+var rxVarLoop = regexp.MustCompile(`\b(?:for|select)\s+([A-Za-z_]\w*)|\bgetopts\s+\S+\s+([A-Za-z_]\w*)`)
+var rxVarName = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+
+// The parts of a script that are not expanded: single-quoted strings,
+// escaped dollars and comments
+var rxUnexpanded = regexp.MustCompile(`(?m)'[^']*'|\\\$|(?:^|\s)#.*$`)
+
+// The variables that bash defines by itself
+var shellVars = []string{
+	"BASH", "BASHOPTS", "BASHPID", "BASH_ARGC", "BASH_ARGV", "BASH_COMMAND",
+	"BASH_LINENO", "BASH_REMATCH", "BASH_SOURCE", "BASH_SUBSHELL",
+	"BASH_VERSINFO", "BASH_VERSION", "COLUMNS", "DIRSTACK", "EPOCHREALTIME",
+	"EPOCHSECONDS", "EUID", "FUNCNAME", "GROUPS", "HISTCMD", "HOSTNAME",
+	"HOSTTYPE", "IFS", "LINENO", "LINES", "MACHTYPE", "OLDPWD", "OPTARG",
+	"OPTERR", "OPTIND", "OSTYPE", "PIPESTATUS", "PPID", "PS1", "PS2", "PS4",
+	"PWD", "RANDOM", "REPLY", "SECONDS", "SHELLOPTS", "SHLVL", "UID",
+}
+
+/**
+ * Returns the names of the variables that the script defines itself
+ */
+func scriptDefinedVars(script string) []string {
+	var names []string
+	for _, m := range rxVarAssign.FindAllStringSubmatch(script, -1) {
+		names = append(names, m[1])
+	}
+	for _, m := range rxVarDeclare.FindAllStringSubmatch(script, -1) {
+		for _, word := range strings.Fields(m[1]) {
+			word = strings.SplitN(word, "=", 2)[0]
+			if rxVarName.MatchString(word) {
+				names = append(names, word)
+			}
+		}
+	}
+	for _, m := range rxVarLoop.FindAllStringSubmatch(script, -1) {
+		names = append(names, m[1]+m[2])
+	}
+	return names
+}
+
+/**
+ * Returns the names of the variables that the script expands without a
+ * default value, in order of appearance
+ */
+func scriptReferencedVars(script string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, m := range rxVarRef.FindAllStringSubmatch(rxUnexpanded.ReplaceAllString(script, " "), -1) {
+		name := m[1] + m[3]
+		modifier := strings.TrimPrefix(m[2], ":")
+		if modifier != "" && strings.ContainsAny(modifier[:1], "-=+?") {
+			continue
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+/**
+ * A set of variable names
+ */
+type varSet map[string]bool
+
+func (s varSet) with(names ...string) varSet {
+	set := make(varSet)
+	for name := range s {
+		set[name] = true
+	}
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
+
+/**
+ * Returns the variables that are defined for all the scripts of the run,
+ * with the process environment unless the scripts run in a clean one
+ */
+func (r *Runner) definedVars(cleanEnv bool) varSet {
+	set := make(varSet).with(shellVars...)
+	set = set.with("LC_ALL", "CACHE_DIR", "PREFLIGHTER_SHARED_DIR", "PREFLIGHTER_ARGS")
+	if r.Config.RunID != "" {
+		set["PREFLIGHTER_RUN_ID"] = true
+	}
+	for name := range r.Config.Env {
+		set[name] = true
+	}
+	set = set.with(scriptDefinedVars(BashLibrary + "\n" + r.Config.UserLib)...)
+
+	if cleanEnv {
+		for _, name := range cleanEnvKeep {
+			if _, ok := os.LookupEnv(name); ok {
+				set[name] = true
+			}
+		}
+		return set
+	}
+	for _, pair := range os.Environ() {
+		set[strings.SplitN(pair, "=", 2)[0]] = true
+	}
+	return set
+}
+
+/**
+ * @brief      Scans the bash scripts of the checklist for references to
+ *             variables that are defined neither in the environment of the
+ *             scripts, nor by the scripts themselves. The ones listed in the
+ *             `optional_vars` of the checklist are not reported.
+ *
+ * @param      cf    The checklist file, with its variables resolved
+ *
+ * @return     An error for every undefined variable of every script
+ */
+func (r *Runner) CheckStrictEnv(cf *ChecklistFile) []error {
+	var errs []error
+	check := func(what string, script string, defined varSet) {
+		defined = defined.with(cf.OptionalVars...).with(scriptDefinedVars(script)...)
+		for _, name := range scriptReferencedVars(script) {
+			if !defined[name] {
+				errs = append(errs, fmt.Errorf("%s: %s references the undefined variable %s", cf.Filename, what, name))
+			}
+		}
+	}
+
+	// The statuses of the items may be defined by the time a script runs
+	var statusVars []string
+	for i := range cf.Checklist {
+		statusVars = append(statusVars, ItemStatusVar(&cf.Checklist[i]))
+	}
+	global := r.definedVars(false).with(statusVars...)
+	for _, cmd := range cf.HeaderCommands {
+		check("A header command", cmd, global)
+	}
+	check("The snapshot command", cf.Snapshot, global)
+	check("The verify command", cf.Verify, global.with("PREFLIGHTER_SNAPSHOT"))
+
+	hookVars := []string{"PREFLIGHTER_ITEM_TITLE", "PREFLIGHTER_ITEM_STATUS", "PREFLIGHTER_ITEM_OUTPUT"}
+	for _, item := range cf.Checklist {
+		defined := r.definedVars(item.CleanEnv).with(statusVars...)
+		for name := range item.Env {
+			defined[name] = true
+		}
+		what := fmt.Sprintf("Item '%s'", item.Title)
+		if item.Lang == "" {
+			check(what, item.Script, defined)
+		}
+		check(what, item.ExpectScript, defined.with("VALUE"))
+		check(what, item.AfterEach, defined)
+		check(what, item.Fix, defined)
+		check(what, item.OnPass, defined.with(hookVars...))
+		check(what, item.OnFail, defined.with(hookVars...))
+		if item.Wait != nil {
+			check(what, item.Wait.Until, defined)
+		}
+	}
+	return errs
+}
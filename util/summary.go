@@ -0,0 +1,338 @@
+package util
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const STATUS_PASS = "pass"
+const STATUS_FAIL = "fail"
+const STATUS_SKIP = "skip"
+
+// The status the machine-readable output gives to the skipped items that
+// were not shown, with -s
+const STATUS_BLANK = "blank"
+
+/**
+ * The outcome of a single checklist item
+ */
+type ItemResult struct {
+	Item     ChecklistItem
+	Status   string
+	Value    string
+	Stdout   string
+	Stderr   string
+	Duration time.Duration
+
+	// The fix of the item was applied after a failure, and whether the item
+	// passed after it
+	FixApplied  bool
+	FixResolved bool
+
+	// The check could not determine the outcome, and the status is the one it
+	// is treated as
+	Unknown bool
+
+	// The item was skipped without being shown, because it was before the
+	// first item to run
+	Blank bool
+
+	// The test cases imported from the JUnit output of the item
+	SubResults []SubResult
+
+	// The variables the item ran with, with the secrets masked, if the
+	// environment is reported with the failures
+	Env map[string]string
+}
+
+/**
+ * Returns the environment of the result as KEY=value lines
+ */
+func (r *ItemResult) EnvText() string {
+	var lines []string
+	for _, key := range sortedKeys(r.Env) {
+		lines = append(lines, fmt.Sprintf("%s=%s", key, r.Env[key]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+/**
+ * Counts the outcome of the checklist items in a run
+ */
+type RunSummary struct {
+	Passed   int
+	Failed   int
+	Warnings int
+	Skipped  int
+
+	// The expect_fail items that failed as expected, and the ones that
+	// unexpectedly passed
+	XFailed int
+	XPassed int
+
+	// The unexpected passes count as failures for the outcome of the run
+	XPassStrict bool
+
+	// The items that could not determine their outcome, and the status they
+	// are treated as
+	Unknown   int
+	UnknownAs string
+
+	// The hidden items are not counted with the others, only their failures
+	Hidden       int
+	HiddenFailed int
+
+	// The warnings count as failures for the outcome of the run
+	WarningsEscalated bool
+
+	// The cost of the items that were run, and the budget of the run if any
+	Cost   int
+	Budget int
+
+	// The number of failures that aborts the remaining items of a
+	// -keep-going run, and if it aborted some
+	MaxFailures  int
+	StoppedEarly bool
+
+	// The status of every item recorded so far, by title and by id
+	Statuses map[string]string
+
+	// The results of every item, in the order they were recorded
+	Results []*ItemResult
+
+	// The snapshots of the environment taken before the run, and verified
+	// after the run
+	Snapshots []*EnvSnapshot
+
+	// Arbitrary metadata attached to the run
+	Meta map[string]string
+
+	// The time the run started at
+	Started time.Time
+}
+
+func CreateRunSummary() *RunSummary {
+	return &RunSummary{
+		Statuses: make(map[string]string),
+		Started:  time.Now(),
+	}
+}
+
+/**
+ * Returns the label of the outcome of the item, e.g. FAIL (ALLOWED)
+ */
+func (r *ItemResult) Label() string {
+	switch {
+	case r.Unknown:
+		return "UNKNOWN"
+	case r.Status == STATUS_PASS && r.Item.ExpectFail:
+		return "XPASS"
+	case r.Status == STATUS_PASS:
+		return "PASS"
+	case r.Status == STATUS_FAIL && r.Item.ExpectFail:
+		return "XFAIL (expected)"
+	case r.Status == STATUS_FAIL && r.Item.AllowFailure:
+		return "FAIL (ALLOWED)"
+	case r.Status == STATUS_FAIL:
+		return "FAIL"
+	}
+	return "SKIP"
+}
+
+/**
+ * Records the outcome of an item
+ */
+func (s *RunSummary) Record(result *ItemResult) {
+	for _, ref := range result.Item.Refs() {
+		s.Statuses[ref] = result.Status
+	}
+	s.Results = append(s.Results, result)
+	if result.Item.Hidden {
+		s.Hidden += 1
+		if result.Status == STATUS_FAIL && !result.Item.ToleratesFailure() {
+			s.HiddenFailed += 1
+		}
+		return
+	}
+	if result.Unknown {
+		s.Unknown += 1
+		return
+	}
+	if result.Item.ExpectFail && result.Status != STATUS_SKIP {
+		if result.Status == STATUS_PASS {
+			s.XPassed += 1
+		} else {
+			s.XFailed += 1
+		}
+		return
+	}
+	switch result.Status {
+	case STATUS_PASS:
+		s.Passed += 1
+	case STATUS_FAIL:
+		if result.Item.AllowFailure {
+			s.Warnings += 1
+		} else {
+			s.Failed += 1
+		}
+	case STATUS_SKIP:
+		s.Skipped += 1
+	}
+}
+
+/**
+ * Checks if running an item of the given cost would exceed the budget
+ */
+func (s *RunSummary) ExceedsBudget(cost int) bool {
+	return s.Budget > 0 && s.Cost+cost > s.Budget
+}
+
+/**
+ * Checks if the items failed often enough to abort the remaining ones
+ */
+func (s *RunSummary) ReachedMaxFailures() bool {
+	return s.MaxFailures > 0 && s.Failed+s.HiddenFailed >= s.MaxFailures
+}
+
+// The orders of the items listed in the summary
+const SUMMARY_SORT_ORDER = "order"
+const SUMMARY_SORT_STATUS = "status"
+const SUMMARY_SORT_DURATION = "duration"
+
+/**
+ * Returns the rank of the result when sorting by status: the failures first,
+ * then the tolerated failures, the skipped items and the passed ones
+ */
+func (r *ItemResult) statusRank() int {
+	switch {
+	case r.Status == STATUS_FAIL && !r.Item.ToleratesFailure():
+		return 0
+	case r.Status == STATUS_FAIL:
+		return 1
+	case r.Status == STATUS_SKIP:
+		return 2
+	}
+	return 3
+}
+
+/**
+ * @brief      Returns the results of the visible items that ran or were
+ *             skipped, for the summary, in the given order: the order of the
+ *             run, by status, or the slowest first. The items that keep
+ *             their rank keep the order of the run.
+ *
+ * @param      sortBy  The order, one of the SUMMARY_SORT_* values
+ */
+func (s *RunSummary) SortedResults(sortBy string) []*ItemResult {
+	var results []*ItemResult
+	for _, result := range s.VisibleResults() {
+		if !result.Blank {
+			results = append(results, result)
+		}
+	}
+	switch sortBy {
+	case SUMMARY_SORT_STATUS:
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].statusRank() < results[j].statusRank()
+		})
+	case SUMMARY_SORT_DURATION:
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].Duration > results[j].Duration
+		})
+	}
+	return results
+}
+
+/**
+ * Returns the results of the items that are not hidden, for the reports
+ */
+func (s *RunSummary) VisibleResults() []*ItemResult {
+	var results []*ItemResult
+	for _, result := range s.Results {
+		if !result.Item.Hidden {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+func (s *RunSummary) Total() int {
+	return s.Passed + s.Failed + s.Warnings + s.Skipped + s.XFailed + s.XPassed + s.Unknown
+}
+
+/**
+ * Returns the one-line summary of the run for the scripts, with a stable set
+ * of fields: PREFLIGHTER_RESULT total=40 pass=38 fail=1 warn=0 skip=1
+ * duration=12.3s result=fail, followed by the counts of the expected failures
+ * and passes and of the unknown outcomes when there are any, so that the
+ * counts always add up to the total
+ */
+func (s *RunSummary) StatusLine(failure bool) string {
+	result := STATUS_PASS
+	if failure {
+		result = STATUS_FAIL
+	}
+	line := fmt.Sprintf("PREFLIGHTER_RESULT total=%d pass=%d fail=%d warn=%d skip=%d duration=%.1fs result=%s",
+		s.Total(), s.Passed, s.Failed, s.Warnings, s.Skipped, time.Since(s.Started).Seconds(), result)
+	for _, count := range []struct {
+		name  string
+		count int
+	}{{"xfail", s.XFailed}, {"xpass", s.XPassed}, {"unknown", s.Unknown}} {
+		if count.count > 0 {
+			line += fmt.Sprintf(" %s=%d", count.name, count.count)
+		}
+	}
+	return line
+}
+
+/**
+ * Returns the run metadata as sorted `key=value` lines
+ */
+func (s *RunSummary) MetaText() string {
+	if len(s.Meta) == 0 {
+		return ""
+	}
+
+	var keys []string
+	for key := range s.Meta {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	text := "Run metadata:\n"
+	for _, key := range keys {
+		text += fmt.Sprintf("  %s=%s\n", key, s.Meta[key])
+	}
+	return text
+}
+
+/**
+ * Describes the blocking failures by category, e.g. "2 network failures,
+ * 1 permissions failure"
+ */
+func (s *RunSummary) FailureCategories() string {
+	counts := make(map[string]int)
+	var categories []string
+	for _, result := range s.VisibleResults() {
+		category := result.Item.Category
+		if result.Status != STATUS_FAIL || result.Item.ToleratesFailure() || category == "" {
+			continue
+		}
+		if counts[category] == 0 {
+			categories = append(categories, category)
+		}
+		counts[category] += 1
+	}
+
+	var parts []string
+	for _, category := range categories {
+		if counts[category] == 1 {
+			parts = append(parts, fmt.Sprintf("1 %s failure", category))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d %s failures", counts[category], category))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
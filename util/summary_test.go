@@ -0,0 +1,107 @@
+package util
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+// The duration of the status lines, which changes with every run
+var rxStatusLineDuration = regexp.MustCompile(`duration=[0-9.]+s`)
+
+func TestRunSummarySortedResults(t *testing.T) {
+	summary := CreateRunSummary()
+	for _, result := range []*ItemResult{
+		{Item: ChecklistItem{Title: "pass"}, Status: STATUS_PASS, Duration: 1 * time.Second},
+		{Item: ChecklistItem{Title: "fail"}, Status: STATUS_FAIL, Duration: 2 * time.Second},
+		{Item: ChecklistItem{Title: "skip"}, Status: STATUS_SKIP},
+		{Item: ChecklistItem{Title: "allowed", AllowFailure: true}, Status: STATUS_FAIL, Duration: 3 * time.Second},
+		{Item: ChecklistItem{Title: "blank"}, Status: STATUS_SKIP, Blank: true},
+		{Item: ChecklistItem{Title: "hidden", Hidden: true}, Status: STATUS_FAIL},
+		{Item: ChecklistItem{Title: "slow"}, Status: STATUS_PASS, Duration: 4 * time.Second},
+	} {
+		summary.Record(result)
+	}
+
+	cases := []struct {
+		sortBy string
+		want   []string
+	}{
+		{SUMMARY_SORT_ORDER, []string{"pass", "fail", "skip", "allowed", "slow"}},
+		{SUMMARY_SORT_STATUS, []string{"fail", "allowed", "skip", "pass", "slow"}},
+		{SUMMARY_SORT_DURATION, []string{"slow", "allowed", "fail", "pass", "skip"}},
+	}
+	for _, c := range cases {
+		var titles []string
+		for _, result := range summary.SortedResults(c.sortBy) {
+			titles = append(titles, result.Item.Title)
+		}
+		if len(titles) != len(c.want) {
+			t.Errorf("%s: got %v, want %v", c.sortBy, titles, c.want)
+			continue
+		}
+		for i := range titles {
+			if titles[i] != c.want[i] {
+				t.Errorf("%s: got %v, want %v", c.sortBy, titles, c.want)
+				break
+			}
+		}
+	}
+
+	// The results of the run keep their order
+	if summary.Results[0].Item.Title != "pass" {
+		t.Errorf("the sort changed the results of the run")
+	}
+}
+
+func TestRunSummaryStatusLine(t *testing.T) {
+	summary := CreateRunSummary()
+	for _, result := range []*ItemResult{
+		{Item: ChecklistItem{Title: "pass"}, Status: STATUS_PASS},
+		{Item: ChecklistItem{Title: "fail"}, Status: STATUS_FAIL},
+		{Item: ChecklistItem{Title: "skip"}, Status: STATUS_SKIP},
+		{Item: ChecklistItem{Title: "allowed", AllowFailure: true}, Status: STATUS_FAIL},
+	} {
+		summary.Record(result)
+	}
+	line := rxStatusLineDuration.ReplaceAllString(summary.StatusLine(true), "duration=0s")
+	if want := "PREFLIGHTER_RESULT total=4 pass=1 fail=1 warn=1 skip=1 duration=0s result=fail"; line != want {
+		t.Errorf("got %q, want %q", line, want)
+	}
+
+	for _, result := range []*ItemResult{
+		{Item: ChecklistItem{Title: "xfail", ExpectFail: true}, Status: STATUS_FAIL},
+		{Item: ChecklistItem{Title: "xpass", ExpectFail: true}, Status: STATUS_PASS},
+		{Item: ChecklistItem{Title: "xpass2", ExpectFail: true}, Status: STATUS_PASS},
+		{Item: ChecklistItem{Title: "unknown"}, Status: STATUS_FAIL, Unknown: true},
+	} {
+		summary.Record(result)
+	}
+	line = rxStatusLineDuration.ReplaceAllString(summary.StatusLine(true), "duration=0s")
+	if want := "PREFLIGHTER_RESULT total=8 pass=1 fail=1 warn=1 skip=1 duration=0s result=fail xfail=1 xpass=2 unknown=1"; line != want {
+		t.Errorf("got %q, want %q", line, want)
+	}
+}
+
+func TestRunSummaryReachedMaxFailures(t *testing.T) {
+	summary := CreateRunSummary()
+	summary.MaxFailures = 2
+	for _, result := range []*ItemResult{
+		{Item: ChecklistItem{Title: "fail"}, Status: STATUS_FAIL},
+		{Item: ChecklistItem{Title: "allowed", AllowFailure: true}, Status: STATUS_FAIL},
+		{Item: ChecklistItem{Title: "pass"}, Status: STATUS_PASS},
+	} {
+		summary.Record(result)
+	}
+	if summary.ReachedMaxFailures() {
+		t.Errorf("the allowed failures do not count towards -max-failures")
+	}
+	summary.Record(&ItemResult{Item: ChecklistItem{Title: "fail2"}, Status: STATUS_FAIL})
+	if !summary.ReachedMaxFailures() {
+		t.Errorf("expecting -max-failures to be reached after 2 failures")
+	}
+	summary.MaxFailures = 0
+	if summary.ReachedMaxFailures() {
+		t.Errorf("expecting no limit without -max-failures")
+	}
+}
@@ -0,0 +1,56 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// The name that requires the tools used by the built-in functions
+const builtinToolsRequirer = "preflighter"
+
+type jsonMissingTool struct {
+	Tool       string   `json:"tool"`
+	RequiredBy []string `json:"required_by"`
+}
+
+type jsonToolsReport struct {
+	Available bool              `json:"available"`
+	Missing   []jsonMissingTool `json:"missing"`
+}
+
+/**
+ * @brief      Prints the missing tools as JSON, with the checklist files that
+ *             require every tool
+ *
+ * @param      out      The output to print to
+ * @param      missing  The missing tools
+ * @param      files    The checklist files that were checked
+ *
+ * @return     Returns the error occurred or nil
+ */
+func PrintMissingToolsJSON(out io.Writer, missing []string, files []*ChecklistFile) error {
+	report := jsonToolsReport{
+		Available: len(missing) == 0,
+		Missing:   []jsonMissingTool{},
+	}
+	for _, tool := range missing {
+		entry := jsonMissingTool{Tool: tool, RequiredBy: []string{}}
+		for _, file := range files {
+			if containsString(file.RequireTools, tool) && !containsString(entry.RequiredBy, file.Filename) {
+				entry.RequiredBy = append(entry.RequiredBy, file.Filename)
+			}
+		}
+		if len(entry.RequiredBy) == 0 {
+			entry.RequiredBy = append(entry.RequiredBy, builtinToolsRequirer)
+		}
+		report.Missing = append(report.Missing, entry)
+	}
+
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Could not marshal the tools report: %s", err.Error())
+	}
+	fmt.Fprintln(out, string(content))
+	return nil
+}
@@ -4,13 +4,16 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"os/exec"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 	"unsafe"
 
 	"github.com/briandowns/spinner"
-	. "github.com/logrusorgru/aurora"
+	"github.com/logrusorgru/aurora"
 )
 
 const PENDING = 0
@@ -19,6 +22,12 @@ const ERROR = 2
 const SUCCESS = 3
 const SKIP = 4
 const BLANK = 5
+const WARNING = 6
+const UNKNOWN = 7
+
+// All of the user-facing colors are routed through this instance, so that
+// they can be disabled at once
+var colors = aurora.NewAurora(true)
 
 type winsize struct {
 	Row    uint16
@@ -28,21 +37,252 @@ type winsize struct {
 }
 
 type CheckResult struct {
-	Stdout string
-	Stderr string
+	Stdout     string
+	Stderr     string
+	Skipped    bool
+	FixApplied bool
 }
 
-func getWidth() uint {
+// The number of columns the output is fitted to, or 0 to never truncate it
+var outputWidth = 0
+
+/**
+ * Returns the number of columns of the terminal, or 0 if the file descriptor
+ * is not a terminal
+ */
+func getWidth(fd uintptr) int {
 	ws := &winsize{}
-	retCode, _, errno := syscall.Syscall(syscall.SYS_IOCTL,
-		uintptr(syscall.Stdin),
+	retCode, _, _ := syscall.Syscall(syscall.SYS_IOCTL,
+		fd,
 		uintptr(syscall.TIOCGWINSZ),
 		uintptr(unsafe.Pointer(ws)))
 
 	if int(retCode) == -1 {
-		panic(errno)
+		return 0
+	}
+	return int(ws.Col)
+}
+
+/**
+ * Checks if the given file descriptor is a terminal
+ */
+func IsTerminal(fd uintptr) bool {
+	ws := &winsize{}
+	retCode, _, _ := syscall.Syscall(syscall.SYS_IOCTL,
+		fd,
+		uintptr(syscall.TIOCGWINSZ),
+		uintptr(unsafe.Pointer(ws)))
+
+	return int(retCode) != -1
+}
+
+/**
+ * Fits the lines of the output to the given number of columns, or to the
+ * width of the terminal if 0. The output is not truncated when it does not go
+ * to a terminal and no width is given.
+ */
+func UxSetWidth(width int) {
+	if width <= 0 {
+		width = getWidth(os.Stdout.Fd())
 	}
-	return uint(ws.Col)
+	outputWidth = width
+}
+
+/**
+ * Shortens the text to the given number of columns, ending it with an
+ * ellipsis. Only applied to the displayed text, never to the results.
+ */
+func ellipsize(text string, width int) string {
+	runes := []rune(text)
+	if width <= 0 || len(runes) <= width {
+		return text
+	}
+	if width == 1 {
+		return "…"
+	}
+	return string(runes[:width-1]) + "…"
+}
+
+/**
+ * Splits the line into lines of at most the given number of columns
+ */
+func wrapLine(line string, width int) []string {
+	runes := []rune(line)
+	if width <= 0 || len(runes) <= width {
+		return []string{line}
+	}
+	var lines []string
+	for len(runes) > width {
+		lines = append(lines, string(runes[:width]))
+		runes = runes[width:]
+	}
+	return append(lines, string(runes))
+}
+
+/**
+ * Returns the columns of the title and of the value of an item line, and the
+ * number of columns the value can use at most before being truncated
+ */
+func lineWidths(prompt string) (int, int, int) {
+	titleWidth, valueWidth := 35, 60
+	if outputWidth <= 0 {
+		return titleWidth, valueWidth, 0
+	}
+
+	// The icon and the separators take 9 columns
+	available := outputWidth - 9
+	if prompt != "" {
+		available -= len([]rune(prompt)) + 3
+	}
+	if available < titleWidth+3+valueWidth {
+		titleWidth = available * 2 / 5
+		if titleWidth < 10 {
+			titleWidth = 10
+		}
+	}
+	maxValue := available - titleWidth - 3
+	if maxValue < 10 {
+		maxValue = 10
+	}
+	if valueWidth > maxValue {
+		valueWidth = maxValue
+	}
+	return titleWidth, valueWidth, maxValue
+}
+
+/**
+ * Enables or disables the colors in all of the user-facing output
+ */
+func UxSetColors(enabled bool) {
+	colors = aurora.NewAurora(enabled)
+}
+
+// The completion of the run, shown while an item is pending
+var progressText = ""
+
+// Only print the compact result lines of the items
+var compactMode = false
+
+// Offer to start a shell in the environment of a failed item
+var shellAllowed = false
+
+// Offer to apply the fix of a failed item, instead of only suggesting it
+var autoFix = false
+
+// The answer to give to the OK prompts of the items, instead of asking
+var confirmAnswer = ""
+
+// True if a progress line is currently displayed and must be replaced
+var progressShown = false
+
+/**
+ * Sets the weighted completion percentage of the run
+ */
+func UxSetProgress(percent int) {
+	progressText = fmt.Sprintf("%d%% complete", percent)
+}
+
+/**
+ * Displays the item as pending along with the run progress, until the item
+ * outcome replaces it
+ */
+func UxItemProgress(item *ChecklistItem) {
+	printLine(PENDING, item.Title, progressText, "")
+	progressShown = true
+}
+
+// The number of items completed, shown by the live clock
+var clockDone int32
+
+// Stops the live clock, if it is running
+var clockStop chan bool
+
+/**
+ * Shows the elapsed time of the run and the number of completed items in the
+ * title of the terminal, updated every second until UxStopClock. The title
+ * is used so that the clock never moves the cursor of the item output.
+ */
+func UxStartClock(total int) {
+	started := time.Now()
+	clockStop = make(chan bool)
+	fmt.Print("\x1B[22;0t") // Save the current title
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			elapsed := int(time.Since(started).Seconds())
+			clock := fmt.Sprintf("%02d:%02d", elapsed/60%60, elapsed%60)
+			if elapsed >= 3600 {
+				clock = fmt.Sprintf("%d:%s", elapsed/3600, clock)
+			}
+			fmt.Printf("\x1B]0;preflighter: %s elapsed, %d of %d items\x07", clock, atomic.LoadInt32(&clockDone), total)
+			select {
+			case <-clockStop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+/**
+ * Updates the number of completed items shown by the live clock
+ */
+func UxClockItemsDone(done int) {
+	atomic.StoreInt32(&clockDone, int32(done))
+}
+
+/**
+ * Stops the live clock and restores the title of the terminal
+ */
+func UxStopClock() {
+	if clockStop == nil {
+		return
+	}
+	clockStop <- true
+	clockStop = nil
+	fmt.Print("\x1B[23;0t")
+}
+
+// Stops the heartbeat of the running item, if it is running
+var heartbeatStop chan bool
+
+/**
+ * Prints a line to stderr every interval while the item runs, until
+ * UxStopHeartbeat, for the CI systems that kill the jobs without output.
+ * Stderr keeps the machine-readable output on stdout intact.
+ */
+func UxStartHeartbeat(item *ChecklistItem, interval time.Duration) {
+	UxStopHeartbeat()
+	if interval <= 0 {
+		return
+	}
+	stop := make(chan bool)
+	heartbeatStop = stop
+	started := time.Now()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				fmt.Fprintf(os.Stderr, "still running: %s (%ds elapsed)\n", item.Title, int(time.Since(started).Seconds()))
+			}
+		}
+	}()
+}
+
+/**
+ * Stops the heartbeat started with UxStartHeartbeat
+ */
+func UxStopHeartbeat() {
+	if heartbeatStop == nil {
+		return
+	}
+	close(heartbeatStop)
+	heartbeatStop = nil
 }
 
 type UxPendingMonitor struct {
@@ -57,6 +297,9 @@ type UxPendingMonitor struct {
 
 func createPendingMonitor(item *ChecklistItem, expandTimeout time.Duration) *UxPendingMonitor {
 	sp := spinner.New(spinner.CharSets[9], 100*time.Millisecond)
+	if progressText != "" {
+		sp.Suffix = " " + progressText
+	}
 	lineCount := 8
 
 	return &UxPendingMonitor{
@@ -107,11 +350,11 @@ func (m *UxPendingMonitor) collapseLines() {
 
 func (m *UxPendingMonitor) printLines() {
 	fmt.Println()
-	fmt.Println(Bold("     ╒ Progress"))
+	fmt.Println(colors.Bold("     ╒ Progress"))
 	for _, line := range m.lines {
-		fmt.Println(Bold("     │ "), line)
+		fmt.Println(colors.Bold("     │ "), line)
 	}
-	fmt.Println(Bold("     ╘ ∙∙∙"))
+	fmt.Println(colors.Bold("     ╘ ∙∙∙"))
 }
 
 func (m *UxPendingMonitor) redrawLines() {
@@ -143,11 +386,42 @@ func readChar() string {
 	return strings.Trim(text, "\r\n\t ")
 }
 
+/**
+ * Prompts the user for a value without echoing the typed characters
+ */
+func UxReadSecret(prompt string) (string, error) {
+	fmt.Print(prompt)
+	defer fmt.Println()
+
+	stty := func(args ...string) error {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = os.Stdin
+		return cmd.Run()
+	}
+	err := stty("-echo")
+	if err != nil {
+		return "", fmt.Errorf("Could not disable echo: %s", err.Error())
+	}
+	defer stty("echo")
+
+	reader := bufio.NewReader(os.Stdin)
+	text, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(text, "\r\n"), nil
+}
+
 func rewindLine() {
 	fmt.Printf("\r\x1B[K")
 }
 
 func printLine(status int, title string, value interface{}, prompt string) {
+	if progressShown {
+		rewindLine()
+		progressShown = false
+	}
+
 	icon := "  "
 	wrapText := func(v interface{}) interface{} { return v }
 
@@ -158,18 +432,28 @@ func printLine(status int, title string, value interface{}, prompt string) {
 		icon = "❔"
 	case ERROR:
 		icon = "❗️"
-		wrapText = func(v interface{}) interface{} { return Bold(Red(v)) }
+		wrapText = func(v interface{}) interface{} { return colors.Bold(colors.Red(v)) }
 	case SUCCESS:
 		icon = "✅"
-		wrapText = func(v interface{}) interface{} { return Bold(Green(v)) }
+		wrapText = func(v interface{}) interface{} { return colors.Bold(colors.Green(v)) }
 	case SKIP:
 		icon = "  "
-		wrapText = func(v interface{}) interface{} { return Yellow(v) }
+		wrapText = func(v interface{}) interface{} { return colors.Yellow(v) }
+	case WARNING:
+		icon = "⚠️"
+		wrapText = func(v interface{}) interface{} { return colors.Faint(v) }
+	case UNKNOWN:
+		icon = "❓"
+		wrapText = func(v interface{}) interface{} { return colors.Magenta(v) }
 	}
 
-	fmt.Printf("  %s  %-35s : ", icon, wrapText(title))
+	titleWidth, valueWidth, maxValue := lineWidths(prompt)
+	fmt.Printf("  %s  %-*s : ", icon, titleWidth, wrapText(ellipsize(title, titleWidth)))
 	if value != "" || prompt != "" {
-		fmt.Printf("%-60s", wrapText(value))
+		if text, ok := value.(string); ok {
+			value = ellipsize(text, maxValue)
+		}
+		fmt.Printf("%-*s", valueWidth, wrapText(value))
 	}
 	if prompt != "" {
 		fmt.Printf(" : %s", wrapText(prompt))
@@ -177,46 +461,491 @@ func printLine(status int, title string, value interface{}, prompt string) {
 }
 
 func printBlock(block string, title string) {
-	fmt.Println(Bold("     ╒ " + title))
+	fmt.Println(colors.Bold("     ╒ " + title))
 	lines := strings.Split(block, "\n")
 	for _, line := range lines {
 		if line == "" {
 			continue
 		}
-		fmt.Println(Bold("     │ "), line)
+		// The prefix of the lines takes 8 columns
+		for _, part := range wrapLine(line, outputWidth-8) {
+			fmt.Println(colors.Bold("     │ "), part)
+		}
 	}
-	fmt.Println(Bold("     ╘ ●"))
+	fmt.Println(colors.Bold("     ╘ ●"))
 }
 
 func UxPrintError(err error) {
-	fmt.Println(Bold(Red("ERROR:")), Bold(White(err.Error())))
+	fmt.Println(colors.Bold(colors.Red("ERROR:")), colors.Bold(colors.White(err.Error())))
+}
+
+/**
+ * Enables the option to apply the fix of an item when it fails
+ */
+func UxSetAutoFix(enabled bool) {
+	autoFix = enabled
+}
+
+/**
+ * Answers the OK prompts of the items with the given answer (y or n) instead
+ * of asking the operator, or asks again if empty
+ */
+func UxSetConfirmAnswer(answer string) {
+	confirmAnswer = answer
+}
+
+/**
+ * Enables the option to start a shell when an item fails
+ */
+func UxSetShellAllowed(allowed bool) {
+	shellAllowed = allowed
+}
+
+/**
+ * Starts a shell in the environment of the item, for the operator to debug
+ * a failure
+ */
+func uxItemShell(item *ChecklistItem, runner *Runner) {
+	fmt.Println(colors.Faint("   Starting a shell in the environment of the item, exit it to continue"))
+	if err := ItemShell(item, runner); err != nil {
+		UxPrintError(err)
+	}
+}
+
+/**
+ * Enables the compact output, where the item results are only displayed
+ * through UxCompactResult
+ */
+func UxSetCompact(enabled bool) {
+	compactMode = enabled
+}
+
+/**
+ * Prints a single line with the result of the item, followed by the failure
+ * details if it failed
+ */
+func UxCompactResult(index int, result *ItemResult) {
+	icon := "  "
+	wrapText := func(v interface{}) interface{} { return v }
+	switch {
+	case result.Unknown:
+		icon = "❓"
+		wrapText = func(v interface{}) interface{} { return colors.Magenta(v) }
+	case result.Status == STATUS_PASS:
+		icon = "✅"
+	case result.Status == STATUS_FAIL && result.Item.ToleratesFailure():
+		icon = "⚠️"
+		wrapText = func(v interface{}) interface{} { return colors.Faint(v) }
+	case result.Status == STATUS_FAIL:
+		icon = "❗️"
+		wrapText = func(v interface{}) interface{} { return colors.Bold(colors.Red(v)) }
+	case result.Status == STATUS_SKIP:
+		wrapText = func(v interface{}) interface{} { return colors.Yellow(v) }
+	}
+
+	detail := fmt.Sprintf("(%s)", result.Duration.Round(time.Millisecond))
+	if result.Status == STATUS_SKIP && result.Value != "" {
+		detail = fmt.Sprintf("(%s)", result.Value)
+	}
+	title := result.Item.Title
+	if outputWidth > 0 {
+		// The icon, the number and the separators take 10 columns
+		title = ellipsize(title, outputWidth-10-len([]rune(detail)))
+	}
+	fmt.Printf("  %s %3d. %s %s\n", icon, index, wrapText(title), colors.Faint(detail))
+	if result.Status == STATUS_FAIL || result.Unknown {
+		printFailureDetails(&result.Item, result.Stderr)
+	}
+}
+
+func UxPrintWarning(err error) {
+	fmt.Println(colors.Bold(colors.Yellow("WARNING:")), colors.Bold(colors.White(err.Error())))
+}
+
+func UxPrintHeaderValue(label string, value string) {
+	fmt.Printf(" %s: %s\n", colors.Faint(label), colors.Bold(value))
+}
+
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+/**
+ * Substitutes the variables of the item, of its checklist and of the
+ * environment in the script. If secrets are given, their values and the ones
+ * of the variables named like secrets are masked.
+ */
+func resolveItemScript(script string, item *ChecklistItem, file *ChecklistFile, secrets map[string]bool) string {
+	return os.Expand(script, func(key string) string {
+		if secrets != nil && (secrets[key] || rxSecretVarName.MatchString(key)) {
+			return "********"
+		}
+		if value, ok := item.Env[key]; ok {
+			return value
+		}
+		if value, ok := file.Env[key]; ok {
+			return value
+		}
+		if value, ok := os.LookupEnv(key); ok {
+			return value
+		}
+		return "${" + key + "}"
+	})
+}
+
+/**
+ * Prints the check of the item under its title in the list of the items:
+ * the shell or built-in check, the runbook item it updates, and the resolved
+ * script with the secrets masked
+ */
+func UxListItemDetails(item *ChecklistItem, file *ChecklistFile, secrets map[string]bool) {
+	var check string
+	switch {
+	case item.Files != nil:
+		check = "built-in files check"
+	case item.DNS != nil:
+		check = fmt.Sprintf("built-in dns check of %s %s", firstNonEmpty(strings.ToUpper(item.DNS.Type), "A"), item.DNS.Name)
+	case item.Service != nil && item.Service.Unit != "":
+		check = "built-in service check of unit " + item.Service.Unit
+	case item.Service != nil:
+		check = "built-in service check of process " + item.Service.Process
+	case item.Cert != nil:
+		check = "built-in cert check of " + firstNonEmpty(item.Cert.Host, item.Cert.File)
+	case item.Wait != nil:
+		check = "built-in wait check, " + firstNonEmpty(item.Lang, "bash")
+	default:
+		check = firstNonEmpty(item.Lang, "bash")
+	}
+	if CanCheckItem(item) {
+		check += ", automatic"
+	} else {
+		check += ", manual (no assertions)"
+	}
+	if item.RunbookID != "" {
+		check += fmt.Sprintf(", updates runbook item %s of step %s", item.RunbookID, item.RunbookStep)
+	}
+	fmt.Printf("       %s\n", colors.Faint(check))
+
+	script := item.Script
+	if item.Wait != nil {
+		script = item.Wait.Until
+	}
+	for _, line := range strings.Split(strings.TrimRight(resolveItemScript(script, item, file, secrets), "\n"), "\n") {
+		if line != "" {
+			fmt.Printf("       │ %s\n", line)
+		}
+	}
+}
+
+/**
+ * Prints the fully-resolved configuration of an item, with the variables of
+ * its checklist and of the environment substituted in its scripts
+ */
+func UxExplainItem(index int, item *ChecklistItem, file *ChecklistFile) {
+	resolve := func(script string) string {
+		return resolveItemScript(script, item, file, nil)
+	}
+	field := func(label string, value interface{}) {
+		fmt.Printf(" %s %v\n", colors.Bold(fmt.Sprintf("%-15s", label+":")), value)
+	}
+
+	field("Item", fmt.Sprintf("#%d %s", index, item.Title))
+	field("Checklist", fmt.Sprintf("%s (%s)", file.Title, file.Filename))
+	field("Shell", firstNonEmpty(item.Lang, "bash"))
+	if item.Category != "" {
+		field("Category", item.Category)
+	}
+	if item.DocURL != "" {
+		field("Documentation", item.DocURL)
+	}
+	if item.ExpectMatch != "" {
+		field("Expect", item.ExpectMatch)
+	}
+	if item.DNS != nil {
+		field("DNS", fmt.Sprintf("%s %s", firstNonEmpty(strings.ToUpper(item.DNS.Type), "A"), item.DNS.Name))
+	}
+	if item.Service != nil && item.Service.Unit != "" {
+		field("Service", "unit "+item.Service.Unit)
+	} else if item.Service != nil {
+		field("Service", "process "+item.Service.Process)
+	}
+	if item.Cert != nil {
+		field("Certificate", fmt.Sprintf("%s, valid for at least %d days", firstNonEmpty(item.Cert.Host, item.Cert.File), item.Cert.minDays()))
+	}
+	for _, assertion := range item.ExpectJSON {
+		field("Expect JSON", assertion.Path)
+	}
+	if item.Wait != nil {
+		interval, timeout := item.Wait.durations()
+		field("Wait", fmt.Sprintf("every %s, for up to %s", interval, timeout))
+	}
+	if item.GoldenFile != "" {
+		field("Golden file", item.GoldenFile)
+	}
+	if item.ExpectExitCode != nil {
+		field("Expect exit", *item.ExpectExitCode)
+	}
+	if code := item.UnknownExitCode; code != nil || file.UnknownExitCode != nil {
+		if code == nil {
+			code = file.UnknownExitCode
+		}
+		field("Unknown exit", *code)
+	}
+	if item.ExpectMin != nil {
+		field("Expect min", *item.ExpectMin)
+	}
+	if item.ExpectMax != nil {
+		field("Expect max", *item.ExpectMax)
+	}
+	if item.RunbookID != "" {
+		field("Runbook", fmt.Sprintf("item %s of step %s", item.RunbookID, item.RunbookStep))
+	}
+	if item.SkipIf != nil {
+		field("Skip if", fmt.Sprintf("'%s' is %s", item.SkipIf.Item, item.SkipIf.Status))
+	}
+	if item.RunIf != nil {
+		field("Run if", fmt.Sprintf("'%s' is %s", item.RunIf.Item, item.RunIf.Status))
+	}
+	for _, dep := range item.DependsOn {
+		field("Depends on", dep)
+	}
+	if len(item.RequireOS) > 0 {
+		field("Require OS", strings.Join(item.RequireOS, ", "))
+	}
+	for _, key := range sortedKeys(item.RequireEnv) {
+		field("Require env", fmt.Sprintf("%s =~ %s", key, item.RequireEnv[key]))
+	}
+	for _, key := range sortedKeys(item.Env) {
+		field("Variable", fmt.Sprintf("%s=%s", key, item.Env[key]))
+	}
+	if timeout := firstNonEmpty(item.Timeout, file.DefaultTimeout); timeout != "" {
+		field("Timeout", timeout)
+	}
+	if item.SoftTimeout != "" {
+		field("Soft timeout", item.SoftTimeout)
+	}
+	retries := file.DefaultRetries
+	if item.Retries != nil {
+		retries = *item.Retries
+	}
+	if retries > 0 {
+		field("Retries", fmt.Sprintf("%d, %s apart", retries, firstNonEmpty(item.RetryDelay, file.DefaultRetryDelay, "0s")))
+	}
+	field("Weight", item.GetWeight())
+	if item.Mutex != "" {
+		field("Mutex", item.Mutex)
+	}
+	field("Allow failure", item.AllowFailure)
+	field("Expect fail", item.ExpectFail)
+	field("Clean env", item.CleanEnv)
+	field("Locale", firstNonEmpty(item.Locale, defaultLocale))
+	fmt.Println()
+
+	printBlock(resolve(item.Script), "Script")
+	if item.Wait != nil {
+		printBlock(resolve(item.Wait.Until), "Wait Until")
+	}
+	if item.ExpectScript != "" {
+		printBlock(resolve(item.ExpectScript), "Expect Script")
+	}
+	if item.AfterEach != "" {
+		printBlock(resolve(item.AfterEach), "After Each Script")
+	}
+	if item.OnPass != "" {
+		printBlock(resolve(item.OnPass), "On Pass Script")
+	}
+	if item.OnFail != "" {
+		printBlock(resolve(item.OnFail), "On Fail Script")
+	}
+	if item.Fix != "" {
+		printBlock(resolve(item.Fix), "Fix")
+	}
+	if item.Remediation != "" {
+		printBlock(resolve(item.Remediation), "Remediation")
+	}
+}
+
+func UxPrintMissingTools(missing []string) {
+	UxPrintError(fmt.Errorf("There are missing executables from your path:"))
+	for _, name := range missing {
+		fmt.Printf(" ‣ Did not find '%s'\n", name)
+	}
 }
 
 func UxBlankItem(item *ChecklistItem) {
+	if compactMode {
+		return
+	}
 	printLine(BLANK, item.Title, "---", "---")
 	fmt.Println()
 }
 
 func UxSkipItem(item *ChecklistItem, reason string) {
+	if compactMode {
+		return
+	}
 	printLine(SKIP, item.Title, "---", reason)
 	fmt.Println()
 }
 
 func UxPassItem(item *ChecklistItem, value string) {
-	printLine(SUCCESS, item.Title, value, "PASS")
+	if compactMode {
+		return
+	}
+	if item.ExpectFail {
+		printLine(SUCCESS, item.Title, value, "XPASS")
+	} else {
+		printLine(SUCCESS, item.Title, value, "PASS")
+	}
+	fmt.Println()
+}
+
+func printFailureDetails(item *ChecklistItem, cerr string) {
+	if item.Category != "" {
+		fmt.Println(colors.Bold("     Category:"), item.Category)
+	}
+	if item.DocURL != "" {
+		fmt.Println(colors.Bold("     Documentation:"), item.DocURL)
+	}
+	printBlock(item.Script, "Script")
+	printBlock(cerr, "Command Output")
+	if item.Remediation != "" {
+		printBlock(item.Remediation, "Remediation")
+	}
+	if item.Fix != "" && !autoFix {
+		printBlock(item.Fix, "Suggested Fix (apply with -auto-fix)")
+	}
 	fmt.Println()
 }
 
+/**
+ * Offers to apply the fix of the failed item, or only suggests it without
+ * -auto-fix. Returns true if the fix was applied and the item must be
+ * checked again.
+ */
+func uxOfferFix(item *ChecklistItem, runner *Runner, res *CheckResult) bool {
+	if item.Fix == "" || res.FixApplied {
+		return false
+	}
+	if !autoFix {
+		printBlock(item.Fix, "Suggested Fix (apply with -auto-fix)")
+		return false
+	}
+
+	printBlock(item.Fix, "Fix")
+	fmt.Printf("   Apply the fix and check again? [y/N] ")
+	if c := readChar(); c != "y" && c != "Y" {
+		return false
+	}
+	res.FixApplied = true
+	if out, err := RunItemFix(item, runner); err != nil {
+		UxPrintWarning(fmt.Errorf("The fix of %s failed: %s", item.Title, err.Error()))
+		printBlock(out, "Fix Output")
+		return false
+	}
+	return true
+}
+
 func UxFailItem(item *ChecklistItem, value string, cerr string) {
+	if compactMode {
+		return
+	}
 	printLine(ERROR, item.Title, value, "FAIL")
 	fmt.Println()
-	printBlock(item.Script, "Script")
-	printBlock(cerr, "Command Output")
+	printFailureDetails(item, cerr)
+}
+
+func UxAllowedFailItem(item *ChecklistItem, value string, cerr string) {
+	if compactMode {
+		return
+	}
+	if item.ExpectFail {
+		printLine(WARNING, item.Title, value, "XFAIL (expected)")
+	} else {
+		printLine(WARNING, item.Title, value, "FAIL (ALLOWED)")
+	}
+	fmt.Println()
+	printFailureDetails(item, cerr)
+}
+
+/**
+ * Shows an item whose check could not determine the outcome, with the status
+ * it is treated as
+ */
+func UxUnknownItem(item *ChecklistItem, value string, cerr string, status string) {
+	if compactMode {
+		return
+	}
+	printLine(UNKNOWN, item.Title, value, fmt.Sprintf("UNKNOWN (as %s)", status))
+	fmt.Println()
+	printFailureDetails(item, cerr)
+}
+
+/**
+ * Shows the test cases imported from the JUnit output of an item, with the
+ * messages of the ones that did not pass
+ */
+func UxPrintSubResults(results []SubResult) {
+	if compactMode {
+		return
+	}
+	for _, result := range results {
+		label := colors.Green("PASS")
+		if result.Status == STATUS_FAIL {
+			label = colors.Bold(colors.Red("FAIL"))
+		} else if result.Status == STATUS_SKIP {
+			label = colors.Yellow("SKIP")
+		}
+		fmt.Printf("       %s %s\n", label, result.Name)
+		if result.Status != STATUS_PASS && result.Message != "" {
+			fmt.Println(colors.Faint("            " + strings.Split(result.Message, "\n")[0]))
+		}
+	}
+	fmt.Println()
+}
+
+/**
+ * Replaces the outcome of an item that passed, but failed a later verification
+ */
+func printLateFailure(item *ChecklistItem, reason string) {
+	rewindLine()
+	if item.ExpectFail {
+		printLine(WARNING, item.Title, reason, "XFAIL (expected)")
+	} else if item.AllowFailure {
+		printLine(WARNING, item.Title, reason, "FAIL (ALLOWED)")
+	} else {
+		printLine(ERROR, item.Title, reason, "FAIL")
+	}
+	fmt.Println()
+}
+
+func UxFailAfterEach(item *ChecklistItem, reason string, output string) {
+	printLateFailure(item, reason)
+	printBlock(item.AfterEach, "After Each Script")
+	printBlock(output, "Command Output")
+	fmt.Println()
+}
+
+func UxFailBaseline(item *ChecklistItem, diff string) {
+	printLateFailure(item, "Output differs from baseline")
+	printBlock(diff, "Baseline Difference")
 	fmt.Println()
 }
 
 func UxCheckItem(item *ChecklistItem, runner *Runner) (bool, CheckResult) {
 	var res CheckResult
+	failStatus, failPrompt, passPrompt := ERROR, "FAIL", "PASS"
+	if item.ExpectFail {
+		failStatus, failPrompt, passPrompt = WARNING, "XFAIL (expected)", "XPASS"
+	} else if item.AllowFailure {
+		failStatus, failPrompt = WARNING, "FAIL (ALLOWED)"
+	}
+check:
 	for {
 		moni := createPendingMonitor(item, 10*time.Second)
 		moni.Start()
@@ -234,29 +963,50 @@ func UxCheckItem(item *ChecklistItem, runner *Runner) (bool, CheckResult) {
 			printBlock(item.Script, "Script")
 			printBlock(sout+"\n"+serr, "Command Output")
 			fmt.Println()
-			fmt.Printf("   Do you want to re-try? [Y/n] ")
+			if uxOfferFix(item, runner, &res) {
+				continue
+			}
+			for {
+				if shellAllowed {
+					fmt.Printf("   Do you want to re-try? [Y/n/sh] ")
+				} else {
+					fmt.Printf("   Do you want to re-try? [Y/n] ")
+				}
 
-			c := readChar()
-			fmt.Printf("\x1B[1A")
-			rewindLine()
+				c := readChar()
+				fmt.Printf("\x1B[1A")
+				rewindLine()
 
-			switch c {
-			case "N", "n":
-				return false, res
+				switch c {
+				case "N", "n":
+					return false, res
+				case "sh", "SH":
+					if shellAllowed {
+						fmt.Println()
+						uxItemShell(item, runner)
+						continue
+					}
+				}
+				break
 			}
 			continue
 		}
 
 		for {
 			rewindLine()
-			printLine(PROMPT, item.Title, Bold(sout), "OK? [Y/n/s/v] ")
-			c := readChar()
+			printLine(PROMPT, item.Title, colors.Bold(sout), "OK? [Y/n/s/v] ")
+			c := confirmAnswer
+			if c == "" {
+				c = readChar()
+			} else {
+				fmt.Println(c)
+			}
 			fmt.Printf("\x1B[1A")
 
 			switch c {
 			case "y", "Y", "":
 				rewindLine()
-				printLine(SUCCESS, item.Title, sout, "PASS")
+				printLine(SUCCESS, item.Title, sout, passPrompt)
 				fmt.Println()
 				return true, res
 
@@ -264,6 +1014,7 @@ func UxCheckItem(item *ChecklistItem, runner *Runner) (bool, CheckResult) {
 				rewindLine()
 				printLine(SKIP, item.Title, sout, "SKIP")
 				fmt.Println()
+				res.Skipped = true
 				return true, res
 
 			case "v", "V":
@@ -275,11 +1026,385 @@ func UxCheckItem(item *ChecklistItem, runner *Runner) (bool, CheckResult) {
 
 			case "n", "N":
 				rewindLine()
-				printLine(ERROR, item.Title, sout, "FAIL")
+				printLine(failStatus, item.Title, sout, failPrompt)
 				fmt.Println()
+				if uxOfferFix(item, runner, &res) {
+					continue check
+				}
 				return false, res
 			}
 		}
 
 	}
 }
+
+func UxPrintSummary(summary *RunSummary, sortBy string) {
+	fmt.Println(colors.Bold("     ╒ Summary"))
+	if runID := summary.Meta["run_id"]; runID != "" {
+		fmt.Println(colors.Bold("     │ "), fmt.Sprintf("%-8s :", "Run ID"), runID)
+	}
+	fmt.Println(colors.Bold("     │ "), fmt.Sprintf("%-8s :", "Passed"), colors.Bold(colors.Green(summary.Passed)))
+	fmt.Println(colors.Bold("     │ "), fmt.Sprintf("%-8s :", "Failed"), colors.Bold(colors.Red(summary.Failed)))
+	if categories := summary.FailureCategories(); categories != "" {
+		if outputWidth > 0 {
+			categories = ellipsize(categories, outputWidth-19)
+		}
+		fmt.Println(colors.Bold("     │ "), fmt.Sprintf("%-8s  ", ""), colors.Red(categories))
+	}
+	if summary.Warnings > 0 && summary.WarningsEscalated {
+		fmt.Println(colors.Bold("     │ "), fmt.Sprintf("%-8s :", "Warnings"), colors.Bold(colors.Red(summary.Warnings)), colors.Red("(escalated to failures)"))
+	} else if summary.Warnings > 0 {
+		fmt.Println(colors.Bold("     │ "), fmt.Sprintf("%-8s :", "Warnings"), colors.Faint(summary.Warnings))
+	}
+	if summary.XFailed > 0 {
+		fmt.Println(colors.Bold("     │ "), fmt.Sprintf("%-8s :", "XFailed"), colors.Faint(summary.XFailed))
+	}
+	if summary.Unknown > 0 {
+		fmt.Println(colors.Bold("     │ "), fmt.Sprintf("%-8s :", "Unknown"), colors.Bold(colors.Magenta(summary.Unknown)), colors.Magenta("(as "+summary.UnknownAs+")"))
+	}
+	if summary.XPassed > 0 && summary.XPassStrict {
+		fmt.Println(colors.Bold("     │ "), fmt.Sprintf("%-8s :", "XPassed"), colors.Bold(colors.Red(summary.XPassed)), colors.Red("(expected to fail)"))
+	} else if summary.XPassed > 0 {
+		fmt.Println(colors.Bold("     │ "), fmt.Sprintf("%-8s :", "XPassed"), colors.Yellow(summary.XPassed), colors.Yellow("(expected to fail)"))
+	}
+	fmt.Println(colors.Bold("     │ "), fmt.Sprintf("%-8s :", "Skipped"), colors.Yellow(summary.Skipped))
+	if summary.HiddenFailed > 0 {
+		fmt.Println(colors.Bold("     │ "), fmt.Sprintf("%-8s :", "Hidden"), colors.Bold(colors.Red(fmt.Sprintf("%d failed", summary.HiddenFailed))))
+	}
+	fmt.Println(colors.Bold("     │ "), fmt.Sprintf("%-8s :", "Total"), colors.Bold(summary.Total()))
+	if summary.VerifyFailed() {
+		fmt.Println(colors.Bold("     │ "), fmt.Sprintf("%-8s :", "Verify"), colors.Bold(colors.Red("FAILED")))
+	} else if len(summary.Snapshots) > 0 {
+		fmt.Println(colors.Bold("     │ "), fmt.Sprintf("%-8s :", "Verify"), colors.Green("passed"))
+	}
+	if summary.StoppedEarly {
+		fmt.Println(colors.Bold("     │ "), fmt.Sprintf("%-8s :", "Stopped"), colors.Red(fmt.Sprintf("early, after %d failures (-max-failures)", summary.MaxFailures)))
+	}
+	if summary.Budget > 0 {
+		fmt.Println(colors.Bold("     │ "), fmt.Sprintf("%-8s :", "Cost"), fmt.Sprintf("%d of %d", summary.Cost, summary.Budget))
+	} else if summary.Cost > 0 {
+		fmt.Println(colors.Bold("     │ "), fmt.Sprintf("%-8s :", "Cost"), summary.Cost)
+	}
+	if sortBy != "" {
+		uxPrintSummaryItems(summary.SortedResults(sortBy))
+	}
+	fmt.Println(colors.Bold("     ╘ ●"))
+}
+
+/**
+ * Prints the outcome, the duration and the title of the items in the summary
+ */
+func uxPrintSummaryItems(results []*ItemResult) {
+	fmt.Println(colors.Bold("     │ "))
+	for _, result := range results {
+		label := fmt.Sprintf("%-16s", result.Label())
+		switch result.statusRank() {
+		case 0:
+			label = colors.Bold(colors.Red(label)).String()
+		case 1:
+			label = colors.Faint(label).String()
+		case 2:
+			label = colors.Yellow(label).String()
+		default:
+			label = colors.Green(label).String()
+		}
+		duration := fmt.Sprintf("%8s", result.Duration.Round(time.Millisecond))
+		title := result.Item.Title
+		if outputWidth > 0 {
+			// The box, the label and the duration take 36 columns
+			title = ellipsize(title, outputWidth-36)
+		}
+		fmt.Println(colors.Bold("     │ "), label, colors.Faint(duration), title)
+	}
+}
+
+/**
+ * Prints the number and the title of every failed item of the run, for the
+ * runs that kept going after the first failure
+ */
+func UxPrintFailedItems(summary *RunSummary) {
+	var numbers []int
+	for i, result := range summary.Results {
+		if result.Status == STATUS_FAIL && !result.Item.ToleratesFailure() && !result.Item.Hidden {
+			numbers = append(numbers, i+1)
+		}
+	}
+	if len(numbers) == 0 {
+		return
+	}
+	fmt.Println()
+	fmt.Println(colors.Bold("     ╒ Failed Items"))
+	for _, number := range numbers {
+		fmt.Println(colors.Bold("     │ "), fmt.Sprintf("%3d.", number), colors.Bold(colors.Red(summary.Results[number-1].Item.Title)))
+	}
+	fmt.Println(colors.Bold("     ╘ ●"))
+}
+
+/**
+ * Prints the failed items grouped by category or by common error, with the
+ * remediation of each group and the numbers of the items in the run
+ */
+func UxPrintFailureAnalysis(groups []*FailureGroup) {
+	if len(groups) == 0 {
+		return
+	}
+	fmt.Println()
+	fmt.Println(colors.Bold("     ╒ Failure Analysis"))
+	for i, group := range groups {
+		if i > 0 {
+			fmt.Println(colors.Bold("     │"))
+		}
+		fmt.Println(colors.Bold("     │ "), colors.Bold(colors.Red(group.Title())))
+		var remediations []string
+		numbers := make(map[string][]string)
+		for j, result := range group.Results {
+			number := fmt.Sprintf("#%d", group.Numbers[j])
+			fmt.Println(colors.Bold("     │ "), fmt.Sprintf("  %-5s", number), result.Item.Title, colors.Faint(result.Label()))
+			remediation := strings.TrimSpace(result.Item.Remediation)
+			if remediation == "" {
+				continue
+			}
+			if numbers[remediation] == nil {
+				remediations = append(remediations, remediation)
+			}
+			numbers[remediation] = append(numbers[remediation], number)
+		}
+		for _, remediation := range remediations {
+			fmt.Println(colors.Bold("     │ "), colors.Bold(fmt.Sprintf("  Remediation (%s):", strings.Join(numbers[remediation], ", "))))
+			for _, line := range strings.Split(remediation, "\n") {
+				fmt.Println(colors.Bold("     │ "), "    "+line)
+			}
+		}
+	}
+	fmt.Println(colors.Bold("     ╘ ●"))
+}
+
+/**
+ * Asks the operator what to do with an item that failed in an unattended
+ * run. Returns "retry", "skip" or "abort".
+ */
+func UxFailurePrompt(item *ChecklistItem, runner *Runner) string {
+	for {
+		if shellAllowed {
+			fmt.Printf("   %s failed. Retry, skip, abort or open a shell? [r/s/A/sh] ", colors.Bold(item.Title))
+		} else {
+			fmt.Printf("   %s failed. Retry, skip or abort? [r/s/A] ", colors.Bold(item.Title))
+		}
+		switch readChar() {
+		case "sh", "SH":
+			if shellAllowed {
+				uxItemShell(item, runner)
+			}
+		case "r", "R":
+			return "retry"
+		case "s", "S":
+			return "skip"
+		case "a", "A", "":
+			return "abort"
+		}
+	}
+}
+
+/**
+ * Lets the operator toggle which of the items to run. Returns the selection
+ * status of every item, all of them selected by default.
+ */
+func UxSelectItems(items []ChecklistItem) []bool {
+	selected := make([]bool, len(items))
+	for i := range selected {
+		selected[i] = true
+	}
+
+	for {
+		fmt.Println()
+		for i, item := range items {
+			mark := " "
+			if selected[i] {
+				mark = "x"
+			}
+			fmt.Printf("  [%s] %2d. %s\n", mark, i+1, item.Title)
+		}
+		fmt.Println()
+		fmt.Printf("%s ", colors.Bold("Toggle items (e.g. 2 4-6), 'a' for all, 'n' for none, or Enter to run:"))
+
+		text := readChar()
+		switch text {
+		case "":
+			return selected
+		case "a", "A", "n", "N":
+			for i := range selected {
+				selected[i] = text == "a" || text == "A"
+			}
+			continue
+		}
+
+		for _, field := range strings.Fields(text) {
+			var from, to int
+			if n, _ := fmt.Sscanf(field, "%d-%d", &from, &to); n != 2 {
+				if _, err := fmt.Sscanf(field, "%d", &from); err != nil {
+					UxPrintError(fmt.Errorf("Invalid item number '%s'", field))
+					continue
+				}
+				to = from
+			}
+			if from < 1 || to > len(items) || from > to {
+				UxPrintError(fmt.Errorf("Invalid item range '%s', expecting numbers between 1 and %d", field, len(items)))
+				continue
+			}
+			for i := from - 1; i < to; i++ {
+				selected[i] = !selected[i]
+			}
+		}
+	}
+}
+
+/**
+ * Prints a summary of what the run is going to execute, against the given
+ * target values, and asks for a single confirmation to run the checks in the
+ * given mode (e.g. "unattended"). Returns true if the operator confirmed, or
+ * if the confirmation is given in advance.
+ */
+func UxPreviewRun(items []ChecklistItem, target [][2]string, mode string, confirmed bool) bool {
+	var privileged, runbookLinked, builtin []string
+	for _, item := range items {
+		if item.Privileged {
+			privileged = append(privileged, item.Title)
+		}
+		if item.RunbookID != "" {
+			runbookLinked = append(runbookLinked, item.Title)
+		}
+		if item.HasBuiltinCheck() {
+			builtin = append(builtin, item.Title)
+		}
+	}
+
+	fmt.Println(colors.Bold("Preview of the run:"))
+	for _, pair := range target {
+		fmt.Printf("  %s %s\n", colors.Bold(fmt.Sprintf("%-20s", pair[0]+":")), pair[1])
+	}
+	fmt.Printf("  %s %s\n", colors.Bold(fmt.Sprintf("%-20s", "Mode:")), mode)
+	fmt.Printf("  %s %d\n", colors.Bold(fmt.Sprintf("%-20s", "Items to run:")), len(items))
+	list := func(label string, titles []string) {
+		if len(titles) == 0 {
+			return
+		}
+		fmt.Printf("  %s %d\n", colors.Bold(fmt.Sprintf("%-20s", label+":")), len(titles))
+		for _, title := range titles {
+			fmt.Printf("    - %s\n", title)
+		}
+	}
+	list("Run with sudo", privileged)
+	list("Update the runbook", runbookLinked)
+	list("Built-in checks", builtin)
+	fmt.Println()
+
+	if confirmed {
+		return true
+	}
+	fmt.Printf("%s ", colors.Bold(fmt.Sprintf("Run these checks %s? [y/N]", mode)))
+	switch readChar() {
+	case "y", "Y", "yes", "YES":
+		fmt.Println()
+		return true
+	}
+	fmt.Println("🚨 ", colors.Bold(colors.Red("Not confirmed, nothing was run")))
+	return false
+}
+
+/**
+ * Asks the operator to explicitly acknowledge the outcome before continuing.
+ * Returns true only if the exact confirmation phrase was typed.
+ */
+func UxConfirmContinue() bool {
+	fmt.Println()
+	fmt.Printf("%s ", colors.Bold("All checks passed. Type CONTINUE to proceed:"))
+	if readChar() != "CONTINUE" {
+		fmt.Println("🚨 ", colors.Bold(colors.Red("Not acknowledged. You are not clear to continue")))
+		return false
+	}
+	return true
+}
+
+func UxPrintOutcome(failure bool) {
+	fmt.Println()
+	if failure {
+		fmt.Println("🚨 ", colors.Bold(colors.Red("There was a failed item. You are not clear to continue")))
+	} else {
+		fmt.Println("🍺 ", colors.Bold("All checks are passing. You are clear to continue"))
+	}
+}
+
+/**
+ * Prints the items as a tree of the items they refer to through their
+ * dependencies and conditions, starting from the items that no other item
+ * refers to. An item is expanded once, the next references to it are marked
+ * as listed above, and the cycles and the references to unknown items are
+ * highlighted in red.
+ */
+func UxPrintItemGraph(graph *ItemGraph) {
+	referred := make([]bool, len(graph.Items))
+	for _, edges := range graph.Edges {
+		for _, edge := range edges {
+			if edge.To >= 0 {
+				referred[edge.To] = true
+			}
+		}
+	}
+
+	expanded := make([]bool, len(graph.Items))
+	onPath := make([]bool, len(graph.Items))
+	var printEdges func(i int, indent string)
+	printEdges = func(i int, indent string) {
+		expanded[i] = true
+		onPath[i] = true
+		for n, edge := range graph.Edges[i] {
+			branch, next := "├─ ", "│  "
+			if n == len(graph.Edges[i])-1 {
+				branch, next = "└─ ", "   "
+			}
+			switch {
+			case edge.To < 0:
+				fmt.Printf("%s%s%s %s\n", indent, branch, edge.Kind,
+					colors.Bold(colors.Red(fmt.Sprintf("'%s' (unknown item)", edge.Ref))))
+			case onPath[edge.To]:
+				fmt.Printf("%s%s%s %d. %s %s\n", indent, branch, edge.Kind, edge.To+1,
+					graph.Items[edge.To].Title, colors.Bold(colors.Red("(cycle)")))
+			case expanded[edge.To] && len(graph.Edges[edge.To]) > 0:
+				fmt.Printf("%s%s%s %d. %s %s\n", indent, branch, edge.Kind, edge.To+1,
+					graph.Items[edge.To].Title, colors.Faint("(see above)"))
+			default:
+				fmt.Printf("%s%s%s %d. %s\n", indent, branch, edge.Kind, edge.To+1, graph.Items[edge.To].Title)
+				printEdges(edge.To, indent+next)
+			}
+		}
+		onPath[i] = false
+	}
+
+	// The items of a cycle that no other item refers to have no root, they
+	// are printed after the roots
+	for _, roots := range []bool{true, false} {
+		for i, item := range graph.Items {
+			if expanded[i] || (roots && referred[i]) {
+				continue
+			}
+			fmt.Printf(" %2d. %s\n", i+1, item.Title)
+			printEdges(i, "     ")
+		}
+	}
+
+	cycles := graph.Cycles()
+	unknown := graph.UnknownRefs()
+	if len(cycles) > 0 || len(unknown) > 0 {
+		fmt.Println()
+	}
+	for _, cycle := range cycles {
+		titles := make([]string, len(cycle))
+		for n, i := range cycle {
+			titles[n] = fmt.Sprintf("%d. %s", i+1, graph.Items[i].Title)
+		}
+		fmt.Println(colors.Bold(colors.Red("Cycle:")), strings.Join(titles, " → "))
+	}
+	for _, ref := range unknown {
+		fmt.Println(colors.Bold(colors.Red("Unknown item:")), ref)
+	}
+}
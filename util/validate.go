@@ -0,0 +1,178 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"time"
+)
+
+/**
+ * Statically checks the given checklist file for problems, without touching
+ * the environment. Returns all of the problems found.
+ */
+func ValidateChecklist(cf *ChecklistFile) []error {
+	var problems []error
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf("%s: %s", cf.Filename, fmt.Sprintf(format, args...)))
+	}
+
+	if cf.Title == "" {
+		problem("Missing checklist title")
+	}
+	if len(cf.Checklist) == 0 && len(cf.RunbookSteps) == 0 {
+		problem("There are no items in the checklist")
+	}
+
+	// Collect all the scripts that can reference a tool
+	var sources []string
+	for _, lib := range cf.Libs {
+		content, err := ioutil.ReadFile(lib)
+		if err != nil {
+			problem("Could not load library script %s: %s", lib, err.Error())
+			continue
+		}
+		sources = append(sources, string(content))
+	}
+
+	titles := make(map[string]int)
+	for i, item := range cf.Checklist {
+		where := fmt.Sprintf("Item #%d (%s)", i+1, item.Title)
+		if item.Title == "" {
+			where = fmt.Sprintf("Item #%d", i+1)
+			problem("%s has no title", where)
+		} else if prev, ok := titles[item.Title]; ok {
+			problem("%s has the same title as item #%d", where, prev)
+		} else {
+			titles[item.Title] = i + 1
+		}
+
+		if item.Script == "" && !item.HasBuiltinCheck() {
+			problem("%s has no script", where)
+		}
+		if item.ExpectMatch != "" {
+			if _, err := regexp.Compile(item.ExpectMatch); err != nil {
+				problem("%s has an invalid expect expression: %s", where, err.Error())
+			}
+		}
+		if (item.RunbookID == "") != (item.RunbookStep == "") {
+			problem("%s must define both runbook_id and runbook_step", where)
+		}
+
+		sources = append(sources, item.Script, item.ExpectScript, item.OnPass, item.OnFail)
+		if item.Wait != nil {
+			sources = append(sources, item.Wait.Until)
+		}
+	}
+
+	for _, step := range cf.RunbookSteps {
+		if step == "" {
+			problem("Empty runbook step reference")
+		} else if _, _, err := ParseRunbookStepRef(step); err != nil {
+			problem("%s", err.Error())
+		}
+	}
+
+	for name, override := range cf.Overrides {
+		if err := override.validate(cf); err != nil {
+			problem("Invalid overrides for environment '%s': %s", name, err.Error())
+		}
+	}
+
+	// Check that the declared tools are actually used by some script
+	for _, tool := range cf.RequireTools {
+		rx := regexp.MustCompile(`(^|[^\w.-])` + regexp.QuoteMeta(tool) + `($|[^\w.-])`)
+		used := false
+		for _, source := range sources {
+			if rx.MatchString(source) {
+				used = true
+				break
+			}
+		}
+		if !used {
+			problem("Required tool '%s' is not referenced by any script", tool)
+		}
+	}
+
+	return problems
+}
+
+// The scripts that build the names of the variables they read are not
+// checked for unused variables
+var rxDynamicVarNames = regexp.MustCompile(`\$\{!|\beval\b|\bprintenv\b|\benv\s*($|\|)`)
+
+/**
+ * Returns a warning for every variable declared in the `vars` of the checklist
+ * that none of its scripts, titles or other variables mention. This is
+ * conservative: any mention of the name counts as a use, and nothing is
+ * reported if a script could build the names of the variables it reads.
+ */
+func CheckUnusedVars(cf *ChecklistFile) []error {
+	if len(cf.Env) == 0 {
+		return nil
+	}
+
+	sources := append([]string{cf.AfterEach, cf.Snapshot, cf.Verify}, cf.HeaderCommands...)
+	for _, lib := range cf.Libs {
+		content, err := ioutil.ReadFile(lib)
+		if err != nil {
+			return nil
+		}
+		sources = append(sources, string(content))
+	}
+	for _, value := range cf.Env {
+		sources = append(sources, value)
+	}
+	for _, item := range cf.Checklist {
+		sources = append(sources, item.Title, item.Script, item.ExpectMatch, item.ExpectScript,
+			item.Remediation, item.OnPass, item.OnFail)
+		if item.Wait != nil {
+			sources = append(sources, item.Wait.Until)
+		}
+		for key := range item.RequireEnv {
+			sources = append(sources, key)
+		}
+	}
+	for _, source := range sources {
+		if rxDynamicVarNames.MatchString(source) {
+			return nil
+		}
+	}
+
+	var warnings []error
+	for _, key := range sortedKeys(cf.Env) {
+		rx := regexp.MustCompile(`(^|[^\w])` + regexp.QuoteMeta(key) + `($|[^\w])`)
+		used := false
+		for _, source := range sources {
+			if rx.MatchString(source) {
+				used = true
+				break
+			}
+		}
+		if !used {
+			warnings = append(warnings, fmt.Errorf("%s: Variable %s is not referenced by any item", cf.Filename, key))
+		}
+	}
+	return warnings
+}
+
+/**
+ * Returns a warning if the `last_reviewed` date in the checklist metadata is
+ * older than the given age
+ */
+func CheckStaleChecklist(cf *ChecklistFile, maxAge time.Duration) error {
+	value, ok := cf.Meta["last_reviewed"]
+	if !ok {
+		return nil
+	}
+
+	reviewed, err := time.Parse("2006-01-02", fmt.Sprintf("%v", value))
+	if err != nil {
+		return fmt.Errorf("%s: Could not parse last_reviewed date '%v' (expecting YYYY-MM-DD)", cf.Filename, value)
+	}
+	if time.Since(reviewed) > maxAge {
+		return fmt.Errorf("%s: Stale checklist, last reviewed on %s", cf.Filename, reviewed.Format("2006-01-02"))
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"text/template"
+
+	"gopkg.in/yaml.v2"
+)
+
+/**
+ * Converts the maps decoded by the YAML parser to string-keyed maps, so that
+ * their keys can be referenced from the templates
+ */
+func normalizeValues(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{})
+		for key, child := range v {
+			m[fmt.Sprintf("%v", key)] = normalizeValues(child)
+		}
+		return m
+	case []interface{}:
+		for i, child := range v {
+			v[i] = normalizeValues(child)
+		}
+	}
+	return value
+}
+
+/**
+ * Loads a YAML or JSON file with the values to render the checklists with
+ */
+func LoadValues(filename string) (map[string]interface{}, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read values %s: %s", filename, err.Error())
+	}
+
+	var values map[interface{}]interface{}
+	err = yaml.Unmarshal(content, &values)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse values %s: %s", filename, err.Error())
+	}
+
+	return normalizeValues(values).(map[string]interface{}), nil
+}
+
+/**
+ * Renders the given text as a Go template against the values, failing on
+ * references to missing keys
+ */
+func renderValues(name string, text string, values map[string]interface{}) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	err = tmpl.Execute(&out, values)
+	if err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+/**
+ * Renders the titles, the scripts and the expectations of the checklist
+ * items against the values
+ */
+func RenderChecklistValues(cf *ChecklistFile, values map[string]interface{}) error {
+	for i := range cf.Checklist {
+		item := &cf.Checklist[i]
+		for _, field := range []struct {
+			name string
+			text *string
+		}{
+			{"title", &item.Title},
+			{"script", &item.Script},
+			{"expect", &item.ExpectMatch},
+			{"expect_script", &item.ExpectScript},
+			{"remediation", &item.Remediation},
+		} {
+			rendered, err := renderValues(fmt.Sprintf("%s: item #%d %s", cf.Filename, i+1, field.name), *field.text, values)
+			if err != nil {
+				return fmt.Errorf("Could not render the values: %s", err.Error())
+			}
+			*field.text = rendered
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+/**
+ * @brief      Leaves out the items of the variants that are not selected by
+ *             the variant variable of the file, from its vars or from the
+ *             environment. No variant is selected if the variable is empty.
+ *
+ * @return     The error of an unknown variant, or of a variant that lists an
+ *             item that is not in the checklist
+ */
+func (f *ChecklistFile) selectVariant() error {
+	if len(f.Variants) == 0 {
+		return nil
+	}
+	value, ok := f.Env[f.VariantVar]
+	if !ok {
+		value = os.Getenv(f.VariantVar)
+	}
+
+	titles := make(map[string]bool)
+	for _, item := range f.Checklist {
+		for _, ref := range item.Refs() {
+			titles[ref] = true
+		}
+	}
+	var names []string
+	inVariant := make(map[string]bool)
+	for name, items := range f.Variants {
+		names = append(names, name)
+		for _, title := range items {
+			if !titles[title] {
+				return fmt.Errorf("Variant %s of %s lists the unknown item '%s'", name, f.Filename, title)
+			}
+			inVariant[title] = true
+		}
+	}
+	sort.Strings(names)
+	if _, ok := f.Variants[value]; value != "" && !ok {
+		return fmt.Errorf("Unknown variant %s=%s for %s, expecting one of: %s", f.VariantVar, value, f.Filename, strings.Join(names, ", "))
+	}
+
+	selected := make(map[string]bool)
+	for _, title := range f.Variants[value] {
+		selected[title] = true
+	}
+	var checklist Checklist
+	for _, item := range f.Checklist {
+		in, picked := false, false
+		for _, ref := range item.Refs() {
+			in, picked = in || inVariant[ref], picked || selected[ref]
+		}
+		if !in || picked {
+			checklist = append(checklist, item)
+		}
+	}
+	f.Checklist = checklist
+	f.SelectedVariant = value
+	return nil
+}
@@ -0,0 +1,79 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The defaults of the wait checks that don't define their own
+const waitDefaultInterval = 5 * time.Second
+const waitDefaultTimeout = 5 * time.Minute
+
+/**
+ * A built-in check that polls a condition command until it succeeds, for
+ * the "wait for rollout" kind of checks
+ */
+type WaitCheck struct {
+	// The command that succeeds once the condition is met
+	Until string
+
+	// The time to wait between the attempts (e.g. 10s)
+	Interval string
+
+	// The time to give up after (e.g. 10m)
+	Timeout string
+}
+
+/**
+ * Validates the definition of the check
+ */
+func (c *WaitCheck) Validate() error {
+	if c.Until == "" {
+		return fmt.Errorf("Missing the condition command to wait for")
+	}
+	if err := ValidateDuration(c.Interval); err != nil {
+		return err
+	}
+	return ValidateDuration(c.Timeout)
+}
+
+func (c *WaitCheck) durations() (time.Duration, time.Duration) {
+	interval, timeout := waitDefaultInterval, waitDefaultTimeout
+	if c.Interval != "" {
+		interval, _ = time.ParseDuration(c.Interval)
+	}
+	if c.Timeout != "" {
+		timeout, _ = time.ParseDuration(c.Timeout)
+	}
+	return interval, timeout
+}
+
+/**
+ * Runs the condition command until it succeeds, reporting the progress of
+ * the wait to the stderr callback of the runner. Returns the output of the
+ * command, or an error with how long it waited.
+ */
+func (c *WaitCheck) Run(runner *Runner, opts RunOptions) (string, string, error) {
+	interval, timeout := c.durations()
+	started := time.Now()
+	for attempt := 1; ; attempt++ {
+		sout, serr, err := runner.RunWithOptions(c.Until, "", opts)
+		waited := time.Since(started).Round(time.Second)
+		if err == nil {
+			sout = strings.TrimSpace(sout)
+			if sout == "" {
+				sout = fmt.Sprintf("Ready after %s", waited)
+			}
+			return sout, serr, nil
+		}
+
+		if waited+interval > timeout {
+			return "", serr, fmt.Errorf("Condition not met after waiting %s (%d attempts)", waited, attempt)
+		}
+		if runner.StderrCallback != nil {
+			runner.StderrCallback(fmt.Sprintf("Condition not met after %s, waiting %s (attempt %d)", waited, interval, attempt))
+		}
+		time.Sleep(interval)
+	}
+}